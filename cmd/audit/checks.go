@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+type auditor struct {
+	exp         *BoardExport
+	authorityPK *triptych.Point
+	logPK       *triptych.Point
+	extra       []*triptych.RingSnapshot
+	report      Report
+	// snapshot digests the ballots may name
+	digests map[triptych.Hash]string
+}
+
+func (a *auditor) add(kind string, refs []BallotRef, format string, args ...interface{}) {
+	a.report.Discrepancies = append(a.report.Discrepancies, Discrepancy{Kind: kind, Detail: fmt.Sprintf(format, args...), Ballots: refs})
+}
+
+func (a *auditor) warn(format string, args ...interface{}) {
+	a.report.Warnings = append(a.report.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (a *auditor) run() {
+	a.checkSnapshots()
+	a.checkLog()
+	a.checkTally(a.checkBallots())
+}
+
+func (a *auditor) checkSnapshots() {
+	e := a.exp.Election
+	authKey := a.authorityPK
+	if m := e.Manifest; m != nil {
+		switch {
+		case m.Verify() != nil || m.ElectionID != e.ID:
+			a.add("bad_manifest", nil, "manifest signature is invalid or names another election")
+			authKey = nil
+		case authKey == nil:
+			authKey = m.AuthorityKey
+			a.warn("authority key taken from the exported manifest; pass -authority-pk to pin it")
+		case !authKey.Equal(m.AuthorityKey):
+			a.add("bad_manifest", nil, "manifest is signed by another authority key")
+		}
+	} else {
+		a.warn("election has no manifest")
+	}
+
+	snaps := a.extra
+	if e.Ring != nil {
+		snaps = append([]*triptych.RingSnapshot{e.Ring}, snaps...)
+	}
+	if len(snaps) == 0 {
+		a.add("no_snapshot", nil, "no ring snapshot was published")
+	}
+	a.digests = map[triptych.Hash]string{}
+	for _, snap := range snaps {
+		if authKey != nil {
+			if err := snap.Verify(e.ID, authKey); err != nil {
+				a.add("bad_snapshot", nil, "snapshot %s: %v", snap.ID, err)
+				continue
+			}
+		} else {
+			if _, err := snap.RealKeys(); err != nil || triptych.Hash(triptych.RingDigest(snap.Keys)) != snap.Digest {
+				a.add("bad_snapshot", nil, "snapshot %s does not match its keys", snap.ID)
+				continue
+			}
+			a.warn("snapshot %s is not checked against an authority key", snap.ID)
+		}
+		a.digests[snap.Digest] = snap.ID
+	}
+}
+
+// checkLog rebuilds the bulletin log from the exported bulletins and
+// compares it with the signed tree head.
+func (a *auditor) checkLog() {
+	logKey := a.logPK
+	if logKey == nil {
+		logKey = a.exp.LogKey
+		a.warn("log key taken from the export; pass -log-pk to pin it")
+	}
+	sth := a.exp.TreeHead
+	if logKey == nil || sth.Verify(logKey) != nil {
+		a.add("bad_tree_head", nil, "tree head signature does not verify")
+	}
+
+	var head triptych.Hash
+	leaves := make([]triptych.Hash, 0, len(a.exp.Bulletins))
+	for i, b := range a.exp.Bulletins {
+		ref := []BallotRef{{LogIndex: i, UNumber: b.UNumber}}
+		ballot, err1 := base64.StdEncoding.DecodeString(b.BallotB64)
+		sig, err2 := base64.StdEncoding.DecodeString(b.SignatureB64)
+		if err1 != nil || err2 != nil {
+			a.add("bad_log_entry", ref, "ballot or signature is not valid base64")
+		}
+		if b.LogIndex != uint64(i) {
+			a.add("log_mismatch", ref, "bulletin is at position %d but claims log index %d", i, b.LogIndex)
+		}
+		if b.PrevHead != head {
+			a.add("broken_chain", ref, "bulletin does not name the chain head before it")
+		}
+		e := triptych.LogEntry{Index: b.LogIndex, PrevHead: b.PrevHead, Ballot: ballot, Signature: sig, AcceptedAt: b.AcceptedAt.UnixMilli()}
+		head = e.LeafHash()
+		leaves = append(leaves, head)
+	}
+
+	switch {
+	case sth.TreeSize > uint64(len(leaves)):
+		a.add("missing_bulletins", nil, "tree head covers %d entries but the export has %d bulletins", sth.TreeSize, len(leaves))
+	case sth.TreeSize < uint64(len(leaves)):
+		a.add("log_mismatch", nil, "export has %d bulletins but the tree head covers only %d", len(leaves), sth.TreeSize)
+	case triptych.MerkleRoot(leaves) != sth.RootHash || head != sth.ChainHead:
+		a.add("log_mismatch", nil, "bulletins do not hash to the signed tree head")
+	}
+}
+
+// checkBallots verifies every bulletin and returns, per candidate, the
+// ballots the audit counts for them.
+func (a *auditor) checkBallots() map[string][]BallotRef {
+	cands := map[string]bool{}
+	for _, c := range a.exp.Candidates {
+		cands[c.ID] = true
+	}
+	seen := map[string][]BallotRef{}
+	var order []string
+	ballots := make([]*triptych.Ballot, len(a.exp.Bulletins))
+	for i, b := range a.exp.Bulletins {
+		ref := BallotRef{LogIndex: i, UNumber: b.UNumber}
+		if _, ok := seen[b.UNumber]; !ok {
+			order = append(order, b.UNumber)
+		}
+		seen[b.UNumber] = append(seen[b.UNumber], ref)
+		if ballot, ok := a.checkBallot(ref, b); ok {
+			ballots[i] = ballot
+		}
+	}
+	chosen := a.countedBallots(ballots)
+
+	counted := map[string][]BallotRef{}
+	for i, ballot := range ballots {
+		if ballot == nil {
+			continue
+		}
+		b := a.exp.Bulletins[i]
+		ref := BallotRef{LogIndex: i, UNumber: b.UNumber}
+		candidate := a.checkContent(ref, b, ballot)
+		if !chosen[i] || candidate == "" {
+			continue
+		}
+		if !cands[candidate] {
+			a.add("unknown_candidate", []BallotRef{ref}, "ballot is for unknown candidate %s", candidate)
+			continue
+		}
+		counted[candidate] = append(counted[candidate], ref)
+	}
+
+	if !a.exp.Election.Revoting {
+		for _, u := range order {
+			if refs := seen[u]; len(refs) > 1 {
+				a.add("duplicate_key_image", refs, "key image %s appears %d times", u, len(refs))
+			}
+		}
+	}
+	return counted
+}
+
+// countedBallots picks, among the valid ballots, the one that counts for
+// every key image: the first one, or with revoting the last one in the log.
+// A revote must carry a higher Seq than the ballot it replaces.
+func (a *auditor) countedBallots(ballots []*triptych.Ballot) []bool {
+	chosen := make([]bool, len(ballots))
+	pos := map[string]int{}
+	valid := 0
+	for i, ballot := range ballots {
+		if ballot == nil {
+			continue
+		}
+		valid++
+		u := a.exp.Bulletins[i].UNumber
+		j, ok := pos[u]
+		switch {
+		case !ok:
+		case !a.exp.Election.Revoting:
+			continue
+		case ballot.Seq <= ballots[j].Seq:
+			a.add("stale_revote", []BallotRef{{LogIndex: j, UNumber: u}, {LogIndex: i, UNumber: u}},
+				"revote has seq %d, not above the previous ballot's %d", ballot.Seq, ballots[j].Seq)
+			continue
+		default:
+			chosen[j] = false
+		}
+		pos[u] = i
+		chosen[i] = true
+	}
+	a.report.ValidBallots = len(pos)
+	if a.exp.Election.Revoting {
+		a.report.Superseded = valid - len(pos)
+	}
+	return chosen
+}
+
+// checkContent checks what the board recorded for a valid ballot and
+// returns the candidate the ballot counts for, if it counts for one here.
+func (a *auditor) checkContent(ref BallotRef, b Bulletin, ballot *triptych.Ballot) string {
+	refs := []BallotRef{ref}
+	switch ballot.Type {
+	case triptych.BallotPlurality:
+		candidate := ballot.Choices[0].Candidate
+		if b.CandidateID != candidate {
+			a.add("candidate_mismatch", refs, "ballot is for %s but the board recorded %q", candidate, b.CandidateID)
+		}
+		return candidate
+	case triptych.BallotCommitment:
+		if b.Opening == "" {
+			return ""
+		}
+		if err := checkReveal(ballot, b); err != nil {
+			a.add("bad_reveal", refs, "%v", err)
+			return ""
+		}
+		return b.CandidateID
+	case triptych.BallotEncrypted:
+		if a.exp.ElectionPK == nil {
+			a.add("bad_encrypted_ballot", refs, "encrypted ballot in an election without an election key")
+			return ""
+		}
+		eb, err := triptych.ParseEncryptedBallot(ballot.Payload)
+		if err == nil {
+			minC, maxC := triptych.ChoiceBounds(a.exp.Election.MaxChoices)
+			err = triptych.VerifyEncryptedBallot(a.exp.ElectionPK, eb, minC, maxC)
+		}
+		if err != nil {
+			a.add("bad_encrypted_ballot", refs, "%v", err)
+		}
+	default:
+		if b.CandidateID != "" {
+			a.add("candidate_mismatch", refs, "board counts a %s ballot for %s", ballot.Type, b.CandidateID)
+		}
+	}
+	return ""
+}
+
+// checkBallot reports the first problem with a bulletin; only ballots with
+// no problem are counted.
+func (a *auditor) checkBallot(ref BallotRef, b Bulletin) (*triptych.Ballot, bool) {
+	refs := []BallotRef{ref}
+	e := a.exp.Election
+	msg, err := base64.StdEncoding.DecodeString(b.BallotB64)
+	if err != nil {
+		a.add("bad_ballot", refs, "ballot is not valid base64")
+		return nil, false
+	}
+	ballot, err := triptych.ParseBallot(msg)
+	if err != nil {
+		a.add("bad_ballot", refs, "%v", err)
+		return nil, false
+	}
+	if ballot.ElectionID != e.ID {
+		a.add("wrong_election", refs, "ballot is for election %q", ballot.ElectionID)
+		return nil, false
+	}
+	if triptych.CheckWindow(e.VotingOpens.Truncate(time.Second), e.VotingCloses, ballot.CreatedAt) != nil ||
+		triptych.CheckWindow(e.VotingOpens, e.VotingCloses, b.AcceptedAt) != nil {
+		a.add("outside_window", refs, "ballot created %s, accepted %s", ballot.CreatedAt.Format(time.RFC3339), b.AcceptedAt.Format(time.RFC3339))
+		return nil, false
+	}
+
+	if len(b.Ring) == 0 {
+		a.add("missing_ring", refs, "board did not keep the ring the ballot was signed with")
+		return nil, false
+	}
+	ring := make([]*triptych.Point, len(b.Ring))
+	for j, s := range b.Ring {
+		ring[j] = new(triptych.Point)
+		if err := ring[j].UnmarshalText([]byte(s)); err != nil {
+			a.add("bad_ring", refs, "ring[%d]: %v", j, err)
+			return nil, false
+		}
+	}
+	size := 1
+	for j := 0; j < b.M; j++ {
+		size *= b.N
+	}
+	if b.N < 2 || b.M < 1 || size != len(ring) {
+		a.add("bad_ring", refs, "ring has %d keys, not n^m for n=%d m=%d", len(ring), b.N, b.M)
+		return nil, false
+	}
+	if ballot.CheckContext("", ring) != nil {
+		a.add("ring_mismatch", refs, "ballot names a different ring than the one stored with it")
+		return nil, false
+	}
+	if _, ok := a.digests[triptych.Hash(ballot.RingDigest)]; !ok {
+		a.add("unknown_ring", refs, "ring %x is not a published snapshot", ballot.RingDigest[:8])
+		return nil, false
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(b.SignatureB64)
+	if err != nil || len(blob) < 33 {
+		a.add("bad_signature", refs, "signature is not valid base64")
+		return nil, false
+	}
+	sig, err := triptych.Deserialize(blob[33:], b.M, b.N, blob[:33])
+	if err != nil {
+		a.add("bad_signature", refs, "deserialize: %v", err)
+		return nil, false
+	}
+	ok, keyImage := triptych.VerifyTriptych(sig, msg, ring, b.N, b.M)
+	if !ok {
+		a.add("bad_signature", refs, "ring signature does not verify")
+		return nil, false
+	}
+	if hex.EncodeToString(keyImage) != b.UNumber {
+		a.add("key_image_mismatch", refs, "signature has key image %x", keyImage)
+		return nil, false
+	}
+	return ballot, true
+}
+
+func checkReveal(ballot *triptych.Ballot, b Bulletin) error {
+	commitment, err := triptych.ParseCompressed(ballot.Payload)
+	if err != nil {
+		return fmt.Errorf("bad commitment: %v", err)
+	}
+	rv := triptych.Reveal{CandidateID: b.CandidateID, KeyImage: new(triptych.Point), Opening: new(triptych.Scalar), Proof: new(triptych.DLEQProof)}
+	if rv.KeyImage.UnmarshalText([]byte(b.UNumber)) != nil || rv.Opening.UnmarshalText([]byte(b.Opening)) != nil ||
+		rv.Proof.UnmarshalText([]byte(b.RevealProof)) != nil {
+		return fmt.Errorf("reveal is malformed")
+	}
+	return triptych.VerifyReveal(commitment, &rv)
+}
+
+// checkTally compares the recomputed counts with the published results. A
+// mismatch lists the ballots that only one side counted for the candidate.
+func (a *auditor) checkTally(counted map[string][]BallotRef) {
+	reported := map[string]int{}
+	for _, r := range a.exp.Results {
+		reported[r.ID] = r.Votes
+	}
+	// The board counts the last bulletin per key image.
+	last := map[string]int{}
+	for i, b := range a.exp.Bulletins {
+		last[b.UNumber] = i
+	}
+	byBoard := map[string][]BallotRef{}
+	for i, b := range a.exp.Bulletins {
+		if b.CandidateID != "" && last[b.UNumber] == i {
+			byBoard[b.CandidateID] = append(byBoard[b.CandidateID], BallotRef{LogIndex: i, UNumber: b.UNumber})
+		}
+	}
+
+	known := map[string]bool{}
+	a.report.Tally = []TallyRow{}
+	for _, c := range a.exp.Candidates {
+		known[c.ID] = true
+		row := TallyRow{CandidateID: c.ID, Fullname: c.Fullname, Recomputed: len(counted[c.ID]), Reported: reported[c.ID]}
+		a.report.Tally = append(a.report.Tally, row)
+		if row.Recomputed != row.Reported {
+			a.add("tally_mismatch", symmetricDiff(counted[c.ID], byBoard[c.ID]),
+				"candidate %s: recomputed %d, reported %d", c.ID, row.Recomputed, row.Reported)
+		}
+	}
+	for _, r := range a.exp.Results {
+		if !known[r.ID] {
+			a.add("unknown_candidate", byBoard[r.ID], "results list unknown candidate %s with %d votes", r.ID, r.Votes)
+		}
+	}
+}
+
+func symmetricDiff(x, y []BallotRef) []BallotRef {
+	in := func(s []BallotRef, r BallotRef) bool {
+		for _, q := range s {
+			if q == r {
+				return true
+			}
+		}
+		return false
+	}
+	var out []BallotRef
+	for _, r := range x {
+		if !in(y, r) {
+			out = append(out, r)
+		}
+	}
+	for _, r := range y {
+		if !in(x, r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// audit re-checks an election from the board's public export alone: every
+// signature, key-image uniqueness, rings against the signed snapshots, the
+// bulletin log against its signed tree head, and the published results.
+
+type Candidate struct {
+	ID       string `json:"id"`
+	Fullname string `json:"fullname"`
+}
+
+type Bulletin struct {
+	UNumber      string        `json:"uNumber"`
+	SignatureB64 string        `json:"signatureB64"`
+	BallotB64    string        `json:"ballotB64"`
+	Type         string        `json:"type"`
+	CandidateID  string        `json:"candidateId"`
+	Commitment   string        `json:"commitment"`
+	Opening      string        `json:"opening"`
+	RevealProof  string        `json:"revealProof"`
+	Ring         []string      `json:"ring"`
+	N            int           `json:"n"`
+	M            int           `json:"m"`
+	AcceptedAt   time.Time     `json:"acceptedAt"`
+	LogIndex     uint64        `json:"logIndex"`
+	PrevHead     triptych.Hash `json:"prevHead"`
+}
+
+type CandidateResultDTO struct {
+	ID       string `json:"id"`
+	Fullname string `json:"fullname"`
+	Votes    int    `json:"votes"`
+}
+
+type BoardExport struct {
+	Election   *triptych.Election      `json:"election"`
+	ElectionPK *triptych.Point         `json:"electionPublicKey"`
+	Candidates []Candidate             `json:"candidates"`
+	Bulletins  []Bulletin              `json:"bulletins"`
+	TreeHead   triptych.SignedTreeHead `json:"treeHead"`
+	LogKey     *triptych.Point         `json:"logKey"`
+	Results    []CandidateResultDTO    `json:"results"`
+	ExportedAt time.Time               `json:"exportedAt"`
+}
+
+// Report is the machine-readable result. OK is true only when there are
+// no discrepancies; warnings are weaker checks that could not be made.
+// ValidBallots counts one ballot per key image; Superseded is the number of
+// valid ballots a later revote replaced.
+type Report struct {
+	ElectionID    string        `json:"electionId"`
+	Source        string        `json:"source"`
+	GeneratedAt   time.Time     `json:"generatedAt"`
+	Bulletins     int           `json:"bulletins"`
+	ValidBallots  int           `json:"validBallots"`
+	Superseded    int           `json:"superseded,omitempty"`
+	Tally         []TallyRow    `json:"tally"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+	Warnings      []string      `json:"warnings,omitempty"`
+	OK            bool          `json:"ok"`
+}
+
+type TallyRow struct {
+	CandidateID string `json:"candidateId"`
+	Fullname    string `json:"fullname"`
+	Recomputed  int    `json:"recomputed"`
+	Reported    int    `json:"reported"`
+}
+
+type Discrepancy struct {
+	Kind    string      `json:"kind"`
+	Detail  string      `json:"detail"`
+	Ballots []BallotRef `json:"ballots,omitempty"`
+}
+
+// BallotRef identifies a ballot by its position in the bulletin log and
+// its key image.
+type BallotRef struct {
+	LogIndex int    `json:"logIndex"`
+	UNumber  string `json:"uNumber"`
+}
+
+func main() {
+	baseURL := flag.String("url", "", "базовый URL доски; выгрузка берётся с /api/export, результаты с /api/candidate/results")
+	exportPath := flag.String("export", "", "файл выгрузки доски (JSON с /api/export) вместо -url")
+	snapshots := flag.String("snapshots", "", "дополнительные опубликованные снимки кольца (JSON-файлы через запятую)")
+	authorityPK := flag.String("authority-pk", "", "публичный ключ избирательной комиссии (33B hex)")
+	logPK := flag.String("log-pk", "", "публичный ключ журнала доски (33B hex); по умолчанию из выгрузки")
+	out := flag.String("out", "", "куда записать отчёт (по умолчанию stdout)")
+	flag.Parse()
+
+	if (*baseURL == "") == (*exportPath == "") {
+		log.Fatalf("usage: audit -url http://localhost:8086 | -export board-export.json [-snapshots ring-1.json,...] [-authority-pk hex] [-out report.json]")
+	}
+
+	var exp BoardExport
+	source := *exportPath
+	if *baseURL != "" {
+		base := strings.TrimRight(*baseURL, "/")
+		source = base
+		if err := getJSON(base+"/api/export", &exp); err != nil {
+			log.Fatalf("fetch export: %v", err)
+		}
+		// Compare against what the board serves now, not what it put in the export.
+		if err := getJSON(base+"/api/candidate/results", &exp.Results); err != nil {
+			log.Fatalf("fetch results: %v", err)
+		}
+	} else {
+		b, err := os.ReadFile(*exportPath)
+		if err != nil {
+			log.Fatalf("read export: %v", err)
+		}
+		if err := json.Unmarshal(b, &exp); err != nil {
+			log.Fatalf("parse export: %v", err)
+		}
+	}
+	if exp.Election == nil {
+		log.Fatalf("export has no election")
+	}
+
+	a := &auditor{
+		exp:         &exp,
+		authorityPK: parsePoint(*authorityPK, "authority pk"),
+		logPK:       parsePoint(*logPK, "log pk"),
+		report: Report{
+			ElectionID:    exp.Election.ID,
+			Source:        source,
+			GeneratedAt:   time.Now().UTC(),
+			Bulletins:     len(exp.Bulletins),
+			Discrepancies: []Discrepancy{},
+		},
+	}
+	if *snapshots != "" {
+		for _, path := range strings.Split(*snapshots, ",") {
+			var snap triptych.RingSnapshot
+			b, err := os.ReadFile(path)
+			if err != nil {
+				log.Fatalf("read snapshot: %v", err)
+			}
+			if err := json.Unmarshal(b, &snap); err != nil {
+				log.Fatalf("parse snapshot %s: %v", path, err)
+			}
+			a.extra = append(a.extra, &snap)
+		}
+	}
+	a.run()
+
+	rep := a.report
+	rep.OK = len(rep.Discrepancies) == 0
+	b, _ := json.MarshalIndent(rep, "", "  ")
+	if *out == "" {
+		fmt.Println(string(b))
+	} else if err := os.WriteFile(*out, b, 0o644); err != nil {
+		log.Fatalf("write report: %v", err)
+	}
+	log.Printf("audit of %q: %d bulletins, %d valid, %d discrepancies", rep.ElectionID, rep.Bulletins, rep.ValidBallots, len(rep.Discrepancies))
+	if !rep.OK {
+		os.Exit(1)
+	}
+}
+
+func parsePoint(s, what string) *triptych.Point {
+	if s == "" {
+		return nil
+	}
+	p := new(triptych.Point)
+	if err := p.UnmarshalText([]byte(s)); err != nil {
+		log.Fatalf("bad %s: %v", what, err)
+	}
+	return p
+}
+
+func getJSON(url string, out interface{}) error {
+	client := &http.Client{Timeout: 60 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("http %d", res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
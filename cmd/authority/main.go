@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// The election authority works offline: its key never reaches the board.
+// It signs the election manifest before the board starts and later signs
+// the frozen ring snapshot after checking it against the voter roster.
+
+type authorityKeyFile struct {
+	PublicKey *triptych.Point  `json:"publicKey"`
+	SecretKey *triptych.Scalar `json:"secretKey"`
+	CreatedAt string           `json:"createdAt"`
+}
+
+type RingSignatureDTO struct {
+	Signature *triptych.SchnorrSignature `json:"signature"`
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "init":
+		runInit(os.Args[2:])
+	case "manifest":
+		runManifest(os.Args[2:])
+	case "sign-ring":
+		runSignRing(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Println("usage:")
+	fmt.Println("  authority init -out authority-key.json")
+	fmt.Println("  authority manifest -key authority-key.json -election default [-election-pk hex] [-registrar-pk hex] [-registration-opens RFC3339 ...] [-revoting] [-max-choices k] -out manifest.json")
+	fmt.Println("  authority sign-ring -key authority-key.json -url http://localhost:8086 [-roster roster.txt]")
+	os.Exit(2)
+}
+
+func runInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	out := fs.String("out", "authority-key.json", "секретный файл ключа избирательной комиссии")
+	_ = fs.Parse(args)
+
+	sk := triptych.RandomScalar()
+	writeFile(*out, authorityKeyFile{PublicKey: triptych.ScalarBaseMult(sk), SecretKey: sk, CreatedAt: time.Now().Format(time.RFC3339)}, 0o600)
+	pk, _ := triptych.ScalarBaseMult(sk).MarshalText()
+	fmt.Printf("Authority key saved to %s.\nPublic key (give it to voters as -authority-pk): %s\n", *out, pk)
+}
+
+func runManifest(args []string) {
+	fs := flag.NewFlagSet("manifest", flag.ExitOnError)
+	keyPath := fs.String("key", "authority-key.json", "секретный файл ключа избирательной комиссии")
+	electionID := fs.String("election", "", "идентификатор выборов")
+	electionPK := fs.String("election-pk", "", "публичный ключ выборов (33B hex), если бюллетени шифруются")
+	regOpens := fs.String("registration-opens", "", "начало регистрации (RFC 3339)")
+	regCloses := fs.String("registration-closes", "", "конец регистрации (RFC 3339)")
+	votingOpens := fs.String("voting-opens", "", "начало голосования (RFC 3339)")
+	votingCloses := fs.String("voting-closes", "", "конец голосования (RFC 3339)")
+	registrarPK := fs.String("registrar-pk", "", "публичный ключ регистратора (33B hex); если задан, в кольцо попадают только ключи с его удостоверением")
+	revoting := fs.Bool("revoting", false, "разрешить повторное голосование: засчитывается последний бюллетень избирателя")
+	maxChoices := fs.Int("max-choices", 0, "правило зашифрованных бюллетеней: 0 — ровно одна отметка, k — не больше k отметок (одобрительное)")
+	out := fs.String("out", "manifest.json", "куда сохранить подписанный манифест")
+	_ = fs.Parse(args)
+	if *electionID == "" {
+		usage()
+	}
+	sk := loadKey(*keyPath)
+
+	if *maxChoices < 0 || *maxChoices > 0xffff {
+		log.Fatalf("bad -max-choices %d", *maxChoices)
+	}
+	m := triptych.ElectionManifest{ElectionID: *electionID, Revoting: *revoting, MaxChoices: *maxChoices, CreatedAt: time.Now().UTC().Truncate(time.Millisecond)}
+	if *electionPK != "" {
+		m.ElectionPK = new(triptych.Point)
+		if err := m.ElectionPK.UnmarshalText([]byte(*electionPK)); err != nil {
+			log.Fatalf("bad election pk: %v", err)
+		}
+	}
+	if *registrarPK != "" {
+		m.RegistrarKey = new(triptych.Point)
+		if err := m.RegistrarKey.UnmarshalText([]byte(*registrarPK)); err != nil {
+			log.Fatalf("bad registrar pk: %v", err)
+		}
+	}
+	for _, w := range []struct {
+		dst *time.Time
+		v   string
+	}{{&m.RegistrationOpens, *regOpens}, {&m.RegistrationCloses, *regCloses}, {&m.VotingOpens, *votingOpens}, {&m.VotingCloses, *votingCloses}} {
+		if w.v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, w.v)
+		if err != nil {
+			log.Fatalf("bad time %q: %v", w.v, err)
+		}
+		*w.dst = t.UTC()
+	}
+	if err := m.Sign(sk); err != nil {
+		log.Fatalf("sign manifest: %v", err)
+	}
+	writeFile(*out, m, 0o644)
+	fmt.Printf("Manifest for election %q saved to %s.\n", m.ElectionID, *out)
+}
+
+// runSignRing fetches the frozen snapshot, checks it and posts the
+// signature back to the board.
+func runSignRing(args []string) {
+	fs := flag.NewFlagSet("sign-ring", flag.ExitOnError)
+	keyPath := fs.String("key", "authority-key.json", "секретный файл ключа избирательной комиссии")
+	baseURL := fs.String("url", "", "базовый URL доски")
+	rosterPath := fs.String("roster", "", "список допущенных публичных ключей (по одному 33B hex в строке); если задан, кольцо должно совпадать с ним")
+	_ = fs.Parse(args)
+	if *baseURL == "" {
+		usage()
+	}
+	sk := loadKey(*keyPath)
+	base := strings.TrimRight(*baseURL, "/")
+
+	var m triptych.ElectionManifest
+	if err := getJSON(base+"/api/election/manifest", &m); err != nil {
+		log.Fatalf("fetch manifest: %v", err)
+	}
+	if err := m.Verify(); err != nil || !m.AuthorityKey.Equal(triptych.ScalarBaseMult(sk)) {
+		log.Fatalf("доска работает не с нашим манифестом")
+	}
+	var snap triptych.RingSnapshot
+	if err := getJSON(base+"/api/election/ring", &snap); err != nil {
+		log.Fatalf("fetch ring: %v", err)
+	}
+	snap.Sign(m.ElectionID, sk)
+	if err := snap.Verify(m.ElectionID, m.AuthorityKey); err != nil {
+		log.Fatalf("snapshot: %v", err)
+	}
+	keys, _ := snap.RealKeys()
+	if *rosterPath != "" {
+		roster := readRoster(*rosterPath)
+		if len(roster) != len(keys) {
+			log.Fatalf("в кольце %d ключей, в списке допущенных %d", len(keys), len(roster))
+		}
+		for _, p := range keys {
+			b, _ := p.MarshalText()
+			if !roster[string(b)] {
+				log.Fatalf("ключ %s отсутствует в списке допущенных", b)
+			}
+		}
+	}
+
+	b, _ := json.Marshal(RingSignatureDTO{Signature: snap.Signature})
+	client := &http.Client{Timeout: 15 * time.Second}
+	res, err := client.Post(base+"/api/election/ring/signature", "application/json", bytes.NewReader(b))
+	if err != nil {
+		log.Fatalf("post signature: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		log.Fatalf("post signature: http %d", res.StatusCode)
+	}
+	fmt.Printf("Ring snapshot %s signed: %d registered keys, ring size %d.\n", snap.ID, len(keys), len(snap.Keys))
+}
+
+func readRoster(path string) map[string]bool {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("read roster: %v", err)
+	}
+	defer f.Close()
+	out := map[string]bool{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		p := new(triptych.Point)
+		if err := p.UnmarshalText([]byte(line)); err != nil {
+			log.Fatalf("bad roster key %q: %v", line, err)
+		}
+		b, _ := p.MarshalText()
+		out[string(b)] = true
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatalf("read roster: %v", err)
+	}
+	return out
+}
+
+func loadKey(path string) *triptych.Scalar {
+	var kf authorityKeyFile
+	readFile(path, &kf)
+	if kf.SecretKey == nil {
+		log.Fatalf("%s: no secret key", path)
+	}
+	return kf.SecretKey
+}
+
+func readFile(path string, v interface{}) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		log.Fatalf("parse %s: %v", path, err)
+	}
+}
+
+func writeFile(path string, v interface{}, perm os.FileMode) {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	if err := os.WriteFile(path, b, perm); err != nil {
+		log.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func getJSON(url string, out interface{}) error {
+	client := &http.Client{Timeout: 15 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("http %d", res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
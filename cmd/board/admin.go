@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Administrative calls (phase changes, adding candidates) need the admin
+// token as "Authorization: Bearer <token>". Like the log key, the token
+// lives in a file that is generated on first start.
+
+func loadAdminToken(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		tok := hex.EncodeToString(buf)
+		if err := os.WriteFile(path, []byte(tok+"\n"), 0o600); err != nil {
+			return "", err
+		}
+		log.Printf("generated admin token in %s", path)
+		return tok, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	tok := strings.TrimSpace(string(b))
+	if len(tok) < 16 {
+		return "", errors.New("admin token is shorter than 16 characters")
+	}
+	return tok, nil
+}
+
+// admin lets the request through only with the admin token.
+func (s *server) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(tok), []byte(s.adminToken)) != 1 {
+			log.Printf("[admin] rejected %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// challengeTTL is how long a registration nonce stays usable.
+	challengeTTL = 5 * time.Minute
+	// Anyone may ask for a nonce, so the open ones are capped in total and
+	// per client address.
+	maxChallenges        = 10000
+	maxChallengesPerAddr = 16
+)
+
+var (
+	errTooManyChallenges = errors.New("too many open registration challenges")
+	errAddrChallenges    = errors.New("too many open registration challenges from this address")
+)
+
+type ChallengeDTO struct {
+	ElectionID string    `json:"electionId"`
+	Nonce      string    `json:"nonce"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type challenge struct {
+	nonce string
+	addr  string
+	exp   time.Time
+}
+
+// challenges holds the registration nonces the board has issued. Each is
+// good for one registration attempt, successful or not.
+type challenges struct {
+	mu     sync.Mutex
+	issued map[string]challenge
+	// order is issue order, which with a fixed TTL is also expiry order;
+	// consumed nonces stay in it until they reach the front or it is
+	// compacted.
+	order  []challenge
+	byAddr map[string]int
+}
+
+func (c *challenges) issue(addr string, now time.Time) (string, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.issued == nil {
+		c.issued = map[string]challenge{}
+		c.byAddr = map[string]int{}
+	}
+	for len(c.order) > 0 && now.After(c.order[0].exp) {
+		if _, open := c.issued[c.order[0].nonce]; open {
+			c.forget(c.order[0])
+		}
+		c.order = c.order[1:]
+	}
+	if len(c.order) > 2*maxChallenges {
+		open := make([]challenge, 0, len(c.issued))
+		for _, ch := range c.order {
+			if _, ok := c.issued[ch.nonce]; ok {
+				open = append(open, ch)
+			}
+		}
+		c.order = open
+	}
+	switch {
+	case len(c.issued) >= maxChallenges:
+		return "", time.Time{}, errTooManyChallenges
+	case c.byAddr[addr] >= maxChallengesPerAddr:
+		return "", time.Time{}, errAddrChallenges
+	}
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	ch := challenge{nonce: hex.EncodeToString(b[:]), addr: addr, exp: now.Add(challengeTTL)}
+	c.issued[ch.nonce] = ch
+	c.byAddr[addr]++
+	c.order = append(c.order, ch)
+	return ch.nonce, ch.exp, nil
+}
+
+// consume reports whether nonce was issued and is still valid, and
+// forgets it either way.
+func (c *challenges) consume(nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, ok := c.issued[nonce]
+	if ok {
+		c.forget(ch)
+	}
+	return ok && !now.After(ch.exp)
+}
+
+func (c *challenges) forget(ch challenge) {
+	delete(c.issued, ch.nonce)
+	if c.byAddr[ch.addr]--; c.byAddr[ch.addr] <= 0 {
+		delete(c.byAddr, ch.addr)
+	}
+}
+
+func (s *server) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	nonce, exp, err := s.challenges.issue(addr, time.Now())
+	switch {
+	case errors.Is(err, errAddrChallenges):
+		w.Header().Set("Retry-After", "60")
+		writeError(w, http.StatusTooManyRequests, err.Error())
+		return
+	case err != nil:
+		w.Header().Set("Retry-After", "60")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, ChallengeDTO{ElectionID: s.store.Election().ID, Nonce: nonce, ExpiresAt: exp.UTC()})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"coursach/triptych/triptych"
+)
+
+type RingSignatureDTO struct {
+	Signature *triptych.SchnorrSignature `json:"signature"`
+}
+
+func loadManifest(path string) (*triptych.ElectionManifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m triptych.ElectionManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if err := m.Verify(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (s *server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	m := s.store.Election().Manifest
+	if m == nil {
+		writeError(w, http.StatusNotFound, "election has no manifest")
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// handleRingSignature stores the authority's signature over the frozen
+// snapshot. The board never holds the authority key, so it can only pass
+// on a snapshot the authority has seen.
+func (s *server) handleRingSignature(w http.ResponseWriter, r *http.Request) {
+	var dto RingSignatureDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil || dto.Signature == nil {
+		writeError(w, http.StatusBadRequest, "bad signature")
+		return
+	}
+	s.phaseMu.Lock()
+	defer s.phaseMu.Unlock()
+	e := s.store.Election()
+	switch {
+	case e.Manifest == nil:
+		writeError(w, http.StatusConflict, "election has no manifest")
+		return
+	case e.Phase != triptych.PhaseFrozen:
+		writeError(w, http.StatusConflict, triptych.ErrWrongPhase.Error())
+		return
+	}
+	snap := *e.Ring
+	snap.Signature = dto.Signature
+	if err := snap.Verify(e.ID, e.Manifest.AuthorityKey); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	e.Ring = &snap
+	if err := s.store.SaveElection(*e); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	log.Printf("[election] ring snapshot %s signed by the authority", snap.ID)
+	writeJSON(w, http.StatusOK, snap)
+}
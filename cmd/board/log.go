@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// ballotLog is the Merkle tree over accepted bulletins, in acceptance order.
+// It lives inside the store so the chain head a bulletin names is the one
+// left by the bulletin written just before it.
+type ballotLog struct {
+	leaves []triptych.Hash
+	head   triptych.Hash
+}
+
+var ErrBadRange = errors.New("tree size out of range")
+
+type logKeyFile struct {
+	PublicKey *triptych.Point  `json:"publicKey"`
+	SecretKey *triptych.Scalar `json:"secretKey"`
+	CreatedAt string           `json:"createdAt"`
+}
+
+type LogKeyDTO struct {
+	PublicKey *triptych.Point `json:"publicKey"`
+}
+
+type InclusionDTO struct {
+	Index    uint64          `json:"index"`
+	TreeSize uint64          `json:"treeSize"`
+	Proof    []triptych.Hash `json:"proof"`
+}
+
+type ConsistencyDTO struct {
+	First  uint64          `json:"first"`
+	Second uint64          `json:"second"`
+	Proof  []triptych.Hash `json:"proof"`
+}
+
+// bulletinEntry rebuilds the log entry for a stamped bulletin.
+func bulletinEntry(b Bulletin) (triptych.LogEntry, error) {
+	ballot, err := base64.StdEncoding.DecodeString(b.BallotB64)
+	if err != nil {
+		return triptych.LogEntry{}, fmt.Errorf("bulletin %s: bad ballot: %w", b.UNumber, err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(b.SignatureB64)
+	if err != nil {
+		return triptych.LogEntry{}, fmt.Errorf("bulletin %s: bad signature: %w", b.UNumber, err)
+	}
+	return triptych.LogEntry{
+		Index:      b.LogIndex,
+		PrevHead:   b.PrevHead,
+		Ballot:     ballot,
+		Signature:  sig,
+		AcceptedAt: b.AcceptedAt.UnixMilli(),
+	}, nil
+}
+
+func (l *ballotLog) stamp(b *Bulletin) {
+	b.LogIndex, b.PrevHead = uint64(len(l.leaves)), l.head
+}
+
+func (l *ballotLog) append(e triptych.LogEntry) error {
+	if e.Index != uint64(len(l.leaves)) || e.PrevHead != l.head {
+		return triptych.ErrBrokenChain
+	}
+	l.head = e.LeafHash()
+	l.leaves = append(l.leaves, l.head)
+	return nil
+}
+
+func (l *ballotLog) inclusion(index, size uint64) ([]triptych.Hash, error) {
+	if size > uint64(len(l.leaves)) || index >= size {
+		return nil, ErrBadRange
+	}
+	return triptych.InclusionProof(l.leaves[:size], int(index))
+}
+
+func (l *ballotLog) consistency(first, second uint64) ([]triptych.Hash, error) {
+	if first > second || second > uint64(len(l.leaves)) {
+		return nil, ErrBadRange
+	}
+	return triptych.ConsistencyProof(l.leaves[:second], int(first))
+}
+
+// loadLogKey reads the tree-head signing key, creating it on first start.
+func loadLogKey(path string) (*triptych.Scalar, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		sk := triptych.RandomScalar()
+		kf := logKeyFile{PublicKey: triptych.ScalarBaseMult(sk), SecretKey: sk, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+		out, _ := json.MarshalIndent(kf, "", "  ")
+		if err := os.WriteFile(path, out, 0o600); err != nil {
+			return nil, err
+		}
+		log.Printf("generated log signing key in %s", path)
+		return sk, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var kf logKeyFile
+	if err := json.Unmarshal(b, &kf); err != nil {
+		return nil, err
+	}
+	if kf.SecretKey == nil || kf.SecretKey.IsZero() {
+		return nil, errors.New("log key file has no secret key")
+	}
+	return kf.SecretKey, nil
+}
+
+func (s *server) signedHead() triptych.SignedTreeHead {
+	size, root, head := s.store.TreeHead()
+	sth := triptych.SignedTreeHead{
+		TreeSize:  size,
+		Timestamp: time.Now().UnixMilli(),
+		RootHash:  root,
+		ChainHead: head,
+	}
+	sth.Sign(s.logKey)
+	return sth
+}
+
+// receipt is returned for an accepted bulletin: the entry, a fresh tree
+// head and the path from the entry to that head.
+func (s *server) receipt(e triptych.LogEntry) (*triptych.Receipt, error) {
+	sth := s.signedHead()
+	proof, err := s.store.InclusionProof(e.Index, sth.TreeSize)
+	if err != nil {
+		return nil, err
+	}
+	return &triptych.Receipt{Entry: e, TreeHead: sth, Inclusion: proof}, nil
+}
+
+func (s *server) handleLogKey(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, LogKeyDTO{PublicKey: triptych.ScalarBaseMult(s.logKey)})
+}
+
+func (s *server) handleTreeHead(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.signedHead())
+}
+
+func (s *server) handleLogEntries(w http.ResponseWriter, r *http.Request) {
+	size, _, _ := s.store.TreeHead()
+	start, err1 := queryUint(r, "start", 0)
+	end, err2 := queryUint(r, "end", size)
+	if err1 != nil || err2 != nil {
+		writeError(w, http.StatusBadRequest, "start and end must be integers")
+		return
+	}
+	entries, err := s.store.LogEntries(start, end)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *server) handleInclusion(w http.ResponseWriter, r *http.Request) {
+	size, _, _ := s.store.TreeHead()
+	index, err1 := queryUint(r, "index", 0)
+	treeSize, err2 := queryUint(r, "size", size)
+	if err1 != nil || err2 != nil || !r.URL.Query().Has("index") {
+		writeError(w, http.StatusBadRequest, "index required; index and size must be integers")
+		return
+	}
+	proof, err := s.store.InclusionProof(index, treeSize)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, InclusionDTO{Index: index, TreeSize: treeSize, Proof: nonNil(proof)})
+}
+
+func (s *server) handleConsistency(w http.ResponseWriter, r *http.Request) {
+	size, _, _ := s.store.TreeHead()
+	first, err1 := queryUint(r, "first", 0)
+	second, err2 := queryUint(r, "second", size)
+	if err1 != nil || err2 != nil || !r.URL.Query().Has("first") {
+		writeError(w, http.StatusBadRequest, "first required; first and second must be integers")
+		return
+	}
+	proof, err := s.store.ConsistencyProof(first, second)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ConsistencyDTO{First: first, Second: second, Proof: nonNil(proof)})
+}
+
+func queryUint(r *http.Request, name string, def uint64) (uint64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.ParseUint(v, 10, 64)
+}
+
+func nonNil(p []triptych.Hash) []triptych.Hash {
+	if p == nil {
+		return []triptych.Hash{}
+	}
+	return p
+}
@@ -0,0 +1,718 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/bits"
+	mrand "math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// board is a single-process replacement for the Spring backend and
+// verify-http: same REST contract, ballots verified in-process.
+
+// SignerCreateDTO carries a proof of possession of the key over the nonce
+// from GET /api/signer/challenge and, if the election has a registrar, the
+// registrar's credential or, for an anonymous registration, a blind token.
+type SignerCreateDTO struct {
+	FullName   string                     `json:"fullName"`
+	PublicKey  *triptych.Point            `json:"publicKey"`
+	Nonce      string                     `json:"nonce"`
+	Proof      *triptych.SchnorrSignature `json:"proof"`
+	Credential *triptych.Credential       `json:"credential,omitempty"`
+	Token      *triptych.BlindSignature   `json:"token,omitempty"`
+}
+
+// RingDTO carries the frozen snapshot once there is one; RingID and Digest
+// are empty before the freeze.
+type RingDTO struct {
+	PublicKeys []string       `json:"publicKeys"`
+	RingSize   int            `json:"ringSize"`
+	Exp        int            `json:"exp"`
+	Base       int            `json:"base"`
+	RingID     string         `json:"ringId,omitempty"`
+	Digest     *triptych.Hash `json:"digest,omitempty"`
+}
+
+type CandidateResultDTO struct {
+	ID       string `json:"id"`
+	Fullname string `json:"fullname"`
+	Votes    int    `json:"votes"`
+}
+
+// BulletinCreateDTO names the frozen ring by its digest in RingID instead of
+// listing the keys; the signature is then over the canonical order.
+type BulletinCreateDTO struct {
+	BallotB64    string            `json:"ballotB64"`
+	SignatureB64 string            `json:"signatureB64"`
+	Ring         []*triptych.Point `json:"ring,omitempty"`
+	RingID       *triptych.Hash    `json:"ringId,omitempty"`
+	N            int               `json:"n"`
+	M            int               `json:"m"`
+}
+
+type ElectionDTO struct {
+	ID                 string                 `json:"id"`
+	PublicKey          *triptych.Point        `json:"publicKey"`
+	Phase              triptych.ElectionPhase `json:"phase"`
+	RegistrationOpens  time.Time              `json:"registrationOpens,omitzero"`
+	RegistrationCloses time.Time              `json:"registrationCloses,omitzero"`
+	VotingOpens        time.Time              `json:"votingOpens,omitzero"`
+	VotingCloses       time.Time              `json:"votingCloses,omitzero"`
+	Revoting           bool                   `json:"revoting"`
+	RingID             string                 `json:"ringId,omitempty"`
+	RingDigest         *triptych.Hash         `json:"ringDigest,omitempty"`
+	AuthorityKey       *triptych.Point        `json:"authorityKey,omitempty"`
+	RegistrarKey       *triptych.Point        `json:"registrarKey,omitempty"`
+	MaxChoices         int                    `json:"maxChoices,omitempty"`
+}
+
+type PhaseDTO struct {
+	Phase triptych.ElectionPhase `json:"phase"`
+}
+
+type CommitmentDTO struct {
+	UNumber      string `json:"uNumber"`
+	SignatureB64 string `json:"signatureB64"`
+	Commitment   string `json:"commitment"`
+	CandidateID  string `json:"candidateId,omitempty"`
+	Opening      string `json:"opening,omitempty"`
+	Proof        string `json:"proof,omitempty"`
+}
+
+type BallotEntryDTO struct {
+	UNumber   string `json:"uNumber"`
+	BallotB64 string `json:"ballotB64"`
+}
+
+type errorResponse struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+type server struct {
+	store      Store
+	electionPK *triptych.Point
+	logKey     *triptych.Scalar
+	adminToken string
+	challenges challenges
+	// phaseMu is held for reading by registration and ballot submission and
+	// for writing by phase changes, so nothing slips past a freeze or close.
+	phaseMu sync.RWMutex
+	// canonical caches the frozen ring in canonical order for bulletins
+	// that send only its digest.
+	canonicalMu sync.Mutex
+	canonical   []*triptych.Point
+}
+
+func main() {
+	addr := flag.String("addr", ":8086", "адрес HTTP-сервера")
+	dataPath := flag.String("data", "board.jsonl", "файл журнала доски (append-only)")
+	storeKind := flag.String("store", "file", "хранилище: file или memory")
+	electionID := flag.String("election-id", "default", "идентификатор выборов")
+	electionPK := flag.String("election-pk", "", "публичный ключ выборов (33B hex); если задан, принимаются только зашифрованные бюллетени")
+	regOpens := flag.String("registration-opens", "", "начало регистрации (RFC 3339); пусто — без ограничения")
+	regCloses := flag.String("registration-closes", "", "конец регистрации (RFC 3339)")
+	votingOpens := flag.String("voting-opens", "", "начало голосования (RFC 3339)")
+	votingCloses := flag.String("voting-closes", "", "конец голосования (RFC 3339)")
+	logKeyPath := flag.String("log-key", "board-log-key.json", "ключ подписи заголовков журнала бюллетеней (создаётся, если файла нет)")
+	adminTokenPath := flag.String("admin-token", "admin-token.txt", "токен администратора для смены фазы и списка кандидатов (создаётся, если файла нет)")
+	manifestPath := flag.String("manifest", "", "подписанный манифест выборов (authority manifest); задаёт идентификатор, окна и ключ выборов вместо флагов")
+	revoting := flag.Bool("revoting", false, "разрешить повторное голосование: засчитывается последний бюллетень избирателя")
+	maxChoices := flag.Int("max-choices", 0, "правило зашифрованных бюллетеней: 0 — ровно одна отметка, k — не больше k отметок (одобрительное)")
+	registrarPK := flag.String("registrar-pk", "", "публичный ключ регистратора (33B hex); если задан, регистрируются только ключи с его удостоверением")
+	flag.Parse()
+
+	s := &server{}
+	logKey, err := loadLogKey(*logKeyPath)
+	if err != nil {
+		log.Fatalf("log key: %v", err)
+	}
+	s.logKey = logKey
+	if s.adminToken, err = loadAdminToken(*adminTokenPath); err != nil {
+		log.Fatalf("admin token: %v", err)
+	}
+	if *electionPK != "" {
+		s.electionPK = new(triptych.Point)
+		if err := s.electionPK.UnmarshalText([]byte(*electionPK)); err != nil {
+			log.Fatalf("bad election pk: %v", err)
+		}
+	}
+	switch *storeKind {
+	case "file":
+		fs, err := openFileStore(*dataPath)
+		if err != nil {
+			log.Fatalf("open store: %v", err)
+		}
+		s.store = fs
+	case "memory":
+		s.store = newMemStore()
+	default:
+		log.Fatalf("unknown store %q", *storeKind)
+	}
+	defer s.store.Close()
+
+	var manifest *triptych.ElectionManifest
+	if *manifestPath != "" {
+		if manifest, err = loadManifest(*manifestPath); err != nil {
+			log.Fatalf("manifest: %v", err)
+		}
+		if s.electionPK != nil || *registrarPK != "" || *maxChoices != 0 {
+			log.Fatalf("-election-pk, -registrar-pk and -max-choices cannot be used with -manifest")
+		}
+		*electionID = manifest.ElectionID
+	}
+
+	if e := s.store.Election(); e != nil {
+		if e.ID != *electionID {
+			log.Fatalf("store holds election %q, not %q", e.ID, *electionID)
+		}
+		if manifest != nil && (e.Manifest == nil || !e.Manifest.Signature.Equal(manifest.Signature)) {
+			log.Fatalf("store holds another manifest for election %q", e.ID)
+		}
+		if e.Manifest != nil {
+			s.electionPK = e.Manifest.ElectionPK
+		}
+		log.Printf("election %q resumed in phase %s", e.ID, e.Phase)
+	} else if manifest != nil {
+		e := triptych.Election{
+			ID:                 manifest.ElectionID,
+			Phase:              triptych.PhaseSetup,
+			RegistrationOpens:  manifest.RegistrationOpens,
+			RegistrationCloses: manifest.RegistrationCloses,
+			VotingOpens:        manifest.VotingOpens,
+			VotingCloses:       manifest.VotingCloses,
+			Revoting:           manifest.Revoting,
+			RegistrarKey:       manifest.RegistrarKey,
+			MaxChoices:         manifest.MaxChoices,
+			Manifest:           manifest,
+		}
+		s.electionPK = manifest.ElectionPK
+		if err := s.store.SaveElection(e); err != nil {
+			log.Fatalf("save election: %v", err)
+		}
+	} else {
+		if *maxChoices < 0 {
+			log.Fatalf("bad -max-choices %d", *maxChoices)
+		}
+		e := triptych.Election{ID: *electionID, Phase: triptych.PhaseSetup, Revoting: *revoting, MaxChoices: *maxChoices}
+		if *registrarPK != "" {
+			e.RegistrarKey = new(triptych.Point)
+			if err := e.RegistrarKey.UnmarshalText([]byte(*registrarPK)); err != nil {
+				log.Fatalf("bad registrar pk: %v", err)
+			}
+		}
+		for _, w := range []struct {
+			dst *time.Time
+			v   string
+		}{{&e.RegistrationOpens, *regOpens}, {&e.RegistrationCloses, *regCloses}, {&e.VotingOpens, *votingOpens}, {&e.VotingCloses, *votingCloses}} {
+			if w.v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, w.v)
+			if err != nil {
+				log.Fatalf("bad time %q: %v", w.v, err)
+			}
+			*w.dst = t.UTC()
+		}
+		if err := s.store.SaveElection(e); err != nil {
+			log.Fatalf("save election: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("GET /api/signer/challenge", s.handleChallenge)
+	mux.HandleFunc("POST /api/signer", s.handleRegister)
+	mux.HandleFunc("GET /api/registrar/revocations", s.handleRevocations)
+	mux.HandleFunc("POST /api/registrar/revocations", s.handlePublishRevocations)
+	mux.HandleFunc("GET /api/signer/ring", s.handleRing)
+	mux.HandleFunc("POST /api/candidate", s.admin(s.handleAddCandidate))
+	mux.HandleFunc("GET /api/candidate", s.handleCandidates)
+	mux.HandleFunc("GET /api/candidate/results", s.handleResults)
+	mux.HandleFunc("GET /api/election", s.handleElection)
+	mux.HandleFunc("POST /api/election/phase", s.admin(s.handleAdvance))
+	mux.HandleFunc("GET /api/election/ring", s.handleSnapshot)
+	mux.HandleFunc("GET /api/election/manifest", s.handleManifest)
+	mux.HandleFunc("POST /api/election/ring/signature", s.handleRingSignature)
+	mux.HandleFunc("POST /api/bulletin", s.handleSubmit)
+	mux.HandleFunc("POST /api/bulletin/reveal", s.handleReveal)
+	mux.HandleFunc("GET /api/bulletin/commitments", s.handleCommitments)
+	mux.HandleFunc("GET /api/bulletin/ballots", s.handleBallots)
+	mux.HandleFunc("GET /api/bulletin/encrypted", s.handleEncrypted)
+	mux.HandleFunc("GET /api/export", s.handleExport)
+	mux.HandleFunc("GET /api/log/key", s.handleLogKey)
+	mux.HandleFunc("GET /api/log/sth", s.handleTreeHead)
+	mux.HandleFunc("GET /api/log/entries", s.handleLogEntries)
+	mux.HandleFunc("GET /api/log/inclusion", s.handleInclusion)
+	mux.HandleFunc("GET /api/log/consistency", s.handleConsistency)
+
+	log.Printf("board listening on %s (election %q, store %s)", *addr, *electionID, *storeKind)
+	srv := &http.Server{
+		Addr:         *addr,
+		Handler:      mux,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	log.Fatal(srv.ListenAndServe())
+}
+
+func (s *server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var dto SignerCreateDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil || dto.PublicKey == nil || dto.PublicKey.IsIdentity() {
+		writeError(w, http.StatusBadRequest, "bad signer")
+		return
+	}
+	s.phaseMu.RLock()
+	defer s.phaseMu.RUnlock()
+	e := s.store.Election()
+	if err := e.CanRegister(time.Now()); err != nil {
+		writeError(w, http.StatusForbidden, "registration: "+err.Error())
+		return
+	}
+	if !s.challenges.consume(dto.Nonce, time.Now()) {
+		writeError(w, http.StatusBadRequest, "unknown or expired registration nonce")
+		return
+	}
+	if err := triptych.VerifyPossession(dto.PublicKey, e.ID, dto.FullName, []byte(dto.Nonce), dto.Proof); err != nil {
+		log.Printf("[signer] rejected %q: %v", dto.FullName, err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	pk, _ := dto.PublicKey.MarshalText()
+	sg := Signer{FullName: dto.FullName, PublicKey: string(pk), Credential: dto.Credential, Token: dto.Token}
+	switch err := checkCredential(e, sg, dto.PublicKey, s.store.Revocations()); {
+	case errors.Is(err, triptych.ErrRevoked):
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	case err != nil:
+		log.Printf("[signer] rejected %q: %v", dto.FullName, err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.store.AddSigner(sg); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	log.Printf("[signer] registered %q", dto.FullName)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleRing returns the frozen snapshot once there is one. Before that it
+// returns the largest power-of-two subset of eligible registered keys, in
+// random order, like the Java service did.
+func (s *server) handleRing(w http.ResponseWriter, r *http.Request) {
+	if snap := s.store.Election().Ring; snap != nil {
+		keys := make([]string, len(snap.Keys))
+		for i, p := range snap.Keys {
+			b, _ := p.MarshalText()
+			keys[i] = string(b)
+		}
+		writeJSON(w, http.StatusOK, RingDTO{PublicKeys: keys, RingSize: len(keys), Exp: snap.M(), Base: 2, RingID: snap.ID, Digest: &snap.Digest})
+		return
+	}
+	eligible, err := s.eligibleKeys()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "stored signer key is corrupt")
+		return
+	}
+	count, exp := 1, 0
+	if len(eligible) > 0 {
+		exp = bits.Len(uint(len(eligible))) - 1
+		count = 1 << uint(exp)
+	}
+	keys := make([]string, len(eligible))
+	for i, p := range eligible {
+		b, _ := p.MarshalText()
+		keys[i] = string(b)
+	}
+	mrand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	if len(keys) > count {
+		keys = keys[:count]
+	}
+	writeJSON(w, http.StatusOK, RingDTO{PublicKeys: keys, RingSize: count, Exp: exp, Base: 2})
+}
+
+// handleAddCandidate is open only until the ring is frozen: encrypted
+// ballots carry one ciphertext per candidate, so the list must not change
+// once voting can start.
+func (s *server) handleAddCandidate(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("candidateName")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "candidateName required")
+		return
+	}
+	s.phaseMu.RLock()
+	defer s.phaseMu.RUnlock()
+	if p := s.store.Election().Phase; p != triptych.PhaseSetup && p != triptych.PhaseRegistration {
+		writeError(w, http.StatusForbidden, "candidates are fixed: "+triptych.ErrWrongPhase.Error())
+		return
+	}
+	c := Candidate{ID: newUUID(), Fullname: name}
+	if err := s.store.AddCandidate(c); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *server) handleCandidates(w http.ResponseWriter, r *http.Request) {
+	cands := s.store.Candidates()
+	if cands == nil {
+		cands = []Candidate{}
+	}
+	writeJSON(w, http.StatusOK, cands)
+}
+
+// handleResults counts the current plurality ballots and revealed
+// commitments; other ballot types are counted with the tally command.
+func (s *server) handleResults(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.results(s.store.Bulletins()))
+}
+
+func (s *server) results(bulletins []Bulletin) []CandidateResultDTO {
+	votes := map[string]int{}
+	for _, b := range current(bulletins) {
+		if b.CandidateID != "" {
+			votes[b.CandidateID]++
+		}
+	}
+	out := []CandidateResultDTO{}
+	for _, c := range s.store.Candidates() {
+		out = append(out, CandidateResultDTO{ID: c.ID, Fullname: c.Fullname, Votes: votes[c.ID]})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Votes > out[j].Votes })
+	return out
+}
+
+// current keeps the bulletin that counts for every key image: the last one
+// in the log. Without revoting the store never holds more than one.
+func current(bulletins []Bulletin) []Bulletin {
+	last := make(map[string]int, len(bulletins))
+	for i, b := range bulletins {
+		last[b.UNumber] = i
+	}
+	out := make([]Bulletin, 0, len(last))
+	for i, b := range bulletins {
+		if last[b.UNumber] == i {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func (s *server) handleElection(w http.ResponseWriter, r *http.Request) {
+	e := s.store.Election()
+	dto := ElectionDTO{
+		ID:                 e.ID,
+		PublicKey:          s.electionPK,
+		Phase:              e.Phase,
+		RegistrationOpens:  e.RegistrationOpens,
+		RegistrationCloses: e.RegistrationCloses,
+		VotingOpens:        e.VotingOpens,
+		VotingCloses:       e.VotingCloses,
+		Revoting:           e.Revoting,
+		MaxChoices:         e.MaxChoices,
+	}
+	if e.Ring != nil {
+		dto.RingID, dto.RingDigest = e.Ring.ID, &e.Ring.Digest
+	}
+	if e.Manifest != nil {
+		dto.AuthorityKey = e.Manifest.AuthorityKey
+	}
+	dto.RegistrarKey = e.RegistrarKey
+	writeJSON(w, http.StatusOK, dto)
+}
+
+// handleAdvance moves the election one phase forward. Moving to frozen
+// snapshots the registered keys.
+func (s *server) handleAdvance(w http.ResponseWriter, r *http.Request) {
+	var dto PhaseDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+	to, err := triptych.ParseElectionPhase(string(dto.Phase))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.phaseMu.Lock()
+	defer s.phaseMu.Unlock()
+	e := s.store.Election()
+	var snap *triptych.RingSnapshot
+	if to == triptych.PhaseFrozen {
+		keys, err := s.eligibleKeys()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "stored signer key is corrupt")
+			return
+		}
+		if n := len(s.store.Signers()); n != len(keys) {
+			log.Printf("[ring] %d of %d registered keys left out: no valid credential", n-len(keys), n)
+		}
+		if snap, err = triptych.FreezeRing(keys, time.Now()); err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+	}
+	if err := e.Advance(to, snap); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err := s.store.SaveElection(*e); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	log.Printf("[election] %q is now %s", e.ID, e.Phase)
+	s.handleElection(w, r)
+}
+
+func (s *server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	snap := s.store.Election().Ring
+	if snap == nil {
+		writeError(w, http.StatusNotFound, "ring is not frozen yet")
+		return
+	}
+	writeJSON(w, http.StatusOK, snap)
+}
+
+func (s *server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var dto BulletinCreateDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+	s.phaseMu.RLock()
+	defer s.phaseMu.RUnlock()
+	if err := s.resolveRing(&dto); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	ballot, uNum, err := s.verifyBulletin(dto)
+	if err != nil {
+		log.Printf("[bulletin] rejected: %v", err)
+		writeStoreError(w, err)
+		return
+	}
+
+	b := Bulletin{
+		UNumber:      uNum,
+		SignatureB64: dto.SignatureB64,
+		BallotB64:    dto.BallotB64,
+		Type:         ballot.Type.String(),
+		Seq:          ballot.Seq,
+		N:            dto.N,
+		M:            dto.M,
+		AcceptedAt:   time.Now().UTC(),
+	}
+	for _, p := range dto.Ring {
+		pk, _ := p.MarshalText()
+		b.Ring = append(b.Ring, string(pk))
+	}
+	switch ballot.Type {
+	case triptych.BallotPlurality:
+		if !s.hasCandidate(ballot.Choices[0].Candidate) {
+			writeError(w, http.StatusNotFound, "candidate not found")
+			return
+		}
+		b.CandidateID = ballot.Choices[0].Candidate
+	case triptych.BallotEncrypted:
+		b.EncryptedBallot = base64.StdEncoding.EncodeToString(ballot.Payload)
+	case triptych.BallotCommitment:
+		b.Commitment = hex.EncodeToString(ballot.Payload)
+	}
+	entry, err := s.store.AddBulletin(b)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	rc, err := s.receipt(entry)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	log.Printf("[bulletin] accepted %s ballot uNum=%s seq=%d log=%d (%.3fs)", b.Type, uNum, b.Seq, entry.Index, time.Since(start).Seconds())
+	writeJSON(w, http.StatusOK, rc)
+}
+
+func (s *server) hasCandidate(id string) bool {
+	for _, c := range s.store.Candidates() {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// handleReveal accepts openings of committed ballots once voting is closed.
+func (s *server) handleReveal(w http.ResponseWriter, r *http.Request) {
+	if s.store.Election().Phase != triptych.PhaseClosed {
+		writeError(w, http.StatusForbidden, "reveal phase is not open")
+		return
+	}
+	var rv triptych.Reveal
+	if err := json.NewDecoder(r.Body).Decode(&rv); err != nil || rv.KeyImage == nil || rv.Opening == nil || rv.Proof == nil {
+		writeError(w, http.StatusBadRequest, "bad reveal")
+		return
+	}
+	uNum := hex.EncodeToString(rv.KeyImage.BytesCompressed())
+	// Only the voter's current ballot can be revealed; a commitment that a
+	// revote superseded stays closed.
+	var commitment *triptych.Point
+	for _, b := range current(s.store.Bulletins()) {
+		if b.UNumber == uNum && b.Commitment != "" {
+			commitment = new(triptych.Point)
+			if err := commitment.UnmarshalText([]byte(b.Commitment)); err != nil {
+				writeError(w, http.StatusInternalServerError, "stored commitment is corrupt")
+				return
+			}
+		}
+	}
+	if commitment == nil {
+		writeError(w, http.StatusNotFound, "bulletin not found")
+		return
+	}
+	if err := triptych.VerifyReveal(commitment, &rv); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.hasCandidate(rv.CandidateID) {
+		writeError(w, http.StatusNotFound, "candidate not found")
+		return
+	}
+	opening, _ := rv.Opening.MarshalText()
+	proof, _ := rv.Proof.MarshalText()
+	if err := s.store.AddReveal(RevealRecord{UNumber: uNum, CandidateID: rv.CandidateID, Opening: string(opening), Proof: string(proof)}); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	log.Printf("[reveal] uNum=%s candidate=%s", uNum, rv.CandidateID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleCommitments lists only current ballots: a commitment superseded by
+// a revote can no longer be revealed.
+func (s *server) handleCommitments(w http.ResponseWriter, r *http.Request) {
+	out := []CommitmentDTO{}
+	for _, b := range current(s.store.Bulletins()) {
+		if b.Commitment == "" {
+			continue
+		}
+		out = append(out, CommitmentDTO{
+			UNumber:      b.UNumber,
+			SignatureB64: b.SignatureB64,
+			Commitment:   b.Commitment,
+			CandidateID:  b.CandidateID,
+			Opening:      b.Opening,
+			Proof:        b.RevealProof,
+		})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleBallots lists every accepted ballot in log order, superseded ones
+// included; the tally applies the revoting rule itself.
+func (s *server) handleBallots(w http.ResponseWriter, r *http.Request) {
+	out := []BallotEntryDTO{}
+	for _, b := range s.store.Bulletins() {
+		out = append(out, BallotEntryDTO{UNumber: b.UNumber, BallotB64: b.BallotB64})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// BoardExport is everything an auditor needs to re-check the election
+// without trusting the board.
+type BoardExport struct {
+	Election   *triptych.Election      `json:"election"`
+	ElectionPK *triptych.Point         `json:"electionPublicKey,omitempty"`
+	Candidates []Candidate             `json:"candidates"`
+	Bulletins  []Bulletin              `json:"bulletins"`
+	TreeHead   triptych.SignedTreeHead `json:"treeHead"`
+	LogKey     *triptych.Point         `json:"logKey"`
+	Results    []CandidateResultDTO    `json:"results"`
+	ExportedAt time.Time               `json:"exportedAt"`
+}
+
+func (s *server) handleExport(w http.ResponseWriter, r *http.Request) {
+	// Hold off phase changes and new ballots so the parts agree.
+	s.phaseMu.Lock()
+	defer s.phaseMu.Unlock()
+	exp := BoardExport{
+		Election:   s.store.Election(),
+		ElectionPK: s.electionPK,
+		Candidates: s.store.Candidates(),
+		Bulletins:  s.store.Bulletins(),
+		TreeHead:   s.signedHead(),
+		LogKey:     triptych.ScalarBaseMult(s.logKey),
+		ExportedAt: time.Now().UTC(),
+	}
+	exp.Results = s.results(exp.Bulletins)
+	if exp.Candidates == nil {
+		exp.Candidates = []Candidate{}
+	}
+	if exp.Bulletins == nil {
+		exp.Bulletins = []Bulletin{}
+	}
+	writeJSON(w, http.StatusOK, exp)
+}
+
+// handleEncrypted lists only current ballots; the trustees cannot tell
+// which ciphertexts a revote superseded.
+func (s *server) handleEncrypted(w http.ResponseWriter, r *http.Request) {
+	out := []string{}
+	for _, b := range current(s.store.Bulletins()) {
+		if b.EncryptedBallot != "" {
+			out = append(out, b.EncryptedBallot)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	var he *httpError
+	switch {
+	case errors.As(err, &he):
+		writeError(w, he.code, he.msg)
+	case errors.Is(err, ErrDuplicateVote), errors.Is(err, ErrStaleBallot), errors.Is(err, ErrRevealed):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrSignerExists), errors.Is(err, ErrBadRange):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNoBulletin):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		log.Printf("[store] %v", err)
+		writeError(w, http.StatusInternalServerError, "storage error")
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, errorResponse{Status: code, Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
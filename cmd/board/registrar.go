@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// checkCredential is the eligibility rule: with a registrar configured a
+// signer needs a credential for their name and key that is not revoked, or
+// a blind token for the key. Tokens cannot be revoked: nobody knows whose
+// they are.
+func checkCredential(e *triptych.Election, sg Signer, pk *triptych.Point, revoked *triptych.RevocationList) error {
+	switch {
+	case e.RegistrarKey == nil:
+		return nil
+	case sg.Token != nil:
+		return triptych.VerifyEligibility(e.RegistrarKey, e.ID, pk, sg.Token)
+	case sg.Credential == nil:
+		return triptych.ErrBadCredential
+	}
+	return sg.Credential.Check(e.RegistrarKey, e.ID, sg.FullName, pk, revoked)
+}
+
+// eligibleKeys returns the registered keys that may go into the ring.
+func (s *server) eligibleKeys() ([]*triptych.Point, error) {
+	e := s.store.Election()
+	revoked := s.store.Revocations()
+	var keys []*triptych.Point
+	for _, sg := range s.store.Signers() {
+		p := new(triptych.Point)
+		if err := p.UnmarshalText([]byte(sg.PublicKey)); err != nil {
+			return nil, err
+		}
+		if checkCredential(e, sg, p, revoked) == nil {
+			keys = append(keys, p)
+		}
+	}
+	return keys, nil
+}
+
+func (s *server) handleRevocations(w http.ResponseWriter, r *http.Request) {
+	l := s.store.Revocations()
+	if l == nil {
+		writeError(w, http.StatusNotFound, "no revocation list")
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+// handlePublishRevocations replaces the revocation list with a newer one
+// signed by the registrar. Keys frozen into the ring stay there.
+func (s *server) handlePublishRevocations(w http.ResponseWriter, r *http.Request) {
+	var l triptych.RevocationList
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+	s.phaseMu.Lock()
+	defer s.phaseMu.Unlock()
+	e := s.store.Election()
+	if e.RegistrarKey == nil {
+		writeError(w, http.StatusConflict, "election has no registrar")
+		return
+	}
+	if l.ElectionID != e.ID || l.Verify(e.RegistrarKey) != nil {
+		writeError(w, http.StatusBadRequest, triptych.ErrBadRevocations.Error())
+		return
+	}
+	if cur := s.store.Revocations(); cur != nil && !l.IssuedAt.After(cur.IssuedAt) {
+		writeError(w, http.StatusConflict, "revocation list is not newer than the current one")
+		return
+	}
+	if err := s.store.SaveRevocations(l); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	log.Printf("[registrar] revocation list of %s: %d serials", l.IssuedAt.Format(time.RFC3339), len(l.Serials))
+	w.WriteHeader(http.StatusOK)
+}
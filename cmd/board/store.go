@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// Store persists the board. Implementations must make AddBulletin atomic
+// with respect to the key-image check, since that check is what stops
+// double voting. When the election allows revoting a key image may appear
+// again, but only with a higher ballot Seq than its previous bulletin.
+type Store interface {
+	AddSigner(s Signer) error
+	Signers() []Signer
+	AddCandidate(c Candidate) error
+	Candidates() []Candidate
+	AddBulletin(b Bulletin) (triptych.LogEntry, error)
+	AddReveal(r RevealRecord) error
+	Bulletins() []Bulletin
+	// TreeHead returns the log size, its Merkle root and the chain head.
+	TreeHead() (size uint64, root, head triptych.Hash)
+	LogEntries(start, end uint64) ([]triptych.LogEntry, error)
+	InclusionProof(index, size uint64) ([]triptych.Hash, error)
+	ConsistencyProof(first, second uint64) ([]triptych.Hash, error)
+	// Election is nil until the first SaveElection.
+	Election() *triptych.Election
+	SaveElection(e triptych.Election) error
+	// Revocations is nil until the registrar publishes a list.
+	Revocations() *triptych.RevocationList
+	SaveRevocations(l triptych.RevocationList) error
+	Close() error
+}
+
+// Signer keeps the registrar's credential, if any, so revocations published
+// after registration still keep the key out of the frozen ring. Anonymous
+// signers have a blind eligibility token instead and no name.
+type Signer struct {
+	FullName   string                   `json:"fullName"`
+	PublicKey  string                   `json:"publicKey"`
+	Credential *triptych.Credential     `json:"credential,omitempty"`
+	Token      *triptych.BlindSignature `json:"token,omitempty"`
+}
+
+type Candidate struct {
+	ID       string `json:"id"`
+	Fullname string `json:"fullname"`
+}
+
+// Bulletin is one accepted ballot; with revoting a key image may have
+// several, and the latest one counts. CandidateID is set for plurality
+// ballots and filled in later for revealed commitments. LogIndex and
+// PrevHead place the bulletin in the ballot log; the store sets them. Ring
+// is the key order the signature was made over, kept for auditors.
+type Bulletin struct {
+	UNumber         string        `json:"uNumber"`
+	SignatureB64    string        `json:"signatureB64"`
+	BallotB64       string        `json:"ballotB64"`
+	Type            string        `json:"type"`
+	Seq             uint32        `json:"seq,omitempty"`
+	CandidateID     string        `json:"candidateId,omitempty"`
+	EncryptedBallot string        `json:"encryptedBallot,omitempty"`
+	Commitment      string        `json:"commitment,omitempty"`
+	Opening         string        `json:"opening,omitempty"`
+	RevealProof     string        `json:"revealProof,omitempty"`
+	Ring            []string      `json:"ring,omitempty"`
+	N               int           `json:"n,omitempty"`
+	M               int           `json:"m,omitempty"`
+	AcceptedAt      time.Time     `json:"acceptedAt"`
+	LogIndex        uint64        `json:"logIndex"`
+	PrevHead        triptych.Hash `json:"prevHead"`
+}
+
+type RevealRecord struct {
+	UNumber     string `json:"uNumber"`
+	CandidateID string `json:"candidateId"`
+	Opening     string `json:"opening"`
+	Proof       string `json:"proof"`
+}
+
+var (
+	ErrSignerExists  = errors.New("signer already exists")
+	ErrDuplicateVote = errors.New("duplicate vote")
+	ErrStaleBallot   = errors.New("ballot sequence number must exceed the previous ballot's")
+	ErrNoBulletin    = errors.New("bulletin not found")
+	ErrRevealed      = errors.New("already revealed")
+)
+
+// memStore keeps everything in memory; it is also the index behind fileStore.
+type memStore struct {
+	mu         sync.RWMutex
+	signers    []Signer
+	signerKeys map[string]bool
+	candidates []Candidate
+	bulletins  []Bulletin
+	// byUNumber points at the latest bulletin for each key image
+	byUNumber   map[string]int
+	log         ballotLog
+	election    *triptych.Election
+	revocations *triptych.RevocationList
+}
+
+func newMemStore() *memStore {
+	return &memStore{signerKeys: map[string]bool{}, byUNumber: map[string]int{}}
+}
+
+func (s *memStore) AddSigner(sg Signer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addSigner(sg)
+}
+
+func (s *memStore) addSigner(sg Signer) error {
+	if s.signerKeys[sg.PublicKey] {
+		return ErrSignerExists
+	}
+	s.signerKeys[sg.PublicKey] = true
+	s.signers = append(s.signers, sg)
+	return nil
+}
+
+func (s *memStore) Signers() []Signer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Signer(nil), s.signers...)
+}
+
+func (s *memStore) AddCandidate(c Candidate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.candidates = append(s.candidates, c)
+	return nil
+}
+
+func (s *memStore) Candidates() []Candidate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Candidate(nil), s.candidates...)
+}
+
+func (s *memStore) AddBulletin(b Bulletin) (triptych.LogEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log.stamp(&b)
+	if err := s.addBulletin(b); err != nil {
+		return triptych.LogEntry{}, err
+	}
+	return bulletinEntry(b)
+}
+
+// checkRevote allows a second bulletin for a key image only as a revote
+// that supersedes the previous one.
+func (s *memStore) checkRevote(b Bulletin) error {
+	i, ok := s.byUNumber[b.UNumber]
+	switch {
+	case !ok:
+		return nil
+	case s.election == nil || !s.election.Revoting:
+		return ErrDuplicateVote
+	case b.Seq <= s.bulletins[i].Seq:
+		return ErrStaleBallot
+	}
+	return nil
+}
+
+func (s *memStore) addBulletin(b Bulletin) error {
+	if err := s.checkRevote(b); err != nil {
+		return err
+	}
+	e, err := bulletinEntry(b)
+	if err != nil {
+		return err
+	}
+	if err := s.log.append(e); err != nil {
+		return err
+	}
+	s.byUNumber[b.UNumber] = len(s.bulletins)
+	s.bulletins = append(s.bulletins, b)
+	return nil
+}
+
+func (s *memStore) AddReveal(r RevealRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addReveal(r)
+}
+
+func (s *memStore) addReveal(r RevealRecord) error {
+	i, ok := s.byUNumber[r.UNumber]
+	if !ok {
+		return ErrNoBulletin
+	}
+	b := &s.bulletins[i]
+	if b.Commitment == "" {
+		return ErrNoBulletin
+	}
+	if b.Opening != "" {
+		return ErrRevealed
+	}
+	b.CandidateID, b.Opening, b.RevealProof = r.CandidateID, r.Opening, r.Proof
+	return nil
+}
+
+func (s *memStore) Bulletins() []Bulletin {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Bulletin(nil), s.bulletins...)
+}
+
+func (s *memStore) TreeHead() (uint64, triptych.Hash, triptych.Hash) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return uint64(len(s.log.leaves)), triptych.MerkleRoot(s.log.leaves), s.log.head
+}
+
+func (s *memStore) LogEntries(start, end uint64) ([]triptych.LogEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if start > end || end > uint64(len(s.bulletins)) {
+		return nil, ErrBadRange
+	}
+	out := make([]triptych.LogEntry, 0, end-start)
+	for _, b := range s.bulletins[start:end] {
+		e, err := bulletinEntry(b)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (s *memStore) InclusionProof(index, size uint64) ([]triptych.Hash, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.log.inclusion(index, size)
+}
+
+func (s *memStore) ConsistencyProof(first, second uint64) ([]triptych.Hash, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.log.consistency(first, second)
+}
+
+func (s *memStore) Election() *triptych.Election {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.election == nil {
+		return nil
+	}
+	e := *s.election
+	return &e
+}
+
+func (s *memStore) SaveElection(e triptych.Election) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.election = &e
+	return nil
+}
+
+func (s *memStore) Revocations() *triptych.RevocationList {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.revocations
+}
+
+func (s *memStore) SaveRevocations(l triptych.RevocationList) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revocations = &l
+	return nil
+}
+
+func (s *memStore) Close() error { return nil }
+
+// fileStore appends every change as one JSON line and replays the file on
+// start. Records are never rewritten, so the file doubles as an audit log.
+type fileStore struct {
+	*memStore
+	f *os.File
+}
+
+type storeRecord struct {
+	Kind      string             `json:"kind"`
+	Signer    *Signer            `json:"signer,omitempty"`
+	Candidate *Candidate         `json:"candidate,omitempty"`
+	Bulletin  *Bulletin          `json:"bulletin,omitempty"`
+	Reveal    *RevealRecord      `json:"reveal,omitempty"`
+	Election  *triptych.Election `json:"election,omitempty"`
+	// Revocations is the registrar's latest revocation list.
+	Revocations *triptych.RevocationList `json:"revocations,omitempty"`
+}
+
+func openFileStore(path string) (*fileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileStore{memStore: newMemStore(), f: f}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		var rec storeRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if err := s.apply(rec); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileStore) apply(rec storeRecord) error {
+	switch {
+	case rec.Kind == "signer" && rec.Signer != nil:
+		return s.addSigner(*rec.Signer)
+	case rec.Kind == "candidate" && rec.Candidate != nil:
+		s.candidates = append(s.candidates, *rec.Candidate)
+		return nil
+	case rec.Kind == "bulletin" && rec.Bulletin != nil:
+		return s.addBulletin(*rec.Bulletin)
+	case rec.Kind == "reveal" && rec.Reveal != nil:
+		return s.addReveal(*rec.Reveal)
+	case rec.Kind == "election" && rec.Election != nil:
+		s.election = rec.Election
+		return nil
+	case rec.Kind == "revocations" && rec.Revocations != nil:
+		s.revocations = rec.Revocations
+		return nil
+	}
+	return fmt.Errorf("bad record kind %q", rec.Kind)
+}
+
+// commit validates rec against the in-memory state, then appends and syncs
+// it before the change becomes visible. Bulletins are stamped with their
+// log position first, so the file itself carries the hash chain.
+func (s *fileStore) commit(rec storeRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec.Kind == "bulletin" {
+		s.log.stamp(rec.Bulletin)
+	}
+	if err := s.check(rec); err != nil {
+		return err
+	}
+	b, _ := json.Marshal(rec)
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	return s.apply(rec)
+}
+
+func (s *fileStore) check(rec storeRecord) error {
+	switch rec.Kind {
+	case "signer":
+		if s.signerKeys[rec.Signer.PublicKey] {
+			return ErrSignerExists
+		}
+	case "bulletin":
+		if err := s.checkRevote(*rec.Bulletin); err != nil {
+			return err
+		}
+		if _, err := bulletinEntry(*rec.Bulletin); err != nil {
+			return err
+		}
+	case "reveal":
+		i, ok := s.byUNumber[rec.Reveal.UNumber]
+		if !ok || s.bulletins[i].Commitment == "" {
+			return ErrNoBulletin
+		}
+		if s.bulletins[i].Opening != "" {
+			return ErrRevealed
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) AddSigner(sg Signer) error {
+	return s.commit(storeRecord{Kind: "signer", Signer: &sg})
+}
+
+func (s *fileStore) AddCandidate(c Candidate) error {
+	return s.commit(storeRecord{Kind: "candidate", Candidate: &c})
+}
+
+func (s *fileStore) AddBulletin(b Bulletin) (triptych.LogEntry, error) {
+	if err := s.commit(storeRecord{Kind: "bulletin", Bulletin: &b}); err != nil {
+		return triptych.LogEntry{}, err
+	}
+	return bulletinEntry(b)
+}
+
+func (s *fileStore) AddReveal(r RevealRecord) error {
+	return s.commit(storeRecord{Kind: "reveal", Reveal: &r})
+}
+
+func (s *fileStore) SaveElection(e triptych.Election) error {
+	return s.commit(storeRecord{Kind: "election", Election: &e})
+}
+
+func (s *fileStore) SaveRevocations(l triptych.RevocationList) error {
+	return s.commit(storeRecord{Kind: "revocations", Revocations: &l})
+}
+
+func (s *fileStore) Close() error { return s.f.Close() }
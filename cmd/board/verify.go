@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// maxRing is the largest ring a bulletin may name, the same as the default
+// -max-ring of verify-http.
+const maxRing = 1 << 20
+
+type httpError struct {
+	code int
+	msg  string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{code: http.StatusBadRequest, msg: fmt.Sprintf(format, args...)}
+}
+
+// resolveRing fills in the frozen ring for a bulletin that names it by
+// digest.
+func (s *server) resolveRing(dto *BulletinCreateDTO) error {
+	if len(dto.Ring) > 0 || dto.RingID == nil {
+		return nil
+	}
+	snap := s.store.Election().Ring
+	if snap == nil || snap.Digest != *dto.RingID {
+		return &httpError{code: http.StatusNotFound, msg: "unknown ring"}
+	}
+	s.canonicalMu.Lock()
+	defer s.canonicalMu.Unlock()
+	if s.canonical == nil {
+		s.canonical = triptych.CanonicalRing(snap.Keys)
+	}
+	dto.Ring = s.canonical
+	return nil
+}
+
+// verifyBulletin does what verify-http does for the Java backend: parse the
+// canonical ballot, bind it to this election and ring, check the encrypted
+// ballot proofs if any, and verify the ring signature over the ballot bytes.
+func (s *server) verifyBulletin(dto BulletinCreateDTO) (*triptych.Ballot, string, error) {
+	if dto.N <= 1 || dto.M <= 0 || len(dto.Ring) == 0 || dto.BallotB64 == "" || dto.SignatureB64 == "" {
+		return nil, "", badRequest("missing fields")
+	}
+	if len(dto.Ring) > maxRing {
+		return nil, "", &httpError{code: http.StatusRequestEntityTooLarge, msg: fmt.Sprintf("ring is over the limit of %d keys", maxRing)}
+	}
+	// N = n^m may not pass the ring length, which bounds the loop for any m
+	// and keeps N from overflowing.
+	N := 1
+	for i := 0; i < dto.M; i++ {
+		if N > len(dto.Ring)/dto.N {
+			return nil, "", badRequest("ring length %d is not n^m", len(dto.Ring))
+		}
+		N *= dto.N
+	}
+	if len(dto.Ring) != N {
+		return nil, "", badRequest("ring length must be n^m=%d", N)
+	}
+	for i, P := range dto.Ring {
+		if P == nil || P.IsIdentity() {
+			return nil, "", badRequest("ring[%d] bad key", i)
+		}
+	}
+	msg, err := base64.StdEncoding.DecodeString(dto.BallotB64)
+	if err != nil {
+		return nil, "", badRequest("bad ballot base64")
+	}
+	ballot, err := triptych.ParseBallot(msg)
+	if err != nil {
+		return nil, "", badRequest("ballot: %v", err)
+	}
+	if err := ballot.CheckContext("", dto.Ring); err != nil {
+		return nil, "", badRequest("%v", err)
+	}
+	// The ring must be the frozen snapshot; that also keeps voters from
+	// building rings out of keys nobody registered.
+	switch err := s.store.Election().CheckBallot(ballot, time.Now()); {
+	case errors.Is(err, triptych.ErrWrongPhase), errors.Is(err, triptych.ErrOutsideWindow):
+		return nil, "", &httpError{code: http.StatusForbidden, msg: "voting is not open: " + err.Error()}
+	case err != nil:
+		return nil, "", badRequest("%v", err)
+	}
+
+	if s.electionPK != nil {
+		if ballot.Type != triptych.BallotEncrypted {
+			return nil, "", badRequest("election requires encrypted ballots")
+		}
+		eb, err := triptych.ParseEncryptedBallot(ballot.Payload)
+		if err != nil {
+			return nil, "", badRequest("ballot: %v", err)
+		}
+		if len(eb.Ciphertexts) != len(s.store.Candidates()) {
+			return nil, "", badRequest("ballot must have %d ciphertexts", len(s.store.Candidates()))
+		}
+		minC, maxC := triptych.ChoiceBounds(s.store.Election().MaxChoices)
+		if err := triptych.VerifyEncryptedBallot(s.electionPK, eb, minC, maxC); err != nil {
+			return nil, "", badRequest("invalid ballot: %v", err)
+		}
+	} else if ballot.Type == triptych.BallotEncrypted {
+		return nil, "", badRequest("encrypted ballots are not enabled")
+	}
+	if ballot.Type == triptych.BallotCommitment {
+		if _, err := triptych.ParseCompressed(ballot.Payload); err != nil {
+			return nil, "", badRequest("bad commitment: %v", err)
+		}
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(dto.SignatureB64)
+	if err != nil || len(blob) < 33 {
+		return nil, "", badRequest("bad signature base64")
+	}
+	sig, err := triptych.Deserialize(blob[33:], dto.M, dto.N, blob[:33])
+	if err != nil {
+		return nil, "", badRequest("deserialize: %v", err)
+	}
+	ok, uNum := triptych.VerifyTriptych(sig, msg, dto.Ring, dto.N, dto.M)
+	if !ok {
+		return nil, "", badRequest("invalid signature")
+	}
+	return ballot, hex.EncodeToString(uNum), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// tokenFile is a blind eligibility token with what it certifies. It does
+// not name the voter.
+type tokenFile struct {
+	ElectionID string                   `json:"electionId"`
+	PublicKey  *triptych.Point          `json:"publicKey"`
+	Token      *triptych.BlindSignature `json:"token"`
+}
+
+type blindSessionDTO struct {
+	SessionID    string          `json:"sessionId"`
+	R            *triptych.Point `json:"r"`
+	ElectionID   string          `json:"electionId"`
+	RegistrarKey *triptych.Point `json:"registrarKey"`
+}
+
+type blindSignDTO struct {
+	S *triptych.Scalar `json:"s"`
+}
+
+// fetchToken authenticates to the registrar and has it blindly sign pk.
+// The registrar learns the name but not the key.
+func fetchToken(registrarURL, fullName, code string, pk *triptych.Point) (*tokenFile, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	base := strings.TrimRight(registrarURL, "/") + "/api/blind"
+
+	var sess blindSessionDTO
+	if err := postJSON(client, base+"/session", map[string]string{"fullName": fullName, "code": code}, &sess); err != nil {
+		return nil, err
+	}
+	if sess.R.IsIdentity() || sess.RegistrarKey.IsIdentity() {
+		return nil, fmt.Errorf("bad session from registrar")
+	}
+	msg := triptych.EligibilityMessage(sess.ElectionID, pk)
+	blinder, c := triptych.Blind(sess.RegistrarKey, sess.R, msg)
+
+	var res blindSignDTO
+	if err := postJSON(client, base+"/sign", map[string]interface{}{"sessionId": sess.SessionID, "challenge": c}, &res); err != nil {
+		return nil, err
+	}
+	sig, err := blinder.Unblind(res.S)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenFile{ElectionID: sess.ElectionID, PublicKey: pk, Token: sig}, nil
+}
+
+func postJSON(client *http.Client, url string, body, out interface{}) error {
+	b, _ := json.Marshal(body)
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%s: HTTP %d %s", url, resp.StatusCode, e.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -17,53 +16,166 @@ import (
 )
 
 type signerCreateDTO struct {
-	FullName  string `json:"fullName"`
-	PublicKey string `json:"publicKey"`
+	FullName  string                     `json:"fullName"`
+	PublicKey *triptych.Point            `json:"publicKey"`
+	Nonce     string                     `json:"nonce"`
+	Proof     *triptych.SchnorrSignature `json:"proof"`
+	// Credential is the registrar's certificate, for elections that have one.
+	Credential *triptych.Credential `json:"credential,omitempty"`
+	// Token replaces the name and credential in an anonymous registration.
+	Token *triptych.BlindSignature `json:"token,omitempty"`
+}
+
+type challengeDTO struct {
+	ElectionID string `json:"electionId"`
+	Nonce      string `json:"nonce"`
 }
 
 type keypairFile struct {
-	FullName  string `json:"fullName"`
-	PublicKey string `json:"publicKey"`
-	SecretKey string `json:"secretKey"`
-	CreatedAt string `json:"createdAt"`
+	FullName  string           `json:"fullName"`
+	PublicKey *triptych.Point  `json:"publicKey"`
+	SecretKey *triptych.Scalar `json:"secretKey"`
+	CreatedAt string           `json:"createdAt"`
 }
 
 func main() {
 
 	outPath := flag.String("out", "", "путь к файлу для сохранения пары ключей (по умолчанию: <name>-key.json)")
+	keysPath := flag.String("keys", "", "зарегистрировать уже созданную пару ключей из этого файла вместо новой")
+	credPath := flag.String("credential", "", "удостоверение регистратора (JSON из registrar issue), если выборы его требуют")
+	registrarURL := flag.String("registrar", "", "базовый URL регистратора (registrar serve): получить слепой токен и зарегистрироваться анонимно")
+	code := flag.String("code", "", "код доступа, выданный регистратором")
+	tokenPath := flag.String("token", "", "ранее полученный слепой токен: зарегистрироваться анонимно")
 	flag.Parse()
 
 	args := flag.Args()
-	if len(args) < 2 {
-		fmt.Println("usage: keygen [-out file.json] <fullName> <baseURL>")
+	if len(args) < 1 {
+		fmt.Println("usage: keygen [-out file.json] <fullName> [baseURL]")
+		fmt.Println("       keygen -keys file.json [-credential credential.json] <fullName> <baseURL>")
+		fmt.Println("       keygen [-keys file.json] -registrar URL -code CODE <fullName> [baseURL]")
+		fmt.Println("       keygen -keys file.json -token token.json <fullName> <baseURL>")
 		fmt.Println("example: keygen \"Alice Smith\" http://localhost:8080")
+		fmt.Println("without baseURL the key is only generated, e.g. to get a registrar credential first")
+		fmt.Println("with a blind token the name goes only to the registrar; the board gets the key and the token")
 		os.Exit(2)
 	}
 	fullName := args[0]
-	baseURL := args[1]
-
-	sk, pk := triptych.GenerateKey()
-	pkHex := hex.EncodeToString(pk.BytesCompressed())
-	skHex := hex.EncodeToString(sk)
 
-	fileName := *outPath
-	if fileName == "" {
-		fileName = defaultFileName(fullName)
+	var sk *triptych.Scalar
+	if *keysPath != "" {
+		var kf keypairFile
+		b, err := os.ReadFile(*keysPath)
+		if err == nil {
+			err = json.Unmarshal(b, &kf)
+		}
+		if err != nil || kf.SecretKey == nil {
+			fmt.Fprintf(os.Stderr, "failed to read key file: %v\n", err)
+			os.Exit(1)
+		}
+		sk = kf.SecretKey
+	} else {
+		sk = triptych.RandomScalar()
+		fileName := *outPath
+		if fileName == "" {
+			fileName = defaultFileName(fullName)
+		}
+		kf := keypairFile{
+			FullName:  fullName,
+			PublicKey: triptych.ScalarBaseMult(sk),
+			SecretKey: sk,
+			CreatedAt: time.Now().Format(time.RFC3339),
+		}
+		if err := writeKeyFile(fileName, kf); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write key file: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Keypair saved to %s\n", fileName)
 	}
-	kf := keypairFile{
-		FullName:  fullName,
-		PublicKey: pkHex,
-		SecretKey: skHex,
-		CreatedAt: time.Now().Format(time.RFC3339),
+	pk := triptych.ScalarBaseMult(sk)
+
+	var token *tokenFile
+	switch {
+	case *registrarURL != "":
+		t, err := fetchToken(*registrarURL, fullName, *code, pk)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "blind token: %v\n", err)
+			os.Exit(1)
+		}
+		name := strings.TrimSuffix(defaultFileName(fullName), "-key.json") + "-token.json"
+		b, _ := json.MarshalIndent(t, "", "  ")
+		if err := os.WriteFile(name, b, 0o600); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write token: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Eligibility token saved to %s\n", name)
+		token = t
+	case *tokenPath != "":
+		token = new(tokenFile)
+		b, err := os.ReadFile(*tokenPath)
+		if err == nil {
+			err = json.Unmarshal(b, token)
+		}
+		if err != nil || token.Token == nil {
+			fmt.Fprintf(os.Stderr, "failed to read token: %v\n", err)
+			os.Exit(1)
+		}
+		if !token.PublicKey.Equal(pk) {
+			fmt.Fprintln(os.Stderr, "token was issued for another key")
+			os.Exit(1)
+		}
 	}
-	if err := writeKeyFile(fileName, kf); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to write key file: %v\n", err)
-		os.Exit(1)
+
+	if len(args) < 2 {
+		if token == nil {
+			pkHex, _ := pk.MarshalText()
+			fmt.Printf("Public key (for the registrar): %s\n", pkHex)
+		}
+		return
 	}
-	fmt.Printf("Keypair saved to %s\n", fileName)
+	baseURL := args[1]
 
+	var cred *triptych.Credential
+	if *credPath != "" {
+		cred = new(triptych.Credential)
+		b, err := os.ReadFile(*credPath)
+		if err == nil {
+			err = json.Unmarshal(b, cred)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read credential: %v\n", err)
+			os.Exit(1)
+		}
+		if cred.FullName != fullName || !cred.PublicKey.Equal(pk) {
+			fmt.Fprintln(os.Stderr, "credential was issued for another name or key")
+			os.Exit(1)
+		}
+	}
+
+	// The server only accepts a key together with a proof that we hold its
+	// secret, bound to our name, the election and a fresh nonce.
+	client := &http.Client{Timeout: 10 * time.Second}
 	registerURL := strings.TrimRight(baseURL, "/") + "/api/signer"
-	payload := signerCreateDTO{FullName: fullName, PublicKey: pkHex}
+	var ch challengeDTO
+	chResp, err := client.Get(registerURL + "/challenge")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "challenge request failed: %v\n", err)
+		os.Exit(1)
+	}
+	err = json.NewDecoder(chResp.Body).Decode(&ch)
+	chResp.Body.Close()
+	if chResp.StatusCode != http.StatusOK || err != nil || ch.Nonce == "" {
+		fmt.Fprintf(os.Stderr, "challenge failed: HTTP %d\n", chResp.StatusCode)
+		os.Exit(1)
+	}
+	payload := signerCreateDTO{FullName: fullName, PublicKey: pk, Nonce: ch.Nonce, Credential: cred}
+	if token != nil {
+		if token.ElectionID != ch.ElectionID {
+			fmt.Fprintf(os.Stderr, "token is for election %q, the server runs %q\n", token.ElectionID, ch.ElectionID)
+			os.Exit(1)
+		}
+		payload = signerCreateDTO{PublicKey: pk, Nonce: ch.Nonce, Token: token.Token}
+	}
+	payload.Proof = triptych.ProvePossession(sk, ch.ElectionID, payload.FullName, []byte(ch.Nonce))
 	body, _ := json.Marshal(payload)
 
 	req, err := http.NewRequest(http.MethodPost, registerURL, bytes.NewReader(body))
@@ -73,7 +185,6 @@ func main() {
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "registration request failed: %v\n", err)
@@ -12,12 +12,15 @@ import (
 )
 
 type BenchConfig struct {
-	Base    int    `json:"base"`
-	MinExp  int    `json:"min_exp"`
-	MaxExp  int    `json:"max_exp"`
-	Trials  int    `json:"trials"`
-	Message string `json:"message"`
-	OutPath string `json:"out_path"`
+	Mode        string `json:"mode"`
+	Base        int    `json:"base"`
+	MinExp      int    `json:"min_exp"`
+	MaxExp      int    `json:"max_exp"`
+	Trials      int    `json:"trials"`
+	Message     string `json:"message"`
+	OutPath     string `json:"out_path"`
+	RangeBits   int    `json:"range_bits,omitempty"`
+	RangeMaxAgg int    `json:"range_max_agg,omitempty"`
 }
 
 type TrialResult struct {
@@ -50,10 +53,12 @@ type Aggregate struct {
 }
 
 type BenchOutput struct {
-	Config    BenchConfig   `json:"config"`
-	Timestamp string        `json:"timestamp"`
-	Results   []Aggregate   `json:"results"`
-	Trials    []TrialResult `json:"trials"`
+	Config       BenchConfig        `json:"config"`
+	Timestamp    string             `json:"timestamp"`
+	Results      []Aggregate        `json:"results"`
+	Trials       []TrialResult      `json:"trials"`
+	RangeResults []RangeAggregate   `json:"range_results,omitempty"`
+	RangeTrials  []RangeTrialResult `json:"range_trials,omitempty"`
 }
 
 func powInt(base, exp int) int {
@@ -122,9 +127,13 @@ func main() {
 	maxExp := flag.Int("max-exp", 15, "максимальная степень exp (размер кольца = 2^exp)")
 	trials := flag.Int("trials", 1, "число повторов на каждую конфигурацию")
 	msg := flag.String("msg", "d2c51a8e-344d-4f76-8458-119e4fb077a", "сообщение для подписи")
+	mode := flag.String("mode", "triptych", "что измерять: triptych (подписи) или range (Bulletproofs)")
+	rangeBits := flag.Int("range-bits", 64, "разрядность диапазона для range proof (8, 16, 32, 64)")
+	rangeMaxAgg := flag.Int("range-max-agg", 8, "максимальное число агрегированных значений (степень двойки)")
 	flag.Parse()
 
 	cfg := BenchConfig{
+		Mode:    *mode,
 		Base:    2,
 		MinExp:  1,
 		MaxExp:  *maxExp,
@@ -133,6 +142,30 @@ func main() {
 		OutPath: *outPath,
 	}
 
+	if cfg.Mode == "range" {
+		if err := checkRangeFlags(*rangeBits, *rangeMaxAgg); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if cfg.Trials <= 0 {
+			log.Fatalf("trials must be > 0")
+		}
+		cfg.RangeBits = *rangeBits
+		cfg.RangeMaxAgg = *rangeMaxAgg
+		log.Printf("Bulletproofs benchmark starting...")
+		aggs, trialsOut := runRangeBench(cfg.RangeBits, cfg.RangeMaxAgg, cfg.Trials)
+		writeOutput(cfg.OutPath, BenchOutput{
+			Config:       cfg,
+			Timestamp:    time.Now().Format(time.RFC3339),
+			RangeResults: aggs,
+			RangeTrials:  trialsOut,
+		})
+		log.Printf("Done.")
+		return
+	}
+	if cfg.Mode != "triptych" {
+		log.Fatalf("unknown mode %q", cfg.Mode)
+	}
+
 	if cfg.MaxExp < cfg.MinExp {
 		log.Fatalf("max-exp (%d) must be >= min-exp (%d)", cfg.MaxExp, cfg.MinExp)
 	}
@@ -246,20 +279,22 @@ func main() {
 			exp, ringSize, sAvg, sMin, sMax, vAvg, vMin, vMax, vTotAvg, sigAvg, rawAvg, keyImgLen)
 	}
 
-	out := BenchOutput{
+	writeOutput(cfg.OutPath, BenchOutput{
 		Config:    cfg,
 		Timestamp: time.Now().Format(time.RFC3339),
 		Results:   aggs,
 		Trials:    allTrials,
-	}
+	})
+	log.Printf("Done.")
+}
 
+func writeOutput(path string, out BenchOutput) {
 	data, err := json.MarshalIndent(out, "", "  ")
 	if err != nil {
 		log.Fatalf("marshal results: %v", err)
 	}
-	if err := os.WriteFile(cfg.OutPath, data, 0644); err != nil {
-		log.Fatalf("write %s: %v", cfg.OutPath, err)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Fatalf("write %s: %v", path, err)
 	}
-	log.Printf("JSON results saved to %s", cfg.OutPath)
-	log.Printf("Done.")
+	log.Printf("JSON results saved to %s", path)
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+type RangeTrialResult struct {
+	Bits       int     `json:"bits"`
+	Aggregated int     `json:"aggregated"`
+	Trial      int     `json:"trial"`
+	ProveMS    float64 `json:"prove_ms"`
+	VerifyMS   float64 `json:"verify_ms"`
+	ProofBytes int     `json:"proof_bytes"`
+}
+
+type RangeAggregate struct {
+	Bits        int     `json:"bits"`
+	Aggregated  int     `json:"aggregated"`
+	Trials      int     `json:"trials"`
+	ProveAvgMS  float64 `json:"prove_avg_ms"`
+	VerifyAvgMS float64 `json:"verify_avg_ms"`
+	VerifyMinMS float64 `json:"verify_min_ms"`
+	VerifyMaxMS float64 `json:"verify_max_ms"`
+	ProofBytes  int     `json:"proof_bytes"`
+}
+
+func runRangeBench(bits, maxAgg, trials int) ([]RangeAggregate, []RangeTrialResult) {
+	aggs := make([]RangeAggregate, 0)
+	all := make([]RangeTrialResult, 0)
+
+	for agg := 1; agg <= maxAgg; agg *= 2 {
+		proveTimes := make([]float64, 0, trials)
+		verifyTimes := make([]float64, 0, trials)
+		proofLen := 0
+
+		log.Printf("=== range proof: bits=%d, aggregated=%d ===", bits, agg)
+		for t := 1; t <= trials; t++ {
+			values := make([]uint64, agg)
+			blinds := make([]*triptych.Scalar, agg)
+			for i := range values {
+				values[i] = uint64(i*7919+t) & ((1 << uint(bits-1)) - 1)
+				blinds[i] = triptych.RandomScalar()
+			}
+
+			t0 := time.Now()
+			proof, comms, err := triptych.ProveRangeAggregated(values, blinds, bits)
+			if err != nil {
+				log.Fatalf("range prove failed (agg=%d, trial=%d): %v", agg, t, err)
+			}
+			proveDur := time.Since(t0)
+
+			raw := proof.Bytes()
+			t1 := time.Now()
+			parsed, err := triptych.ParseRangeProof(raw)
+			if err != nil {
+				log.Fatalf("range parse failed (agg=%d, trial=%d): %v", agg, t, err)
+			}
+			if !triptych.VerifyRangeAggregated(comms, parsed, bits) {
+				log.Fatalf("range verify failed (agg=%d, trial=%d)", agg, t)
+			}
+			verifyDur := time.Since(t1)
+
+			tr := RangeTrialResult{
+				Bits:       bits,
+				Aggregated: agg,
+				Trial:      t,
+				ProveMS:    float64(proveDur.Microseconds()) / 1000.0,
+				VerifyMS:   float64(verifyDur.Microseconds()) / 1000.0,
+				ProofBytes: len(raw),
+			}
+			all = append(all, tr)
+			proveTimes = append(proveTimes, tr.ProveMS)
+			verifyTimes = append(verifyTimes, tr.VerifyMS)
+			proofLen = len(raw)
+
+			log.Printf("[bits=%d, agg=%d] trial=%d  prove=%.3f ms | verify=%.3f ms | proof=%d bytes",
+				bits, agg, t, tr.ProveMS, tr.VerifyMS, tr.ProofBytes)
+		}
+
+		_, _, pAvg := minMaxAvg(proveTimes)
+		vMin, vMax, vAvg := minMaxAvg(verifyTimes)
+		aggs = append(aggs, RangeAggregate{
+			Bits:        bits,
+			Aggregated:  agg,
+			Trials:      trials,
+			ProveAvgMS:  pAvg,
+			VerifyAvgMS: vAvg,
+			VerifyMinMS: vMin,
+			VerifyMaxMS: vMax,
+			ProofBytes:  proofLen,
+		})
+		log.Printf(">>> [bits=%d, agg=%d] PROVE avg=%.3f ms | VERIFY avg=%.3f ms (min=%.3f, max=%.3f) | PROOF %d bytes",
+			bits, agg, pAvg, vAvg, vMin, vMax, proofLen)
+	}
+	return aggs, all
+}
+
+func checkRangeFlags(bits, maxAgg int) error {
+	switch bits {
+	case 8, 16, 32, 64:
+	default:
+		return fmt.Errorf("range-bits must be one of 8, 16, 32, 64")
+	}
+	if maxAgg <= 0 || maxAgg&(maxAgg-1) != 0 {
+		return fmt.Errorf("range-max-agg must be a power of two")
+	}
+	return nil
+}
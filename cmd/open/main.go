@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"coursach/triptych/triptych"
+)
+
+type openingReport struct {
+	KeyImage  *triptych.Point `json:"keyImage"`
+	PublicKey *triptych.Point `json:"publicKey"`
+	RingIndex int             `json:"ringIndex"`
+	Proof     string          `json:"proof"`
+}
+
+func readRing(path string) ([]*triptych.Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ring []*triptych.Point
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		P := new(triptych.Point)
+		if err := P.UnmarshalText([]byte(line)); err != nil {
+			return nil, fmt.Errorf("bad pubkey: %w", err)
+		}
+		ring = append(ring, P)
+	}
+	return ring, sc.Err()
+}
+
+func main() {
+	n := flag.Int("n", 2, "основание кольца")
+	m := flag.Int("m", 3, "степень (размер кольца = n^m)")
+	msg := flag.String("msg", "", "подписанное сообщение")
+	sigB64 := flag.String("sig", "", "подпись (base64 от keyimg||raw)")
+	ringFile := flag.String("ring", "", "файл с кольцом в порядке использования при подписи")
+	skHex := flag.String("sk", "", "секретный ключ аудитора (32B hex)")
+	flag.Parse()
+
+	if *sigB64 == "" || *ringFile == "" || *skHex == "" {
+		log.Fatalf("usage: open -n 2 -m 3 -msg hi -sig <b64> -ring ring.used -sk <auditor sk hex>")
+	}
+
+	var ask triptych.Scalar
+	if err := ask.UnmarshalText([]byte(*skHex)); err != nil {
+		log.Fatalf("bad sk hex: %v", err)
+	}
+	apk := triptych.ScalarBaseMult(&ask)
+
+	blob, err := base64.StdEncoding.DecodeString(*sigB64)
+	if err != nil || len(blob) < 33 {
+		log.Fatalf("bad base64: %v", err)
+	}
+	ring, err := readRing(*ringFile)
+	if err != nil {
+		log.Fatalf("read ring: %v", err)
+	}
+	sig, err := triptych.DeserializeAccountable(blob[33:], *m, *n, blob[:33])
+	if err != nil {
+		log.Fatalf("deserialize: %v", err)
+	}
+	if ok, _ := triptych.VerifyAccountable(sig, []byte(*msg), ring, apk, *n, *m); !ok {
+		log.Fatalf("signature is invalid or not escrowed to this auditor")
+	}
+
+	idx, pk, proof, err := triptych.OpenInRing(ask.Bytes(), sig, ring)
+	if err != nil {
+		log.Fatalf("open: %v", err)
+	}
+	out, _ := json.MarshalIndent(openingReport{
+		KeyImage:  sig.U,
+		PublicKey: pk,
+		RingIndex: idx,
+		Proof:     hex.EncodeToString(proof.Bytes()),
+	}, "", "  ")
+	fmt.Println(string(out))
+}
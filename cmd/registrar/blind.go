@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// In serve mode the registrar issues blind eligibility tokens: it checks
+// the voter's access code from the roster, then signs a key it never sees.
+// Each roster entry gets one token.
+
+type BlindSessionRequest struct {
+	FullName string `json:"fullName"`
+	Code     string `json:"code"`
+}
+
+type BlindSessionDTO struct {
+	SessionID    string          `json:"sessionId"`
+	R            *triptych.Point `json:"r"`
+	ElectionID   string          `json:"electionId"`
+	RegistrarKey *triptych.Point `json:"registrarKey"`
+	ExpiresAt    time.Time       `json:"expiresAt"`
+}
+
+type BlindSignRequest struct {
+	SessionID string           `json:"sessionId"`
+	Challenge *triptych.Scalar `json:"challenge"`
+}
+
+type BlindSignDTO struct {
+	S *triptych.Scalar `json:"s"`
+}
+
+type errorResponse struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+type blindServer struct {
+	electionID string
+	pk         *triptych.Point
+	signer     *triptych.BlindSigner
+	roster     map[string]string // name -> access code
+
+	mu         sync.Mutex
+	pending    map[string]string // session -> name
+	issued     map[string]bool
+	issuedFile *os.File
+}
+
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	keyPath := fs.String("key", "registrar-key.json", "секретный файл ключа регистратора")
+	electionID := fs.String("election", "", "идентификатор выборов")
+	rosterPath := fs.String("roster", "roster.txt", "список избирателей: строка «<код доступа> <ФИО>»")
+	issuedPath := fs.String("issued", "issued.txt", "журнал выданных токенов (ФИО по строке); дописывается")
+	addr := fs.String("addr", ":8087", "адрес HTTP-сервера")
+	_ = fs.Parse(args)
+	if *electionID == "" {
+		usage()
+	}
+	sk := loadKey(*keyPath)
+
+	s := &blindServer{
+		electionID: *electionID,
+		pk:         triptych.ScalarBaseMult(sk),
+		signer:     triptych.NewBlindSigner(sk),
+		roster:     readRoster(*rosterPath),
+		pending:    map[string]string{},
+		issued:     map[string]bool{},
+	}
+	if b, err := os.ReadFile(*issuedPath); err == nil {
+		for _, name := range strings.Split(string(b), "\n") {
+			if name != "" {
+				s.issued[name] = true
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("read %s: %v", *issuedPath, err)
+	}
+	f, err := os.OpenFile(*issuedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Fatalf("open %s: %v", *issuedPath, err)
+	}
+	defer f.Close()
+	s.issuedFile = f
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/blind/session", s.handleSession)
+	mux.HandleFunc("POST /api/blind/sign", s.handleSign)
+	log.Printf("registrar listening on %s (election %q, %d voters, %d tokens issued)", *addr, *electionID, len(s.roster), len(s.issued))
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func readRoster(path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("read %s: %v", path, err)
+	}
+	defer f.Close()
+	roster := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		code, name, ok := strings.Cut(line, " ")
+		if !ok || strings.TrimSpace(name) == "" {
+			log.Fatalf("%s: bad line %q", path, line)
+		}
+		roster[strings.TrimSpace(name)] = code
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatalf("read %s: %v", path, err)
+	}
+	return roster
+}
+
+// handleSession authenticates the voter and opens a signing session. A
+// voter has at most one open session; a new one replaces it.
+func (s *blindServer) handleSession(w http.ResponseWriter, r *http.Request) {
+	var req BlindSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+	code, ok := s.roster[req.FullName]
+	if !ok || req.Code == "" || subtle.ConstantTimeCompare([]byte(code), []byte(req.Code)) != 1 {
+		log.Printf("[blind] rejected %q: bad access code", req.FullName)
+		writeError(w, http.StatusUnauthorized, "unknown voter or wrong access code")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.issued[req.FullName] {
+		writeError(w, http.StatusConflict, "token already issued")
+		return
+	}
+	for id, name := range s.pending {
+		if name == req.FullName {
+			s.signer.Abort(id)
+			delete(s.pending, id)
+		}
+	}
+	now := time.Now()
+	id, R, err := s.signer.Commit(now)
+	if errors.Is(err, triptych.ErrBlindBusy) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	s.pending[id] = req.FullName
+	writeJSON(w, http.StatusOK, BlindSessionDTO{SessionID: id, R: R, ElectionID: s.electionID, RegistrarKey: s.pk, ExpiresAt: now.Add(triptych.BlindSessionTTL).UTC()})
+}
+
+// handleSign answers the blinded challenge. The voter counts as served
+// once the answer is sent, so a lost answer needs the registrar's help.
+func (s *blindServer) handleSign(w http.ResponseWriter, r *http.Request) {
+	var req BlindSignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Challenge == nil {
+		writeError(w, http.StatusBadRequest, "bad request")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name, ok := s.pending[req.SessionID]
+	delete(s.pending, req.SessionID)
+	if !ok {
+		writeError(w, http.StatusNotFound, triptych.ErrBlindSession.Error())
+		return
+	}
+	sig, err := s.signer.Respond(req.SessionID, req.Challenge, time.Now())
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if _, err := fmt.Fprintln(s.issuedFile, name); err != nil {
+		writeError(w, http.StatusInternalServerError, "issued log: "+err.Error())
+		return
+	}
+	s.issued[name] = true
+	log.Printf("[blind] token issued to %q", name)
+	writeJSON(w, http.StatusOK, BlindSignDTO{S: sig})
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, errorResponse{Status: code, Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
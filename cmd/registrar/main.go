@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// The registrar checks voters' identities offline and certifies their keys.
+// A credential binds the voter's name and public key to one election; the
+// board registers only keys with a credential that is not on the
+// registrar's revocation list. In serve mode it hands out blind tokens
+// instead, which certify a key without telling the registrar which one.
+
+type registrarKeyFile struct {
+	PublicKey *triptych.Point  `json:"publicKey"`
+	SecretKey *triptych.Scalar `json:"secretKey"`
+	CreatedAt string           `json:"createdAt"`
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "init":
+		runInit(os.Args[2:])
+	case "issue":
+		runIssue(os.Args[2:])
+	case "revoke":
+		runRevoke(os.Args[2:])
+	case "serve":
+		runServe(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Println("usage:")
+	fmt.Println("  registrar init -out registrar-key.json")
+	fmt.Println("  registrar issue -key registrar-key.json -election default -name \"Alice Smith\" -pk hex -out alice-credential.json")
+	fmt.Println("  registrar revoke -key registrar-key.json -election default -serial s1,s2 -list revocations.json [-url http://localhost:8086]")
+	fmt.Println("  registrar serve -key registrar-key.json -election default -roster roster.txt [-issued issued.txt] [-addr :8087]")
+	os.Exit(2)
+}
+
+func runInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	out := fs.String("out", "registrar-key.json", "секретный файл ключа регистратора")
+	_ = fs.Parse(args)
+
+	sk := triptych.RandomScalar()
+	writeFile(*out, registrarKeyFile{PublicKey: triptych.ScalarBaseMult(sk), SecretKey: sk, CreatedAt: time.Now().Format(time.RFC3339)}, 0o600)
+	pk, _ := triptych.ScalarBaseMult(sk).MarshalText()
+	fmt.Printf("Registrar key saved to %s.\nPublic key (put it in the manifest with authority manifest -registrar-pk): %s\n", *out, pk)
+}
+
+func runIssue(args []string) {
+	fs := flag.NewFlagSet("issue", flag.ExitOnError)
+	keyPath := fs.String("key", "registrar-key.json", "секретный файл ключа регистратора")
+	electionID := fs.String("election", "", "идентификатор выборов")
+	name := fs.String("name", "", "ФИО избирателя, как при регистрации через keygen")
+	pkHex := fs.String("pk", "", "публичный ключ избирателя (33B hex)")
+	out := fs.String("out", "", "куда сохранить удостоверение (по умолчанию <serial>-credential.json)")
+	_ = fs.Parse(args)
+	if *electionID == "" || *name == "" || *pkHex == "" {
+		usage()
+	}
+	sk := loadKey(*keyPath)
+	pk := new(triptych.Point)
+	if err := pk.UnmarshalText([]byte(*pkHex)); err != nil {
+		log.Fatalf("bad pk: %v", err)
+	}
+
+	var serial [16]byte
+	_, _ = rand.Read(serial[:])
+	c := triptych.Credential{
+		ElectionID: *electionID,
+		FullName:   *name,
+		PublicKey:  pk,
+		Serial:     hex.EncodeToString(serial[:]),
+		IssuedAt:   time.Now().UTC().Truncate(time.Millisecond),
+	}
+	c.Sign(sk)
+	if *out == "" {
+		*out = c.Serial + "-credential.json"
+	}
+	writeFile(*out, c, 0o644)
+	fmt.Printf("Credential %s for %q saved to %s.\n", c.Serial, c.FullName, *out)
+}
+
+// runRevoke adds serials to the revocation list, re-signs it and, with
+// -url, publishes it on the board.
+func runRevoke(args []string) {
+	fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+	keyPath := fs.String("key", "registrar-key.json", "секретный файл ключа регистратора")
+	electionID := fs.String("election", "", "идентификатор выборов")
+	serials := fs.String("serial", "", "отзываемые серийные номера удостоверений через запятую")
+	listPath := fs.String("list", "revocations.json", "список отзыва; создаётся, если файла нет")
+	baseURL := fs.String("url", "", "базовый URL доски, куда опубликовать список")
+	_ = fs.Parse(args)
+	if *electionID == "" {
+		usage()
+	}
+	sk := loadKey(*keyPath)
+
+	l := triptych.RevocationList{ElectionID: *electionID}
+	if _, err := os.Stat(*listPath); err == nil {
+		readFile(*listPath, &l)
+		if l.ElectionID != *electionID || l.Verify(triptych.ScalarBaseMult(sk)) != nil {
+			log.Fatalf("%s: не наш список отзыва или он повреждён", *listPath)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("read %s: %v", *listPath, err)
+	}
+	for _, s := range strings.Split(*serials, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			l.Serials = append(l.Serials, s)
+		}
+	}
+	l.IssuedAt = time.Now().UTC().Truncate(time.Millisecond)
+	l.Sign(sk)
+	writeFile(*listPath, l, 0o644)
+	fmt.Printf("Revocation list %s: %d serials.\n", *listPath, len(l.Serials))
+
+	if *baseURL == "" {
+		return
+	}
+	b, _ := json.Marshal(l)
+	client := &http.Client{Timeout: 15 * time.Second}
+	res, err := client.Post(strings.TrimRight(*baseURL, "/")+"/api/registrar/revocations", "application/json", bytes.NewReader(b))
+	if err != nil {
+		log.Fatalf("publish: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		log.Fatalf("publish: http %d", res.StatusCode)
+	}
+	fmt.Println("Published on the board.")
+}
+
+func loadKey(path string) *triptych.Scalar {
+	var kf registrarKeyFile
+	readFile(path, &kf)
+	if kf.SecretKey == nil {
+		log.Fatalf("%s: no secret key", path)
+	}
+	return kf.SecretKey
+}
+
+func readFile(path string, v interface{}) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		log.Fatalf("parse %s: %v", path, err)
+	}
+}
+
+func writeFile(path string, v interface{}, perm os.FileMode) {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	if err := os.WriteFile(path, b, perm); err != nil {
+		log.Fatalf("write %s: %v", path, err)
+	}
+}
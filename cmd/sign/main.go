@@ -3,7 +3,6 @@ package main
 import (
 	"bufio"
 	"encoding/base64"
-	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
@@ -25,12 +24,8 @@ func readRing(path string) ([]*triptych.Point, error) {
 		if line == "" {
 			continue
 		}
-		b, err := hex.DecodeString(line)
-		if err != nil {
-			return nil, fmt.Errorf("bad hex pubkey: %w", err)
-		}
-		P, err := triptych.ParseCompressed(b)
-		if err != nil {
+		P := new(triptych.Point)
+		if err := P.UnmarshalText([]byte(line)); err != nil {
 			return nil, fmt.Errorf("bad pubkey: %w", err)
 		}
 		ring = append(ring, P)
@@ -46,7 +41,8 @@ func writeRing(path string, ring []*triptych.Point) error {
 	defer f.Close()
 	w := bufio.NewWriter(f)
 	for _, p := range ring {
-		fmt.Fprintln(w, hex.EncodeToString(p.BytesCompressed()))
+		b, _ := p.MarshalText()
+		fmt.Fprintln(w, string(b))
 	}
 	return w.Flush()
 }
@@ -59,27 +55,82 @@ func main() {
 	ringFile := flag.String("ring", "", "файл со списком публичных ключей (по одному 33B hex в строке)")
 	outSig := flag.String("out", "sig.b64", "куда сохранить подпись (base64)")
 	outRing := flag.String("out-ring", "ring.used", "куда сохранить порядок кольца, использованный при подписи")
+	scope := flag.String("scope", "", "область отслеживаемой подписи (если задана, подпись выдаёт повторно голосующего)")
+	auditorHex := flag.String("auditor", "", "публичный ключ аудитора (33B hex); если задан, подпись раскрываема аудитором")
+	electionID := flag.String("election", "", "идентификатор выборов; если задан, подписывается бюллетень за -candidate вместо -msg")
+	candidate := flag.String("candidate", "", "идентификатор кандидата для бюллетеня")
+	outBallot := flag.String("out-ballot", "ballot.b64", "куда сохранить подписанный бюллетень (base64)")
 	flag.Parse()
 
 	if *skHex == "" || *ringFile == "" {
 		log.Fatalf("usage: sign -n 3 -m 3 -msg \"hi\" -sk <hex> -ring ring.txt")
 	}
 
-	sk, err := hex.DecodeString(*skHex)
-	if err != nil || len(sk) != 32 {
+	var skScalar triptych.Scalar
+	if err := skScalar.UnmarshalText([]byte(*skHex)); err != nil {
 		log.Fatalf("bad sk hex: %v", err)
 	}
+	sk := skScalar.Bytes()
 	ring, err := readRing(*ringFile)
 	if err != nil {
 		log.Fatalf("read ring: %v", err)
 	}
 
-	sig, ringUsed, err := triptych.RingSignTriptych(sk, []byte(*msg), ring, *n, *m)
-	if err != nil {
-		log.Fatalf("sign: %v", err)
+	message := []byte(*msg)
+	if *electionID != "" {
+		if *candidate == "" {
+			log.Fatalf("-election requires -candidate")
+		}
+		ballot, err := triptych.NewBallot(*electionID, ring, triptych.BallotPlurality,
+			[]triptych.BallotChoice{{Candidate: *candidate, Value: 1}}, nil)
+		if err != nil {
+			log.Fatalf("ballot: %v", err)
+		}
+		message = ballot.Bytes()
+		if err := os.WriteFile(*outBallot, []byte(base64.StdEncoding.EncodeToString(message)), 0644); err != nil {
+			log.Fatalf("write ballot: %v", err)
+		}
+		fmt.Printf("Ballot for %q in election %q saved to %s.\n", *candidate, *electionID, *outBallot)
+	}
+
+	if *scope != "" {
+		tsig, err := triptych.TraceableSign(sk, message, []byte(*scope), ring, *n, *m)
+		if err != nil {
+			log.Fatalf("sign: %v", err)
+		}
+		raw := triptych.SerializeTraceable(tsig)
+		if err := os.WriteFile(*outSig, []byte(base64.StdEncoding.EncodeToString(raw)), 0644); err != nil {
+			log.Fatalf("write sig: %v", err)
+		}
+		if err := writeRing(*outRing, ring); err != nil {
+			log.Fatalf("write ring: %v", err)
+		}
+		fmt.Printf("OK. Traceable signature (scope=%q) saved to %s. Ring to %s.\n", *scope, *outSig, *outRing)
+		fmt.Printf("Raw sig bytes: %d\n", len(raw))
+		return
 	}
 
-	raw, keyImg := triptych.Serialize(sig)
+	var raw, keyImg []byte
+	var ringUsed []*triptych.Point
+	if *auditorHex != "" {
+		apk := new(triptych.Point)
+		if err := apk.UnmarshalText([]byte(*auditorHex)); err != nil {
+			log.Fatalf("bad auditor key: %v", err)
+		}
+		asig, used, err := triptych.RingSignAccountable(sk, message, ring, apk, *n, *m)
+		if err != nil {
+			log.Fatalf("sign: %v", err)
+		}
+		raw, keyImg = triptych.SerializeAccountable(asig)
+		ringUsed = used
+	} else {
+		sig, used, err := triptych.RingSignTriptych(sk, message, ring, *n, *m)
+		if err != nil {
+			log.Fatalf("sign: %v", err)
+		}
+		raw, keyImg = triptych.Serialize(sig)
+		ringUsed = used
+	}
 
 	if err := os.WriteFile(*outSig, []byte(base64.StdEncoding.EncodeToString(append(keyImg, raw...))), 0644); err != nil {
 		log.Fatalf("write sig: %v", err)
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"coursach/triptych/tally"
+	"coursach/triptych/triptych"
+)
+
+type CandidateDTO struct {
+	ID       string `json:"id"`
+	Fullname string `json:"fullname"`
+}
+
+type electionKeyFile struct {
+	PublicKey *triptych.Point  `json:"publicKey"`
+	SecretKey *triptych.Scalar `json:"secretKey"`
+	CreatedAt string           `json:"createdAt"`
+}
+
+// electionFile and partialFile are written by the trustee command.
+type electionFile struct {
+	PublicKey   *triptych.Point              `json:"publicKey"`
+	Threshold   int                          `json:"threshold"`
+	Trustees    int                          `json:"trustees"`
+	Commitments []*triptych.DealerCommitment `json:"commitments"`
+}
+
+type CommitmentDTO struct {
+	UNumber     string           `json:"uNumber"`
+	Commitment  *triptych.Point  `json:"commitment"`
+	CandidateID string           `json:"candidateId"`
+	Opening     *triptych.Scalar `json:"opening"`
+	Proof       string           `json:"proof"`
+}
+
+type BallotEntryDTO struct {
+	UNumber   string `json:"uNumber"`
+	BallotB64 string `json:"ballotB64"`
+}
+
+type ElectionDTO struct {
+	ID       string `json:"id"`
+	Revoting bool   `json:"revoting"`
+}
+
+type partialFile struct {
+	Trustee     int                       `json:"trustee"`
+	Ballots     int                       `json:"ballots"`
+	Candidates  []string                  `json:"candidates"`
+	Ciphertexts []*triptych.Ciphertext    `json:"ciphertexts"`
+	Share       *triptych.DecryptionShare `json:"share"`
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "keygen":
+		runKeygen(os.Args[2:])
+	case "run":
+		runTally(os.Args[2:])
+	case "combine":
+		runCombine(os.Args[2:])
+	case "reveals":
+		runReveals(os.Args[2:])
+	case "count":
+		runCount(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Println("usage:")
+	fmt.Println("  tally keygen -out election-key.json")
+	fmt.Println("  tally run -url http://localhost:8086 -keys election-key.json [-ballots ballots.json] [-max-choices k]")
+	fmt.Println("  tally combine -url http://localhost:8086 -election election.json -partials partial-1.json,partial-2.json [-ballots ballots.json] [-max-choices k]")
+	fmt.Println("  tally reveals -url http://localhost:8086")
+	fmt.Println("  tally count -url http://localhost:8086 -method plurality|approval|score|borda|irv|stv|schulze [-seats 1] [-max-score 10] [-out report.json]")
+	os.Exit(2)
+}
+
+func runKeygen(args []string) {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("out", "election-key.json", "куда сохранить ключ выборов")
+	_ = fs.Parse(args)
+
+	sk := triptych.RandomScalar()
+	kf := electionKeyFile{
+		PublicKey: triptych.ScalarBaseMult(sk),
+		SecretKey: sk,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	b, _ := json.MarshalIndent(kf, "", "  ")
+	if err := os.WriteFile(*out, b, 0o600); err != nil {
+		log.Fatalf("write key: %v", err)
+	}
+	pk, _ := kf.PublicKey.MarshalText()
+	fmt.Printf("Election key saved to %s\n", *out)
+	fmt.Printf("Election public key: %s\n", pk)
+}
+
+func runTally(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	baseURL := fs.String("url", "", "базовый URL бэкенда")
+	keysPath := fs.String("keys", "", "файл с ключом выборов")
+	ballotsPath := fs.String("ballots", "", "JSON-файл со списком зашифрованных бюллетеней (base64); по умолчанию загружаются с сервера")
+	maxChoices := fs.Int("max-choices", 0, "правило выборов для зашифрованных бюллетеней: 0 — ровно одна отметка, k — не больше k отметок")
+	_ = fs.Parse(args)
+
+	if *baseURL == "" || *keysPath == "" {
+		usage()
+	}
+
+	b, err := os.ReadFile(*keysPath)
+	if err != nil {
+		log.Fatalf("read keys: %v", err)
+	}
+	var kf electionKeyFile
+	if err := json.Unmarshal(b, &kf); err != nil || kf.SecretKey == nil || kf.PublicKey == nil {
+		log.Fatalf("parse keys json: %v", err)
+	}
+
+	cands := fetchCandidates(*baseURL)
+	ballots := loadBallots(*baseURL, *ballotsPath, kf.PublicKey, len(cands), *maxChoices)
+
+	totals, err := triptych.TallyEncrypted(ballots, kf.SecretKey, len(cands))
+	if err != nil {
+		log.Fatalf("tally: %v", err)
+	}
+	fmt.Printf("Бюллетеней: %d\n", len(ballots))
+	for i, c := range cands {
+		fmt.Printf("%-40s %6d  (%s)\n", c.Fullname, totals[i], c.ID)
+	}
+}
+
+func runCombine(args []string) {
+	fs := flag.NewFlagSet("combine", flag.ExitOnError)
+	baseURL := fs.String("url", "", "базовый URL бэкенда")
+	electionPath := fs.String("election", "", "публичные параметры выборов (от trustee finalize)")
+	partials := fs.String("partials", "", "файлы частичных расшифровок через запятую")
+	ballotsPath := fs.String("ballots", "", "JSON-файл со списком зашифрованных бюллетеней (base64); по умолчанию загружаются с сервера")
+	maxChoices := fs.Int("max-choices", 0, "правило выборов для зашифрованных бюллетеней: 0 — ровно одна отметка, k — не больше k отметок")
+	_ = fs.Parse(args)
+
+	if *baseURL == "" || *electionPath == "" || *partials == "" {
+		usage()
+	}
+
+	var ef electionFile
+	if err := readJSONFile(*electionPath, &ef); err != nil {
+		log.Fatalf("read election: %v", err)
+	}
+	if ef.PublicKey.IsIdentity() || len(ef.Commitments) != ef.Trustees {
+		log.Fatalf("election file is incomplete")
+	}
+	if !triptych.DKGPublicKey(ef.Commitments).Equal(ef.PublicKey) {
+		log.Fatalf("election public key does not match dealer commitments")
+	}
+
+	cands := fetchCandidates(*baseURL)
+	ballots := loadBallots(*baseURL, *ballotsPath, ef.PublicKey, len(cands), *maxChoices)
+	sums, err := triptych.SumBallots(ballots, len(cands))
+	if err != nil {
+		log.Fatalf("sum ballots: %v", err)
+	}
+
+	var shares []*triptych.DecryptionShare
+	for _, p := range strings.Split(*partials, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		var pf partialFile
+		if err := readJSONFile(p, &pf); err != nil {
+			log.Fatalf("read %s: %v", p, err)
+		}
+		if pf.Share == nil || pf.Share.Trustee != pf.Trustee || pf.Trustee < 1 || pf.Trustee > ef.Trustees {
+			log.Printf("%s skipped: bad trustee index", p)
+			continue
+		}
+		if !sameCiphertexts(pf.Ciphertexts, sums) {
+			log.Printf("%s skipped: trustee %d decrypted a different ballot set", p, pf.Trustee)
+			continue
+		}
+		if !triptych.VerifyDecryptionShare(triptych.VerificationKey(ef.Commitments, pf.Trustee), sums, pf.Share) {
+			log.Printf("%s skipped: invalid decryption proof from trustee %d", p, pf.Trustee)
+			continue
+		}
+		shares = append(shares, pf.Share)
+	}
+
+	points, err := triptych.CombineDecryptionShares(sums, shares, ef.Threshold)
+	if err != nil {
+		log.Fatalf("combine: %d valid shares, need %d", len(shares), ef.Threshold)
+	}
+	fmt.Printf("Бюллетеней: %d\n", len(ballots))
+	for i, c := range cands {
+		v, err := triptych.SolveDLog(points[i], len(ballots))
+		if err != nil {
+			log.Fatalf("candidate %s: %v", c.ID, err)
+		}
+		fmt.Printf("%-40s %6d  (%s)\n", c.Fullname, v, c.ID)
+	}
+}
+
+// runReveals recounts commit–reveal ballots: a ballot counts only if its
+// reveal opens the commitment and is bound to the ballot's key image.
+func runReveals(args []string) {
+	fs := flag.NewFlagSet("reveals", flag.ExitOnError)
+	baseURL := fs.String("url", "", "базовый URL бэкенда")
+	_ = fs.Parse(args)
+
+	if *baseURL == "" {
+		usage()
+	}
+
+	cands := fetchCandidates(*baseURL)
+	var commits []CommitmentDTO
+	if err := getJSON(strings.TrimRight(*baseURL, "/")+"/api/bulletin/commitments", &commits); err != nil {
+		log.Fatalf("fetch commitments: %v", err)
+	}
+
+	totals := make(map[string]int, len(cands))
+	unrevealed, invalid := 0, 0
+	for _, c := range commits {
+		if c.Opening == nil {
+			unrevealed++
+			continue
+		}
+		proof := new(triptych.DLEQProof)
+		keyImage := new(triptych.Point)
+		if err := proof.UnmarshalText([]byte(c.Proof)); err != nil {
+			log.Printf("ballot %s: bad proof: %v", c.UNumber, err)
+			invalid++
+			continue
+		}
+		if err := keyImage.UnmarshalText([]byte(c.UNumber)); err != nil {
+			log.Printf("ballot %s: bad key image: %v", c.UNumber, err)
+			invalid++
+			continue
+		}
+		rv := &triptych.Reveal{KeyImage: keyImage, CandidateID: c.CandidateID, Opening: c.Opening, Proof: proof}
+		if err := triptych.VerifyReveal(c.Commitment, rv); err != nil {
+			log.Printf("ballot %s: %v", c.UNumber, err)
+			invalid++
+			continue
+		}
+		totals[c.CandidateID]++
+	}
+
+	fmt.Printf("Обязательств: %d, не раскрыто: %d, неверных раскрытий: %d\n", len(commits), unrevealed, invalid)
+	for _, c := range cands {
+		fmt.Printf("%-40s %6d  (%s)\n", c.Fullname, totals[c.ID], c.ID)
+	}
+}
+
+// runCount tallies the signed plaintext ballots with one of the methods of
+// the tally package and prints the round-by-round report.
+func runCount(args []string) {
+	fs := flag.NewFlagSet("count", flag.ExitOnError)
+	baseURL := fs.String("url", "", "базовый URL бэкенда")
+	method := fs.String("method", "plurality", "метод подсчёта: plurality, approval, score, borda, irv, stv, schulze")
+	seats := fs.Int("seats", 1, "число мест")
+	maxScore := fs.Uint("max-score", 10, "максимальная оценка для score; бюллетени с большей оценкой не засчитываются")
+	outPath := fs.String("out", "", "куда сохранить отчёт в JSON")
+	_ = fs.Parse(args)
+
+	if *baseURL == "" {
+		usage()
+	}
+	base := strings.TrimRight(*baseURL, "/")
+
+	var election ElectionDTO
+	if err := getJSON(base+"/api/election", &election); err != nil {
+		log.Fatalf("fetch election: %v", err)
+	}
+	cands := fetchCandidates(*baseURL)
+	var raw []BallotEntryDTO
+	if err := getJSON(base+"/api/bulletin/ballots", &raw); err != nil {
+		log.Fatalf("fetch ballots: %v", err)
+	}
+
+	entries := make([]tally.Entry, 0, len(raw))
+	for _, e := range raw {
+		b, err := base64.StdEncoding.DecodeString(e.BallotB64)
+		if err != nil {
+			log.Printf("ballot %s skipped: bad base64", e.UNumber)
+			continue
+		}
+		ballot, err := triptych.ParseBallot(b)
+		if err != nil {
+			log.Printf("ballot %s skipped: %v", e.UNumber, err)
+			continue
+		}
+		if ballot.ElectionID != election.ID {
+			log.Printf("ballot %s skipped: %v", e.UNumber, triptych.ErrWrongElection)
+			continue
+		}
+		entries = append(entries, tally.Entry{KeyImage: e.UNumber, Ballot: ballot})
+	}
+
+	ids := make([]string, len(cands))
+	names := make(map[string]string, len(cands))
+	for i, c := range cands {
+		ids[i] = c.ID
+		names[c.ID] = c.Fullname
+	}
+	counted := tally.Dedup(entries)
+	if election.Revoting {
+		counted = tally.Latest(entries)
+	}
+	if tally.Method(*method) == tally.Score && (*maxScore == 0 || *maxScore > 1<<32-1) {
+		log.Fatalf("bad -max-score %d", *maxScore)
+	}
+	rep, err := tally.Run(tally.Method(*method), ids, counted, tally.Options{Seats: *seats, MaxScore: uint32(*maxScore)})
+	if err != nil {
+		log.Fatalf("tally: %v", err)
+	}
+
+	fmt.Printf("Метод: %s, мест: %d, бюллетеней: %d, не подходят для метода: %d\n", rep.Method, rep.Seats, rep.Ballots, rep.Invalid)
+	if rep.Quota > 0 {
+		fmt.Printf("Квота Друпа: %.0f\n", rep.Quota)
+	}
+	for _, r := range rep.Rounds {
+		fmt.Printf("\nРаунд %d\n", r.Number)
+		keys := make([]string, 0, len(r.Tallies))
+		for id := range r.Tallies {
+			keys = append(keys, id)
+		}
+		sort.Slice(keys, func(i, j int) bool { return r.Tallies[keys[i]] > r.Tallies[keys[j]] })
+		for _, id := range keys {
+			fmt.Printf("  %-40s %10.4f\n", names[id], r.Tallies[id])
+		}
+		if r.Exhausted > 0 {
+			fmt.Printf("  %-40s %10.4f\n", "(исчерпано)", r.Exhausted)
+		}
+		for _, id := range r.Elected {
+			fmt.Printf("  избран: %s\n", names[id])
+		}
+		for _, id := range r.Eliminated {
+			fmt.Printf("  выбывает: %s\n", names[id])
+		}
+		if r.Note != "" {
+			fmt.Printf("  (%s)\n", r.Note)
+		}
+	}
+	fmt.Println("\nПобедители:")
+	for _, id := range rep.Winners {
+		fmt.Printf("  %s  (%s)\n", names[id], id)
+	}
+
+	if *outPath != "" {
+		b, _ := json.MarshalIndent(rep, "", "  ")
+		if err := os.WriteFile(*outPath, b, 0o644); err != nil {
+			log.Fatalf("write report: %v", err)
+		}
+	}
+}
+
+func sameCiphertexts(a, b []*triptych.Ciphertext) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] == nil || !a[i].C1.Equal(b[i].C1) || !a[i].C2.Equal(b[i].C2) {
+			return false
+		}
+	}
+	return true
+}
+
+func fetchCandidates(baseURL string) []CandidateDTO {
+	var cands []CandidateDTO
+	if err := getJSON(strings.TrimRight(baseURL, "/")+"/api/candidate", &cands); err != nil {
+		log.Fatalf("fetch candidates: %v", err)
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].ID < cands[j].ID })
+	return cands
+}
+
+func loadBallots(baseURL, path string, pk *triptych.Point, candidates, maxChoices int) []*triptych.EncryptedBallot {
+	minC, maxC := triptych.ChoiceBounds(maxChoices)
+	var encoded []string
+	if path != "" {
+		if err := readJSONFile(path, &encoded); err != nil {
+			log.Fatalf("read ballots: %v", err)
+		}
+	} else if err := getJSON(strings.TrimRight(baseURL, "/")+"/api/bulletin/encrypted", &encoded); err != nil {
+		log.Fatalf("fetch ballots: %v", err)
+	}
+
+	ballots := make([]*triptych.EncryptedBallot, 0, len(encoded))
+	for i, e := range encoded {
+		raw, err := base64.StdEncoding.DecodeString(e)
+		if err != nil {
+			log.Fatalf("ballot %d: bad base64: %v", i, err)
+		}
+		eb, err := triptych.ParseEncryptedBallot(raw)
+		if err != nil {
+			log.Printf("ballot %d skipped: %v", i, err)
+			continue
+		}
+		if len(eb.Ciphertexts) != candidates {
+			log.Printf("ballot %d skipped: %d ciphertexts for %d candidates", i, len(eb.Ciphertexts), candidates)
+			continue
+		}
+		if err := triptych.VerifyEncryptedBallot(pk, eb, minC, maxC); err != nil {
+			log.Printf("ballot %d skipped: %v", i, err)
+			continue
+		}
+		ballots = append(ballots, eb)
+	}
+	return ballots
+}
+
+func readJSONFile(path string, v interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func getJSON(url string, out interface{}) error {
+	client := &http.Client{Timeout: 15 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("http %d", res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
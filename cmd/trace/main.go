@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"coursach/triptych/triptych"
+)
+
+func readRing(path string) ([]*triptych.Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ring []*triptych.Point
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		P := new(triptych.Point)
+		if err := P.UnmarshalText([]byte(line)); err != nil {
+			return nil, fmt.Errorf("bad pubkey: %w", err)
+		}
+		ring = append(ring, P)
+	}
+	return ring, sc.Err()
+}
+
+func readSig(path string, m, n int) *triptych.TraceableSignature {
+	b64, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("read %s: %v", path, err)
+	}
+	blob, err := base64.StdEncoding.DecodeString(string(b64))
+	if err != nil {
+		log.Fatalf("%s: bad base64: %v", path, err)
+	}
+	sig, err := triptych.DeserializeTraceable(blob, m, n)
+	if err != nil {
+		log.Fatalf("%s: deserialize: %v", path, err)
+	}
+	return sig
+}
+
+func main() {
+	n := flag.Int("n", 3, "основание кольца")
+	m := flag.Int("m", 3, "степень (размер кольца = n^m)")
+	scope := flag.String("scope", "", "область отслеживаемых подписей")
+	ringFile := flag.String("ring", "", "файл с кольцом")
+	msg1 := flag.String("msg1", "", "сообщение первой подписи")
+	sig1Path := flag.String("sig1", "", "файл с первой подписью (base64)")
+	msg2 := flag.String("msg2", "", "сообщение второй подписи")
+	sig2Path := flag.String("sig2", "", "файл со второй подписью (base64)")
+	flag.Parse()
+
+	if *scope == "" || *ringFile == "" || *sig1Path == "" || *sig2Path == "" {
+		log.Fatalf("usage: trace -n 2 -m 3 -scope election-1 -ring ring.used -msg1 a -sig1 a.b64 -msg2 b -sig2 b.b64")
+	}
+
+	ring, err := readRing(*ringFile)
+	if err != nil {
+		log.Fatalf("read ring: %v", err)
+	}
+	sig1 := readSig(*sig1Path, *m, *n)
+	sig2 := readSig(*sig2Path, *m, *n)
+
+	for i, s := range []struct {
+		msg string
+		sig *triptych.TraceableSignature
+	}{{*msg1, sig1}, {*msg2, sig2}} {
+		if !triptych.TraceableVerify(s.sig, []byte(s.msg), []byte(*scope), ring, *n, *m) {
+			log.Fatalf("signature %d is invalid", i+1)
+		}
+	}
+
+	res, err := triptych.Trace([]byte(*scope), ring, []byte(*msg1), sig1, []byte(*msg2), sig2)
+	if err != nil {
+		log.Fatalf("trace: %v", err)
+	}
+	switch res.Kind {
+	case triptych.TraceRevealed:
+		pk, _ := res.PubKey.MarshalText()
+		fmt.Printf("Double signing detected. Signer public key: %s\n", pk)
+	case triptych.TraceLinked:
+		fmt.Println("Signatures are linked (same signer, same message)")
+	default:
+		fmt.Println("Signatures are independent")
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// Offline DKG ceremony. Every step reads and writes files; only the
+// trustee-N.json and share-N.json files are secret, everything else can be
+// published.
+
+type trusteeKeyFile struct {
+	Index           int              `json:"index"`
+	TransportKey    *triptych.Point  `json:"transportKey"`
+	TransportSecret *triptych.Scalar `json:"transportSecret"`
+}
+
+type trusteePubFile struct {
+	Index        int             `json:"index"`
+	TransportKey *triptych.Point `json:"transportKey"`
+}
+
+type dealingFile struct {
+	Threshold int               `json:"threshold"`
+	Trustees  int               `json:"trustees"`
+	Dealing   *triptych.Dealing `json:"dealing"`
+}
+
+type electionFile struct {
+	PublicKey   *triptych.Point              `json:"publicKey"`
+	Threshold   int                          `json:"threshold"`
+	Trustees    int                          `json:"trustees"`
+	Commitments []*triptych.DealerCommitment `json:"commitments"`
+	CreatedAt   string                       `json:"createdAt"`
+}
+
+type shareFile struct {
+	Index     int              `json:"index"`
+	Threshold int              `json:"threshold"`
+	Trustees  int              `json:"trustees"`
+	Share     *triptych.Scalar `json:"share"`
+	PublicKey *triptych.Point  `json:"publicKey"`
+}
+
+type partialFile struct {
+	Trustee     int                       `json:"trustee"`
+	Ballots     int                       `json:"ballots"`
+	Candidates  []string                  `json:"candidates"`
+	Ciphertexts []*triptych.Ciphertext    `json:"ciphertexts"`
+	Share       *triptych.DecryptionShare `json:"share"`
+}
+
+type CandidateDTO struct {
+	ID       string `json:"id"`
+	Fullname string `json:"fullname"`
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "init":
+		runInit(os.Args[2:])
+	case "deal":
+		runDeal(os.Args[2:])
+	case "finalize":
+		runFinalize(os.Args[2:])
+	case "decrypt":
+		runDecrypt(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Println("usage:")
+	fmt.Println("  trustee init -index 1 -out trustee-1.json -pub trustee-1.pub.json")
+	fmt.Println("  trustee deal -key trustee-1.json -t 2 -pubs trustee-1.pub.json,trustee-2.pub.json,... -out dealing-1.json")
+	fmt.Println("  trustee finalize -key trustee-1.json -dealings dealing-1.json,... -out share-1.json -election election.json")
+	fmt.Println("  trustee decrypt -share share-1.json -election election.json -url http://localhost:8086 [-ballots ballots.json] [-max-choices k] -out partial-1.json")
+	os.Exit(2)
+}
+
+func runInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	index := fs.Int("index", 0, "номер доверенного лица (1..n)")
+	out := fs.String("out", "", "секретный файл доверенного лица")
+	pub := fs.String("pub", "", "публичный файл с транспортным ключом")
+	_ = fs.Parse(args)
+	if *index < 1 || *out == "" || *pub == "" {
+		usage()
+	}
+
+	sk := triptych.RandomScalar()
+	kf := trusteeKeyFile{Index: *index, TransportKey: triptych.ScalarBaseMult(sk), TransportSecret: sk}
+	writeFile(*out, kf, 0o600)
+	writeFile(*pub, trusteePubFile{Index: kf.Index, TransportKey: kf.TransportKey}, 0o644)
+	fmt.Printf("Trustee %d initialised: secret %s, public %s\n", kf.Index, *out, *pub)
+}
+
+func runDeal(args []string) {
+	fs := flag.NewFlagSet("deal", flag.ExitOnError)
+	keyPath := fs.String("key", "", "секретный файл доверенного лица")
+	t := fs.Int("t", 0, "порог (сколько доверенных лиц нужно для расшифровки)")
+	pubs := fs.String("pubs", "", "публичные файлы всех доверенных лиц через запятую")
+	out := fs.String("out", "", "куда сохранить раздачу")
+	_ = fs.Parse(args)
+	if *keyPath == "" || *pubs == "" || *out == "" {
+		usage()
+	}
+
+	var kf trusteeKeyFile
+	readFile(*keyPath, &kf)
+	keys := readTransportKeys(splitList(*pubs))
+
+	d, err := triptych.NewDealing(kf.Index, *t, keys)
+	if err != nil {
+		log.Fatalf("deal: %v", err)
+	}
+	writeFile(*out, dealingFile{Threshold: *t, Trustees: len(keys), Dealing: d}, 0o644)
+	fmt.Printf("Dealing of trustee %d (%d-of-%d) saved to %s\n", kf.Index, *t, len(keys), *out)
+}
+
+func readTransportKeys(paths []string) []*triptych.Point {
+	keys := make([]*triptych.Point, len(paths))
+	for _, p := range paths {
+		var pf trusteePubFile
+		readFile(p, &pf)
+		if pf.Index < 1 || pf.Index > len(paths) || pf.TransportKey == nil {
+			log.Fatalf("%s: bad trustee index %d", p, pf.Index)
+		}
+		if keys[pf.Index-1] != nil {
+			log.Fatalf("%s: duplicate trustee index %d", p, pf.Index)
+		}
+		keys[pf.Index-1] = pf.TransportKey
+	}
+	return keys
+}
+
+func runFinalize(args []string) {
+	fs := flag.NewFlagSet("finalize", flag.ExitOnError)
+	keyPath := fs.String("key", "", "секретный файл доверенного лица")
+	dealings := fs.String("dealings", "", "файлы раздач всех доверенных лиц через запятую")
+	out := fs.String("out", "", "куда сохранить долю ключа")
+	electionPath := fs.String("election", "", "куда сохранить публичные параметры выборов")
+	_ = fs.Parse(args)
+	if *keyPath == "" || *dealings == "" || *out == "" || *electionPath == "" {
+		usage()
+	}
+
+	var kf trusteeKeyFile
+	readFile(*keyPath, &kf)
+
+	paths := splitList(*dealings)
+	var (
+		commits []*triptych.DealerCommitment
+		shares  []*triptych.Scalar
+		t, n    int
+	)
+	seen := make(map[int]bool)
+	for _, p := range paths {
+		var df dealingFile
+		readFile(p, &df)
+		if df.Dealing == nil || df.Dealing.Commitment == nil {
+			log.Fatalf("%s: empty dealing", p)
+		}
+		if t == 0 {
+			t, n = df.Threshold, df.Trustees
+		}
+		dealer := df.Dealing.Commitment.Dealer
+		if df.Threshold != t || df.Trustees != n || len(df.Dealing.Shares) != n {
+			log.Fatalf("%s: parameters of dealer %d differ from the others", p, dealer)
+		}
+		if seen[dealer] {
+			log.Fatalf("%s: duplicate dealing from trustee %d", p, dealer)
+		}
+		seen[dealer] = true
+		if !triptych.VerifyDealerCommitment(df.Dealing.Commitment, t) {
+			log.Fatalf("%s: invalid commitment of dealer %d", p, dealer)
+		}
+		s, err := df.Dealing.OpenShare(kf.Index, kf.TransportSecret)
+		if err != nil {
+			log.Fatalf("%s: share from dealer %d: %v", p, dealer, err)
+		}
+		commits = append(commits, df.Dealing.Commitment)
+		shares = append(shares, s)
+	}
+	if len(commits) != n {
+		log.Fatalf("expected %d dealings, got %d", n, len(commits))
+	}
+	sort.Slice(commits, func(i, j int) bool { return commits[i].Dealer < commits[j].Dealer })
+
+	sf := shareFile{
+		Index:     kf.Index,
+		Threshold: t,
+		Trustees:  n,
+		Share:     triptych.CombineKeyShares(shares),
+		PublicKey: triptych.DKGPublicKey(commits),
+	}
+	if !triptych.ScalarBaseMult(sf.Share).Equal(triptych.VerificationKey(commits, kf.Index)) {
+		log.Fatalf("combined share does not match verification key")
+	}
+	writeFile(*out, sf, 0o600)
+	writeFile(*electionPath, electionFile{
+		PublicKey:   sf.PublicKey,
+		Threshold:   t,
+		Trustees:    n,
+		Commitments: commits,
+		CreatedAt:   time.Now().Format(time.RFC3339),
+	}, 0o644)
+
+	pk, _ := sf.PublicKey.MarshalText()
+	fmt.Printf("Key share saved to %s\n", *out)
+	fmt.Printf("Election public key: %s\n", pk)
+}
+
+func runDecrypt(args []string) {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	sharePath := fs.String("share", "", "файл с долей ключа")
+	electionPath := fs.String("election", "", "публичные параметры выборов")
+	baseURL := fs.String("url", "", "базовый URL бэкенда")
+	ballotsPath := fs.String("ballots", "", "JSON-файл со списком зашифрованных бюллетеней (base64); по умолчанию загружаются с сервера")
+	maxChoices := fs.Int("max-choices", 0, "правило выборов для зашифрованных бюллетеней: 0 — ровно одна отметка, k — не больше k отметок")
+	out := fs.String("out", "", "куда сохранить частичную расшифровку")
+	_ = fs.Parse(args)
+	if *sharePath == "" || *electionPath == "" || *baseURL == "" || *out == "" {
+		usage()
+	}
+
+	var sf shareFile
+	readFile(*sharePath, &sf)
+	var ef electionFile
+	readFile(*electionPath, &ef)
+	if sf.Share == nil || ef.PublicKey == nil || !sf.PublicKey.Equal(ef.PublicKey) {
+		log.Fatalf("share does not belong to this election")
+	}
+
+	cands := fetchCandidates(*baseURL)
+	ballots := loadBallots(*baseURL, *ballotsPath, ef.PublicKey, len(cands), *maxChoices)
+	sums, err := triptych.SumBallots(ballots, len(cands))
+	if err != nil {
+		log.Fatalf("sum ballots: %v", err)
+	}
+
+	ids := make([]string, len(cands))
+	for i, c := range cands {
+		ids[i] = c.ID
+	}
+	writeFile(*out, partialFile{
+		Trustee:     sf.Index,
+		Ballots:     len(ballots),
+		Candidates:  ids,
+		Ciphertexts: sums,
+		Share:       triptych.PartialDecrypt(sf.Index, sf.Share, sums),
+	}, 0o644)
+	fmt.Printf("Partial decryption of %d ballots saved to %s\n", len(ballots), *out)
+}
+
+func fetchCandidates(baseURL string) []CandidateDTO {
+	var cands []CandidateDTO
+	if err := getJSON(strings.TrimRight(baseURL, "/")+"/api/candidate", &cands); err != nil {
+		log.Fatalf("fetch candidates: %v", err)
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].ID < cands[j].ID })
+	return cands
+}
+
+func loadBallots(baseURL, path string, pk *triptych.Point, candidates, maxChoices int) []*triptych.EncryptedBallot {
+	minC, maxC := triptych.ChoiceBounds(maxChoices)
+	var encoded []string
+	if path != "" {
+		readFile(path, &encoded)
+	} else if err := getJSON(strings.TrimRight(baseURL, "/")+"/api/bulletin/encrypted", &encoded); err != nil {
+		log.Fatalf("fetch ballots: %v", err)
+	}
+
+	ballots := make([]*triptych.EncryptedBallot, 0, len(encoded))
+	for i, e := range encoded {
+		raw, err := base64.StdEncoding.DecodeString(e)
+		if err != nil {
+			log.Printf("ballot %d skipped: bad base64: %v", i, err)
+			continue
+		}
+		eb, err := triptych.ParseEncryptedBallot(raw)
+		if err != nil {
+			log.Printf("ballot %d skipped: %v", i, err)
+			continue
+		}
+		if len(eb.Ciphertexts) != candidates {
+			log.Printf("ballot %d skipped: %d ciphertexts for %d candidates", i, len(eb.Ciphertexts), candidates)
+			continue
+		}
+		if err := triptych.VerifyEncryptedBallot(pk, eb, minC, maxC); err != nil {
+			log.Printf("ballot %d skipped: %v", i, err)
+			continue
+		}
+		ballots = append(ballots, eb)
+	}
+	return ballots
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func readFile(path string, v interface{}) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		log.Fatalf("parse %s: %v", path, err)
+	}
+}
+
+func writeFile(path string, v interface{}, perm os.FileMode) {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	if err := os.WriteFile(path, b, perm); err != nil {
+		log.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func getJSON(url string, out interface{}) error {
+	client := &http.Client{Timeout: 15 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("http %d", res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// POST /verify/batch takes a JSON array of verify requests and answers in
+// the same order, either as one JSON array or, with ?stream=1 or
+// Accept: application/x-ndjson, one result per line as soon as it and all
+// before it are done. Identical rings are parsed once per batch. With
+// ?record=true each valid item claims its key image as /verify does; two
+// items with the same key image race and one of them gets 409.
+
+const (
+	maxBatchItems = 100000
+	// batchIOTimeout replaces the server timeouts for a batch: the body may
+	// take long to upload and the results long to compute, so the deadlines
+	// are moved forward as the batch makes progress.
+	batchIOTimeout = 15 * time.Second
+)
+
+var errItemTooLarge = errors.New("batch item is over the -max-body limit")
+
+// itemLimit bounds each item of a batch to -max-body instead of the whole
+// body, which may be long: the decoder may read at most that far past the
+// start of the item it is on.
+type itemLimit struct {
+	r    io.Reader
+	read int64
+	stop int64
+}
+
+func (l *itemLimit) Read(p []byte) (int, error) {
+	if l.read >= l.stop {
+		return 0, errItemTooLarge
+	}
+	if rest := l.stop - l.read; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	return n, err
+}
+
+// verifySlots bounds the verifications running at once across all batches.
+var verifySlots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// BatchResult is one answer of a batch; Status is the code /verify would
+// have returned for the item.
+type BatchResult struct {
+	Index  int `json:"index"`
+	Status int `json:"status"`
+	VerifyResponse
+}
+
+// batchItem keeps the ring as raw JSON so identical rings can be found
+// before they are parsed.
+type batchItem struct {
+	VerifyRequest
+	Ring json.RawMessage `json:"ring"`
+}
+
+// ringCache parses each distinct ring of a batch once.
+type ringCache map[string][]*triptych.Point
+
+func (c ringCache) get(raw json.RawMessage) ([]*triptych.Point, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var key bytes.Buffer
+	if err := json.Compact(&key, raw); err != nil {
+		return nil, err
+	}
+	if ring, ok := c[key.String()]; ok {
+		return ring, nil
+	}
+	var ring ringKeys
+	if err := json.Unmarshal(raw, &ring); err != nil {
+		return nil, err
+	}
+	c[key.String()] = ring
+	return ring, nil
+}
+
+func handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	record, ok := wantRecord(w, r)
+	if !ok {
+		return
+	}
+	stream := r.URL.Query().Get("stream") == "1" || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(batchIOTimeout))
+	if stream {
+		// Results go out while the rest of the body is still being read.
+		_ = rc.EnableFullDuplex()
+	}
+
+	lim := &itemLimit{r: r.Body, stop: cfg.MaxBody}
+	dec := json.NewDecoder(lim)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "body must be a JSON array"})
+		return
+	}
+
+	start := time.Now()
+	// pending carries one channel per item, in order; the writer drains them
+	// while the reader is still decoding.
+	pending := make(chan chan BatchResult, cap(verifySlots))
+	done := make(chan int)
+	go writeBatch(w, rc, stream, pending, done)
+
+	batchRings := ringCache{}
+	var failed string
+	failCode := http.StatusBadRequest
+items:
+	for i := 0; dec.More(); i++ {
+		_ = rc.SetReadDeadline(time.Now().Add(batchIOTimeout))
+		if i == maxBatchItems {
+			failed = fmt.Sprintf("batch is limited to %d items", maxBatchItems)
+			break
+		}
+		lim.stop = dec.InputOffset() + cfg.MaxBody
+		var item batchItem
+		if err := dec.Decode(&item); err != nil {
+			failed = "bad json: " + err.Error()
+			if errors.Is(err, errItemTooLarge) {
+				failCode = http.StatusRequestEntityTooLarge
+			}
+			break
+		}
+		out := make(chan BatchResult, 1)
+		select {
+		case pending <- out:
+		case <-r.Context().Done():
+			failed = "client went away"
+			break items
+		}
+		ring, err := batchRings.get(item.Ring)
+		if err != nil {
+			code := http.StatusBadRequest
+			if errors.Is(err, errRingTooLarge) {
+				code = http.StatusRequestEntityTooLarge
+			}
+			out <- BatchResult{Index: i, Status: code, VerifyResponse: VerifyResponse{OK: false, Error: "bad ring: " + err.Error()}}
+			continue
+		}
+		req := item.VerifyRequest
+		req.Ring = ring
+		verifySlots <- struct{}{}
+		go func(i int) {
+			defer func() { <-verifySlots }()
+			code, res := guard("batch", func() (int, VerifyResponse) {
+				code, res := verify(&req, func(string, ...interface{}) {})
+				if record {
+					code, res = recordResult(&req, code, res)
+				}
+				return code, res
+			})
+			out <- BatchResult{Index: i, Status: code, VerifyResponse: res}
+		}(i)
+	}
+	if failed != "" {
+		out := make(chan BatchResult, 1)
+		out <- BatchResult{Index: -1, Status: failCode, VerifyResponse: VerifyResponse{OK: false, Error: failed}}
+		pending <- out
+	}
+	close(pending)
+	n := <-done
+	log.Printf("[batch] %d items, %d distinct rings, stream=%v (%.3fs) %s", n, len(batchRings), stream, time.Since(start).Seconds(), failed)
+}
+
+// writeBatch writes the results in order and reports how many it wrote. A
+// batch cut short by bad input ends with a result of index -1; in array
+// mode that turns the whole answer into an error.
+func writeBatch(w http.ResponseWriter, rc *http.ResponseController, stream bool, pending <-chan chan BatchResult, done chan<- int) {
+	var all []BatchResult
+	n := 0
+	enc := json.NewEncoder(w)
+	if stream {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+	for out := range pending {
+		res := <-out
+		if res.Index >= 0 {
+			n++
+		}
+		if !stream {
+			all = append(all, res)
+			continue
+		}
+		_ = rc.SetWriteDeadline(time.Now().Add(batchIOTimeout))
+		_ = enc.Encode(res)
+		_ = rc.Flush()
+	}
+	if !stream {
+		_ = rc.SetWriteDeadline(time.Now().Add(batchIOTimeout))
+		if k := len(all); k > 0 && all[k-1].Index < 0 {
+			writeJSON(w, all[k-1].Status, all[k-1].VerifyResponse)
+		} else {
+			if all == nil {
+				all = []BatchResult{}
+			}
+			writeJSON(w, http.StatusOK, all)
+		}
+	}
+	done <- n
+}
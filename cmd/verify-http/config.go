@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Every setting is a flag. A flag not given on the command line is taken
+// from the environment as VERIFY_HTTP_<NAME> (max-body -> VERIFY_HTTP_MAX_BODY),
+// then from the -config file, a JSON object keyed by flag name:
+//
+//	{"addr": ":8443", "tls-cert": "cert.pem", "tls-key": "key.pem", "max-ring": 4096, "write-timeout": "30s"}
+
+type config struct {
+	Addr            string
+	TLSCert         string
+	TLSKey          string
+	ClientCA        string
+	MaxBody         int64
+	MaxRing         int
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+
+	RingsDir          string
+	RingCacheKeys     int
+	JobsJournal       string
+	JobQueue          int
+	JobWorkers        int
+	WebhookSecretFile string
+	CallbackHosts     string
+	KeyImages         string
+}
+
+// cfg is the configuration the handlers use; main loads it.
+var cfg config
+
+const envPrefix = "VERIFY_HTTP_"
+
+func loadConfig() error {
+	flag.StringVar(&cfg.Addr, "addr", ":8088", "адрес HTTP-сервера")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", "", "сертификат TLS (PEM); вместе с -tls-key включает HTTPS")
+	flag.StringVar(&cfg.TLSKey, "tls-key", "", "закрытый ключ TLS (PEM)")
+	flag.StringVar(&cfg.ClientCA, "client-ca", "", "сертификаты УЦ клиентов (PEM); если задан, без клиентского сертификата (mTLS) не пускать")
+	flag.Int64Var(&cfg.MaxBody, "max-body", 64<<20, "предельный размер тела запроса в байтах; для пакета — одного элемента")
+	flag.IntVar(&cfg.MaxRing, "max-ring", 1<<20, "предельное число ключей в кольце")
+	flag.DurationVar(&cfg.ReadTimeout, "read-timeout", 15*time.Second, "таймаут чтения запроса")
+	flag.DurationVar(&cfg.WriteTimeout, "write-timeout", 15*time.Second, "таймаут записи ответа")
+	flag.DurationVar(&cfg.IdleTimeout, "idle-timeout", 60*time.Second, "сколько держать простаивающее keep-alive соединение")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "сколько ждать завершения текущих запросов после SIGTERM")
+	flag.StringVar(&cfg.RingsDir, "rings-dir", "", "каталог для сохранения зарегистрированных колец; пусто — только в памяти")
+	flag.IntVar(&cfg.RingCacheKeys, "ring-cache-keys", 1<<20, "сколько ключей колец держать разобранными в памяти (LRU)")
+	flag.StringVar(&cfg.JobsJournal, "jobs-journal", "", "журнал фоновых заданий проверки; пусто — только в памяти, после перезапуска задания теряются")
+	flag.IntVar(&cfg.JobQueue, "job-queue", 1000, "сколько заданий может ждать в очереди; сверх этого — 503")
+	flag.IntVar(&cfg.JobWorkers, "job-workers", runtime.GOMAXPROCS(0), "число обработчиков фоновых заданий")
+	flag.StringVar(&cfg.WebhookSecretFile, "webhook-secret-file", "", "файл с секретом HMAC для подписи обратных вызовов; без него callbackUrl не принимается")
+	flag.StringVar(&cfg.CallbackHosts, "callback-hosts", "", "хосты через запятую, на которые разрешены обратные вызовы; пусто — любые, кроме локальных и частных адресов")
+	flag.StringVar(&cfg.KeyImages, "key-images", "", "файл реестра образов ключей для /verify?record=true; пусто — реестр выключен")
+	configPath := flag.String("config", "", "файл настроек JSON с ключами по именам флагов (переменная "+envPrefix+"CONFIG)")
+	flag.Parse()
+
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if !given["config"] {
+		*configPath = os.Getenv(envPrefix + "CONFIG")
+	}
+	file := map[string]string{}
+	if *configPath != "" {
+		var err error
+		if file, err = readConfigFile(*configPath); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	flag.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] || f.Name == "config" {
+			return
+		}
+		from := envName(f.Name)
+		v, ok := os.LookupEnv(from)
+		if !ok {
+			from = *configPath + ": " + f.Name
+			v, ok = file[f.Name]
+		}
+		if ok {
+			if err := f.Value.Set(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s=%q: %v", from, v, err))
+			}
+		}
+	})
+	for name := range file {
+		if name == "config" || flag.Lookup(name) == nil {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", *configPath, name))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	switch {
+	case (cfg.TLSCert == "") != (cfg.TLSKey == ""):
+		return errors.New("tls-cert and tls-key go together")
+	case cfg.ClientCA != "" && cfg.TLSCert == "":
+		return errors.New("client-ca needs tls-cert and tls-key")
+	case cfg.MaxBody <= 0:
+		return errors.New("max-body must be positive")
+	case cfg.MaxRing < 2:
+		return errors.New("max-ring must be at least 2")
+	}
+	return nil
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// readConfigFile returns the settings as the strings a flag would get, so
+// numbers and booleans may be written bare and durations as "15s".
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	out := make(map[string]string, len(raw))
+	for name, v := range raw {
+		var s string
+		if json.Unmarshal(v, &s) != nil {
+			s = string(v)
+		}
+		out[name] = s
+	}
+	return out, nil
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// Jobs verify in the background for callers that cannot wait out the HTTP
+// timeouts. POST /jobs/verify takes a verify request, or
+// {"requests": [...]} for several, plus an optional callbackUrl, and
+// answers 202 with the job id; GET /jobs/{id} reports progress and, once
+// done, the results in the batch format. The queue is bounded and answers
+// 503 when full. With -jobs-journal every state change goes to a journal,
+// so after a restart unfinished jobs run again and undelivered callbacks
+// are retried.
+//
+// A callback is a POST of the finished job with
+//
+//	X-Verify-Timestamp: <unix seconds>
+//	X-Verify-Signature: sha256=<hex HMAC-SHA256(secret, timestamp + "." + body)>
+
+const (
+	jobRetention     = 24 * time.Hour
+	callbackAttempts = 5
+	// maxJournalLine only caps the scanner buffer, which grows as needed; a
+	// submit line is about as long as the -max-body it came in under.
+	maxJournalLine = 1 << 30
+)
+
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+
+	callbackPending   = "pending"
+	callbackDelivered = "delivered"
+	callbackFailed    = "failed"
+)
+
+var errQueueFull = errors.New("job queue is full")
+
+type JobRequest struct {
+	VerifyRequest
+	Requests    []VerifyRequest `json:"requests,omitempty"`
+	CallbackURL string          `json:"callbackUrl,omitempty"`
+}
+
+type Job struct {
+	ID          string        `json:"id"`
+	Status      string        `json:"status"`
+	Total       int           `json:"total"`
+	Done        int           `json:"done"`
+	Progress    float64       `json:"progress"`
+	QueuedAt    time.Time     `json:"queuedAt"`
+	StartedAt   time.Time     `json:"startedAt,omitzero"`
+	FinishedAt  time.Time     `json:"finishedAt,omitzero"`
+	Results     []BatchResult `json:"results,omitempty"`
+	CallbackURL string        `json:"callbackUrl,omitempty"`
+	Callback    string        `json:"callback,omitempty"`
+
+	requests []VerifyRequest
+}
+
+// jobRecord is one journal line. A job is a submit record, then a done
+// record with the results, then a callback record if it has a callback.
+type jobRecord struct {
+	Op          string          `json:"op"`
+	ID          string          `json:"id"`
+	At          time.Time       `json:"at"`
+	Requests    []VerifyRequest `json:"requests,omitempty"`
+	CallbackURL string          `json:"callbackUrl,omitempty"`
+	Results     []BatchResult   `json:"results,omitempty"`
+	Callback    string          `json:"callback,omitempty"`
+}
+
+type jobQueue struct {
+	secret []byte
+	client *http.Client
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	queue   chan *Job
+	journal *os.File
+
+	// callbackHosts, when set, are the only hosts callbacks may go to;
+	// otherwise any host is allowed but not a loopback or private address.
+	callbackHosts map[string]bool
+}
+
+// jobs is the queue the handlers use; main sets it up.
+var jobs *jobQueue
+
+// newJobQueue starts the workers. With a journal path it first replays and
+// compacts the journal and requeues what was not finished; without one the
+// jobs live only in memory and are lost on restart.
+func newJobQueue(path string, size, workers int, secret []byte, callbackHosts []string) (*jobQueue, error) {
+	q := &jobQueue{
+		secret: secret,
+		client: callbackClient(len(callbackHosts) == 0),
+		jobs:   map[string]*Job{},
+	}
+	if len(callbackHosts) > 0 {
+		q.callbackHosts = map[string]bool{}
+		for _, h := range callbackHosts {
+			q.callbackHosts[strings.ToLower(h)] = true
+		}
+	}
+	var requeue []*Job
+	if path != "" {
+		live, err := q.openJournal(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range live {
+			switch {
+			case j.Status != jobDone:
+				requeue = append(requeue, j)
+			case j.Callback == callbackPending:
+				go q.deliver(j)
+			}
+		}
+		log.Printf("[jobs] journal %s: %d jobs kept, %d requeued", path, len(live), len(requeue))
+	}
+	// Jobs from the journal never count against the limit for new ones.
+	if len(requeue) > size {
+		size += len(requeue)
+	}
+	q.queue = make(chan *Job, size)
+	for _, j := range requeue {
+		q.queue <- j
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q, nil
+}
+
+// openJournal replays the journal, rewrites it with only the jobs still
+// worth keeping, opens it for appending and returns those jobs.
+func (q *jobQueue) openJournal(path string) ([]*Job, error) {
+	var order []*Job
+	if f, err := os.Open(path); err == nil {
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, maxJournalLine)
+		for sc.Scan() {
+			var rec jobRecord
+			if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+				log.Printf("[jobs] skipping bad journal line: %v", err)
+				continue
+			}
+			j := q.jobs[rec.ID]
+			switch {
+			case rec.Op == "submit":
+				j = &Job{ID: rec.ID, Status: jobQueued, Total: len(rec.Requests), QueuedAt: rec.At, CallbackURL: rec.CallbackURL, requests: rec.Requests}
+				if j.CallbackURL != "" {
+					j.Callback = callbackPending
+				}
+				q.jobs[rec.ID] = j
+				order = append(order, j)
+			case j == nil:
+			case rec.Op == "done":
+				j.Status, j.Total, j.Done, j.FinishedAt, j.Results, j.requests = jobDone, len(rec.Results), len(rec.Results), rec.At, rec.Results, nil
+			case rec.Op == "callback":
+				j.Callback = rec.Callback
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var live []*Job
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, j := range order {
+		if j.Status == jobDone && time.Since(j.FinishedAt) > jobRetention {
+			delete(q.jobs, j.ID)
+			continue
+		}
+		_ = enc.Encode(jobRecord{Op: "submit", ID: j.ID, At: j.QueuedAt, Requests: j.requests, CallbackURL: j.CallbackURL})
+		if j.Status == jobDone {
+			_ = enc.Encode(jobRecord{Op: "done", ID: j.ID, At: j.FinishedAt, Results: j.Results})
+			if j.Callback != callbackPending && j.Callback != "" {
+				_ = enc.Encode(jobRecord{Op: "callback", ID: j.ID, At: j.FinishedAt, Callback: j.Callback})
+			}
+		}
+		live = append(live, j)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	f.Close()
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	if q.journal, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600); err != nil {
+		return nil, err
+	}
+	return live, nil
+}
+
+func (q *jobQueue) record(rec jobRecord) error {
+	if q.journal == nil {
+		return nil
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := q.journal.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return q.journal.Sync()
+}
+
+func (q *jobQueue) submit(reqs []VerifyRequest, callback string) (*Job, error) {
+	var raw [16]byte
+	_, _ = rand.Read(raw[:])
+	j := &Job{ID: hex.EncodeToString(raw[:]), Status: jobQueued, Total: len(reqs), QueuedAt: time.Now().UTC(), CallbackURL: callback, requests: reqs}
+	if callback != "" {
+		j.Callback = callbackPending
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for id, old := range q.jobs {
+		if old.Status == jobDone && time.Since(old.FinishedAt) > jobRetention {
+			delete(q.jobs, id)
+		}
+	}
+	if len(q.queue) == cap(q.queue) {
+		return nil, errQueueFull
+	}
+	if err := q.record(jobRecord{Op: "submit", ID: j.ID, At: j.QueuedAt, Requests: reqs, CallbackURL: callback}); err != nil {
+		return nil, err
+	}
+	q.jobs[j.ID] = j
+	q.queue <- j
+	return j, nil
+}
+
+// get returns a snapshot of the job that is safe to encode.
+func (q *jobQueue) get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.snapshot(), true
+}
+
+// snapshot copies the job under q.mu and fills in Progress.
+func (j *Job) snapshot() Job {
+	snap := *j
+	snap.requests = nil
+	if snap.Total > 0 {
+		snap.Progress = float64(snap.Done) / float64(snap.Total)
+	}
+	return snap
+}
+
+func (q *jobQueue) work() {
+	for j := range q.queue {
+		q.mu.Lock()
+		j.Status, j.StartedAt = jobRunning, time.Now().UTC()
+		reqs := j.requests
+		q.mu.Unlock()
+
+		results := make([]BatchResult, len(reqs))
+		for i := range reqs {
+			verifySlots <- struct{}{}
+			// A panic fails only this item, so the job still ends with a
+			// "done" record and is not requeued on every start.
+			code, res := guard("jobs", func() (int, VerifyResponse) {
+				return verify(&reqs[i], func(string, ...interface{}) {})
+			})
+			<-verifySlots
+			results[i] = BatchResult{Index: i, Status: code, VerifyResponse: res}
+			q.mu.Lock()
+			j.Done = i + 1
+			q.mu.Unlock()
+		}
+
+		q.mu.Lock()
+		j.Status, j.FinishedAt, j.Results, j.requests = jobDone, time.Now().UTC(), results, nil
+		err := q.record(jobRecord{Op: "done", ID: j.ID, At: j.FinishedAt, Results: results})
+		q.mu.Unlock()
+		if err != nil {
+			log.Printf("[jobs] journal: %v", err)
+		}
+		log.Printf("[jobs] %s done: %d items (%.3fs)", j.ID, len(results), j.FinishedAt.Sub(j.StartedAt).Seconds())
+		if j.CallbackURL != "" {
+			go q.deliver(j)
+		}
+	}
+}
+
+// deliver posts the finished job to its callback URL, retrying with
+// backoff, and journals the outcome.
+func (q *jobQueue) deliver(j *Job) {
+	q.mu.Lock()
+	body, _ := json.Marshal(j.snapshot())
+	q.mu.Unlock()
+
+	state := callbackFailed
+	// A journaled job may point where the current settings no longer allow.
+	attempts := callbackAttempts
+	if err := q.checkCallback(j.CallbackURL); err != nil {
+		log.Printf("[jobs] %s callback: %v", j.ID, err)
+		attempts = 0
+	}
+	for attempt, wait := 1, time.Second; attempt <= attempts; attempt, wait = attempt+1, wait*2 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, q.secret)
+		mac.Write([]byte(ts + "."))
+		mac.Write(body)
+		req, _ := http.NewRequest(http.MethodPost, j.CallbackURL, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Verify-Timestamp", ts)
+		req.Header.Set("X-Verify-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		res, err := q.client.Do(req)
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode/100 == 2 {
+				state = callbackDelivered
+				break
+			}
+			err = errors.New(res.Status)
+		}
+		log.Printf("[jobs] %s callback attempt %d: %v", j.ID, attempt, err)
+		if attempt < attempts {
+			time.Sleep(wait)
+		}
+	}
+
+	q.mu.Lock()
+	j.Callback = state
+	err := q.record(jobRecord{Op: "callback", ID: j.ID, At: time.Now().UTC(), Callback: state})
+	q.mu.Unlock()
+	if err != nil {
+		log.Printf("[jobs] journal: %v", err)
+	}
+	log.Printf("[jobs] %s callback %s", j.ID, state)
+}
+
+var (
+	errCallbackURL  = errors.New("callback URL must be an absolute http or https URL")
+	errCallbackHost = errors.New("callback host is not allowed")
+	errCallbackAddr = errors.New("callback address is loopback, private or otherwise internal")
+)
+
+// checkCallback vets a callback URL before it is accepted or called. With
+// no host allowlist an IP literal is refused here if it is internal; host
+// names are checked again after resolution, when the client dials.
+func (q *jobQueue) checkCallback(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errCallbackURL
+	}
+	host := strings.ToLower(u.Hostname())
+	if q.callbackHosts != nil {
+		if !q.callbackHosts[host] {
+			return errCallbackHost
+		}
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errCallbackAddr
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && internalAddr(ip) {
+		return errCallbackAddr
+	}
+	return nil
+}
+
+func internalAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsMulticast()
+}
+
+// callbackClient never follows redirects or uses a proxy, so the address it
+// dials is the one that was checked; with guard set it also refuses to
+// connect to an internal address, whatever the host name resolved to.
+func callbackClient(guard bool) *http.Client {
+	d := &net.Dialer{Timeout: 5 * time.Second}
+	if guard {
+		d.Control = func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || internalAddr(ap.Addr()) {
+				return errCallbackAddr
+			}
+			return nil
+		}
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = nil
+	tr.DialContext = d.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: tr,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// checkJobRequest rejects at submit time what verify would reject as
+// malformed, so a job only ever queues and journals requests that parse.
+func checkJobRequest(req *VerifyRequest) error {
+	if req.N <= 1 || req.M <= 0 || (len(req.Ring) == 0 && req.RingID == nil) || (req.Message == "" && req.MessageB64 == "") || req.SignatureB64 == "" {
+		return errors.New("missing fields")
+	}
+	N := 1
+	for i := 0; i < req.M; i++ {
+		if N > cfg.MaxRing/req.N {
+			return fmt.Errorf("ring size n^m is over the limit of %d keys", cfg.MaxRing)
+		}
+		N *= req.N
+	}
+	if len(req.Ring) > 0 && len(req.Ring) != N {
+		return fmt.Errorf("ring length must be n^m=%d", N)
+	}
+	for i, P := range req.Ring {
+		if P.IsIdentity() {
+			return fmt.Errorf("ring[%d] bad key", i)
+		}
+	}
+	if req.MessageB64 != "" {
+		if _, err := base64.StdEncoding.DecodeString(req.MessageB64); err != nil {
+			return errors.New("bad message base64")
+		}
+	}
+	blob, err := base64.StdEncoding.DecodeString(req.SignatureB64)
+	if err != nil || len(blob) < 33 {
+		return errors.New("bad signature base64")
+	}
+	if _, err := triptych.Deserialize(blob[33:], req.M, req.N, blob[:33]); err != nil {
+		return fmt.Errorf("deserialize: %v", err)
+	}
+	return nil
+}
+
+func handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	if !decodeBody(w, r, &req, "jobs") {
+		return
+	}
+	reqs := req.Requests
+	if len(reqs) == 0 {
+		reqs = []VerifyRequest{req.VerifyRequest}
+	} else if len(reqs) > maxBatchItems {
+		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "too many requests in one job"})
+		return
+	}
+	for i := range reqs {
+		if err := checkJobRequest(&reqs[i]); err != nil {
+			writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: fmt.Sprintf("requests[%d]: %v", i, err)})
+			return
+		}
+	}
+	if req.CallbackURL != "" {
+		if err := jobs.checkCallback(req.CallbackURL); err != nil {
+			writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "bad callbackUrl: " + err.Error()})
+			return
+		}
+		if len(jobs.secret) == 0 {
+			writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "callbacks are not configured on this server"})
+			return
+		}
+	}
+	j, err := jobs.submit(reqs, req.CallbackURL)
+	if errors.Is(err, errQueueFull) {
+		w.Header().Set("Retry-After", "5")
+		writeJSON(w, http.StatusServiceUnavailable, VerifyResponse{OK: false, Error: err.Error()})
+		return
+	} else if err != nil {
+		log.Printf("[jobs] submit: %v", err)
+		writeJSON(w, http.StatusInternalServerError, VerifyResponse{OK: false, Error: "cannot queue job"})
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, Job{ID: j.ID, Status: jobQueued, Total: j.Total, QueuedAt: j.QueuedAt, CallbackURL: j.CallbackURL, Callback: j.Callback})
+}
+
+func handleGetJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := jobs.get(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, VerifyResponse{OK: false, Error: "unknown job"})
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
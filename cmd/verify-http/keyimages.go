@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// The key-image registry lets /verify?record=true reject a second ballot
+// from the same signer atomically, instead of leaving it to the caller's
+// check-then-insert. Key images are scoped by election id and kept in an
+// append-only file (-key-images) that is replayed into an in-memory index
+// at start; requests without an electionId share the "" scope.
+// Elections with revoting must not use it: there a repeated key image is a
+// legitimate new ballot.
+
+type KeyImageRecord struct {
+	ElectionID string    `json:"electionId"`
+	UNumber    string    `json:"uNumber"`
+	FirstSeen  time.Time `json:"firstSeen"`
+}
+
+type KeyImageExport struct {
+	ElectionID string           `json:"electionId"`
+	Count      int              `json:"count"`
+	KeyImages  []KeyImageRecord `json:"keyImages"`
+}
+
+type keyImageRegistry struct {
+	mu    sync.Mutex
+	file  *os.File
+	seen  map[string]map[string]time.Time // election -> uNumber -> first seen
+	order map[string][]string             // election -> uNumbers in file order
+}
+
+// keyImages is the registry the handlers use; main sets it up.
+var keyImages *keyImageRegistry
+
+func newKeyImageRegistry(path string) (*keyImageRegistry, error) {
+	r := &keyImageRegistry{seen: map[string]map[string]time.Time{}, order: map[string][]string{}}
+	if f, err := os.Open(path); err == nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			var rec KeyImageRecord
+			if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+				// A torn last line from a crash; the ballot it was for got
+				// no answer, so dropping it is safe.
+				log.Printf("[keyimages] skipping bad line: %v", err)
+				continue
+			}
+			r.add(rec)
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r.file = f
+	n := 0
+	for _, m := range r.seen {
+		n += len(m)
+	}
+	log.Printf("[keyimages] %s: %d key images in %d elections", path, n, len(r.seen))
+	return r, nil
+}
+
+func (r *keyImageRegistry) add(rec KeyImageRecord) {
+	m := r.seen[rec.ElectionID]
+	if m == nil {
+		m = map[string]time.Time{}
+		r.seen[rec.ElectionID] = m
+	}
+	if _, dup := m[rec.UNumber]; dup {
+		return
+	}
+	m[rec.UNumber] = rec.FirstSeen
+	r.order[rec.ElectionID] = append(r.order[rec.ElectionID], rec.UNumber)
+}
+
+// record stores the key image if it is fresh. Otherwise it returns false
+// and when it was first seen.
+func (r *keyImageRegistry) record(electionID, uNumber string) (bool, time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if first, ok := r.seen[electionID][uNumber]; ok {
+		return false, first, nil
+	}
+	rec := KeyImageRecord{ElectionID: electionID, UNumber: uNumber, FirstSeen: time.Now().UTC()}
+	b, _ := json.Marshal(rec)
+	if _, err := r.file.Write(append(b, '\n')); err != nil {
+		return false, time.Time{}, err
+	}
+	if err := r.file.Sync(); err != nil {
+		return false, time.Time{}, err
+	}
+	r.add(rec)
+	return true, rec.FirstSeen, nil
+}
+
+func (r *keyImageRegistry) export(electionID string) KeyImageExport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := KeyImageExport{ElectionID: electionID, KeyImages: []KeyImageRecord{}}
+	for _, u := range r.order[electionID] {
+		out.KeyImages = append(out.KeyImages, KeyImageRecord{ElectionID: electionID, UNumber: u, FirstSeen: r.seen[electionID][u]})
+	}
+	out.Count = len(out.KeyImages)
+	return out
+}
+
+// recordResult applies ?record=true to a verification result: a valid
+// ballot is accepted only if its key image is new.
+func recordResult(req *VerifyRequest, code int, res VerifyResponse) (int, VerifyResponse) {
+	if !res.OK {
+		return code, res
+	}
+	fresh, first, err := keyImages.record(req.ElectionID, res.UNumber)
+	switch {
+	case err != nil:
+		log.Printf("[keyimages] record: %v", err)
+		return http.StatusInternalServerError, VerifyResponse{OK: false, UNumber: res.UNumber, Error: "cannot record key image"}
+	case !fresh:
+		log.Printf("[keyimages] duplicate uNum=%s in %q, first seen %s", res.UNumber, req.ElectionID, first.Format(time.RFC3339))
+		return http.StatusConflict, VerifyResponse{OK: false, UNumber: res.UNumber, Error: "key image already used", FirstSeen: first}
+	}
+	return code, res
+}
+
+// wantRecord reads ?record; it answers 400 itself when recording is asked
+// for but the registry is off.
+func wantRecord(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	v := r.URL.Query().Get("record")
+	if v == "" || v == "false" {
+		return false, true
+	}
+	if v != "true" && v != "1" {
+		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "record must be true or false"})
+		return false, false
+	}
+	if keyImages == nil {
+		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "key-image registry is disabled; start with -key-images"})
+		return false, false
+	}
+	return true, true
+}
+
+// handleExportKeyImages lists the key images of ?electionId= in the order
+// they were recorded, for audits against the published ballots.
+func handleExportKeyImages(w http.ResponseWriter, r *http.Request) {
+	if keyImages == nil {
+		writeJSON(w, http.StatusNotFound, VerifyResponse{OK: false, Error: "key-image registry is disabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, keyImages.export(r.URL.Query().Get("electionId")))
+}
@@ -1,48 +1,187 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
+	"syscall"
 	"time"
 
 	"coursach/triptych/triptych"
 )
 
 type VerifyRequest struct {
-	Message      string   `json:"message"`
-	SignatureB64 string   `json:"signatureB64"`
-	Ring         []string `json:"ring"`
-	N            int      `json:"n"`
-	M            int      `json:"m"`
+	Message      string          `json:"message"`
+	MessageB64   string          `json:"messageB64,omitempty"`
+	ElectionPK   *triptych.Point `json:"electionPublicKey,omitempty"`
+	Candidates   int             `json:"candidates,omitempty"`
+	ElectionID   string          `json:"electionId,omitempty"`
+	VotingOpens  time.Time       `json:"votingOpens,omitzero"`
+	VotingCloses time.Time       `json:"votingCloses,omitzero"`
+	RingDigest   *triptych.Hash  `json:"ringDigest,omitempty"`
+	SignatureB64 string          `json:"signatureB64"`
+	Ring         ringKeys        `json:"ring"`
+	N            int             `json:"n"`
+	M            int             `json:"m"`
+	// MinChoices and MaxChoices are the election's rule for encrypted
+	// ballots; they are required with ElectionPK.
+	MinChoices *int `json:"minChoices,omitempty"`
+	MaxChoices *int `json:"maxChoices,omitempty"`
+	// RingID names a ring registered with PUT /rings/{digest}; it replaces
+	// Ring, and the signature must be over the canonical order.
+	RingID *triptych.Hash `json:"ringId,omitempty"`
+}
+
+type RevealRequest struct {
+	Commitment *triptych.Point `json:"commitment"`
+	triptych.Reveal
+}
+
+// PossessionRequest is a signer registration: the backend issued Nonce and
+// checks it is fresh itself. With RegistrarKey set the registration also
+// needs a Credential that Revocations, if given, does not revoke, or a
+// blind Token for the key.
+type PossessionRequest struct {
+	ElectionID   string                     `json:"electionId"`
+	FullName     string                     `json:"fullName"`
+	PublicKey    *triptych.Point            `json:"publicKey"`
+	Nonce        string                     `json:"nonce"`
+	Proof        *triptych.SchnorrSignature `json:"proof"`
+	RegistrarKey *triptych.Point            `json:"registrarKey,omitempty"`
+	Credential   *triptych.Credential       `json:"credential,omitempty"`
+	Revocations  *triptych.RevocationList   `json:"revocations,omitempty"`
+	Token        *triptych.BlindSignature   `json:"token,omitempty"`
 }
 
 type VerifyResponse struct {
-	OK      bool   `json:"ok"`
-	UNumber string `json:"uNumber,omitempty"`
-	Error   string `json:"error,omitempty"`
+	OK      bool        `json:"ok"`
+	UNumber string      `json:"uNumber,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Ballot  *BallotInfo `json:"ballot,omitempty"`
+	// FirstSeen is set on a 409 from ?record=true.
+	FirstSeen time.Time `json:"firstSeen,omitzero"`
+}
+
+// BallotInfo is the parsed canonical ballot, returned so the backend stores
+// what was actually signed rather than what the client claimed.
+type BallotInfo struct {
+	ElectionID string                  `json:"electionId"`
+	Type       string                  `json:"type"`
+	Choices    []triptych.BallotChoice `json:"choices,omitempty"`
+	PayloadB64 string                  `json:"payloadB64,omitempty"`
+	Seq        uint32                  `json:"seq"`
+	CreatedAt  string                  `json:"createdAt"`
 }
 
 func main() {
+	if err := loadConfig(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	var err error
+	if cfg.KeyImages != "" {
+		if keyImages, err = newKeyImageRegistry(cfg.KeyImages); err != nil {
+			log.Fatalf("key images: %v", err)
+		}
+	}
+	if rings, err = newRingRegistry(cfg.RingsDir, cfg.RingCacheKeys); err != nil {
+		log.Fatalf("rings: %v", err)
+	}
+	var secret []byte
+	if cfg.WebhookSecretFile != "" {
+		if secret, err = os.ReadFile(cfg.WebhookSecretFile); err != nil {
+			log.Fatalf("webhook secret: %v", err)
+		}
+		secret = bytes.TrimSpace(secret)
+	}
+	var callbackHosts []string
+	for _, h := range strings.Split(cfg.CallbackHosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			callbackHosts = append(callbackHosts, h)
+		}
+	}
+	if jobs, err = newJobQueue(cfg.JobsJournal, cfg.JobQueue, cfg.JobWorkers, secret, callbackHosts); err != nil {
+		log.Fatalf("jobs: %v", err)
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
 	mux.HandleFunc("/verify", handleVerify)
+	mux.HandleFunc("/verify/batch", handleBatch)
+	mux.HandleFunc("PUT /rings/{digest}", handlePutRing)
+	mux.HandleFunc("GET /rings/{digest}", handleGetRing)
+	mux.HandleFunc("POST /jobs/verify", handleSubmitJob)
+	mux.HandleFunc("GET /jobs/{id}", handleGetJob)
+	mux.HandleFunc("GET /key-images", handleExportKeyImages)
+	mux.HandleFunc("/verify/reveal", handleReveal)
+	mux.HandleFunc("/verify/possession", handlePossession)
 
-	addr := ":8088"
-	log.Printf("verify-http listening on %s", addr)
 	s := &http.Server{
-		Addr:         addr,
+		Addr:         cfg.Addr,
 		Handler:      mux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	if cfg.TLSCert != "" {
+		s.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.ClientCA != "" {
+			pem, err := os.ReadFile(cfg.ClientCA)
+			if err != nil {
+				log.Fatalf("client CA: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				log.Fatalf("client CA: no certificates in %s", cfg.ClientCA)
+			}
+			s.TLSConfig.ClientCAs = pool
+			s.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	served := make(chan error, 1)
+	go func() {
+		if cfg.TLSCert != "" {
+			served <- s.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			served <- s.ListenAndServe()
+		}
+	}()
+	log.Printf("verify-http listening on %s (tls=%v mtls=%v)", cfg.Addr, cfg.TLSCert != "", cfg.ClientCA != "")
+	select {
+	case err := <-served:
+		log.Fatal(err)
+	case <-ctx.Done():
 	}
-	log.Fatal(s.ListenAndServe())
+	// A second signal kills the process without waiting.
+	stop()
+
+	// With a journal, queued and unfinished jobs resume on the next start;
+	// either way only the HTTP requests are drained.
+	log.Printf("shutting down, draining requests for up to %s", cfg.ShutdownTimeout)
+	sctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(sctx); err != nil {
+		log.Printf("shutdown: %v; closing the remaining connections", err)
+		_ = s.Close()
+	}
+	log.Printf("verify-http stopped")
 }
 
 func handleVerify(w http.ResponseWriter, r *http.Request) {
@@ -51,83 +190,268 @@ func handleVerify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	start := time.Now()
+	record, ok := wantRecord(w, r)
+	if !ok {
+		return
+	}
+
 	var req VerifyRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("[verify] bad json: %v", err)
-		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "bad json: " + err.Error()})
+	if !decodeBody(w, r, &req, "verify") {
 		return
 	}
+	code, res := verify(&req, log.Printf)
+	if record {
+		code, res = recordResult(&req, code, res)
+	}
+	writeJSON(w, code, res)
+}
+
+// verify checks one request; logf gets the per-request log lines, which a
+// batch drops.
+func verify(req *VerifyRequest, logf func(format string, v ...interface{})) (int, VerifyResponse) {
+	start := time.Now()
+	// N = n^m is the ring size; it is checked against -max-ring before any
+	// ring is loaded, and computed so it cannot overflow.
+	N := 1
+	for i := 0; i < req.M && req.N > 1; i++ {
+		if N > cfg.MaxRing/req.N {
+			logf("[verify] ring too large: n=%d m=%d", req.N, req.M)
+			return http.StatusRequestEntityTooLarge, VerifyResponse{OK: false, Error: fmt.Sprintf("ring size n^m is over the limit of %d keys", cfg.MaxRing)}
+		}
+		N *= req.N
+	}
+	if len(req.Ring) == 0 && req.RingID != nil {
+		ring, err := rings.get(*req.RingID)
+		if err != nil {
+			logf("[verify] ring %s: %v", hex.EncodeToString(req.RingID[:]), err)
+			return http.StatusNotFound, VerifyResponse{OK: false, Error: err.Error()}
+		}
+		req.Ring = ring
+	}
+	logf("[verify] new request: msg=%dB n=%d m=%d ring=%d",
+		len(req.Message)+len(req.MessageB64), req.N, req.M, len(req.Ring))
 
-	log.Printf("[verify] new request: msg=%q n=%d m=%d ring=%d",
-		req.Message, req.N, req.M, len(req.Ring))
+	if req.N <= 1 || req.M <= 0 || len(req.Ring) == 0 || (req.Message == "" && req.MessageB64 == "") || req.SignatureB64 == "" {
+		logf("[verify] missing fields")
+		return http.StatusBadRequest, VerifyResponse{OK: false, Error: "missing fields"}
+	}
 
-	if req.N <= 1 || req.M <= 0 || len(req.Ring) == 0 || req.Message == "" || req.SignatureB64 == "" {
-		log.Printf("[verify] missing fields")
-		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "missing fields"})
-		return
+	msg := []byte(req.Message)
+	if req.MessageB64 != "" {
+		b, err := base64.StdEncoding.DecodeString(req.MessageB64)
+		if err != nil {
+			logf("[verify] bad message b64: %v", err)
+			return http.StatusBadRequest, VerifyResponse{OK: false, Error: "bad message base64"}
+		}
+		msg = b
 	}
 
 	blob, err := base64.StdEncoding.DecodeString(req.SignatureB64)
 	if err != nil || len(blob) < 33 {
-		log.Printf("[verify] bad signature b64: %v", err)
-		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "bad signature base64"})
-		return
+		logf("[verify] bad signature b64: %v", err)
+		return http.StatusBadRequest, VerifyResponse{OK: false, Error: "bad signature base64"}
 	}
 	keyImg := blob[:33]
 	raw := blob[33:]
-	log.Printf("[verify] decoded signature: keyImg=%s raw=%d bytes",
+	logf("[verify] decoded signature: keyImg=%s raw=%d bytes",
 		hex.EncodeToString(keyImg), len(raw))
 
-	N := 1
-	for i := 0; i < req.M; i++ {
-		N *= req.N
-	}
 	if len(req.Ring) != N {
-		log.Printf("[verify] ring length mismatch: got=%d expected=%d", len(req.Ring), N)
-		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: fmt.Sprintf("ring length must be n^m=%d", N)})
-		return
+		logf("[verify] ring length mismatch: got=%d expected=%d", len(req.Ring), N)
+		return http.StatusBadRequest, VerifyResponse{OK: false, Error: fmt.Sprintf("ring length must be n^m=%d", N)}
 	}
-	ring := make([]*triptych.Point, N)
-	for i, hx := range req.Ring {
-		b, err := hex.DecodeString(hx)
+	ring := req.Ring
+	for i, P := range ring {
+		if P.IsIdentity() {
+			logf("[verify] ring[%d] bad pubkey", i)
+			return http.StatusBadRequest, VerifyResponse{OK: false, Error: fmt.Sprintf("ring[%d] bad key", i)}
+		}
+	}
+
+	var info *BallotInfo
+	encPayload := msg
+	if req.ElectionID != "" {
+		if req.MessageB64 == "" {
+			return http.StatusBadRequest, VerifyResponse{OK: false, Error: "ballot must be sent as messageB64"}
+		}
+		ballot, err := triptych.ParseBallot(msg)
 		if err != nil {
-			log.Printf("[verify] ring[%d] bad hex", i)
-			writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: fmt.Sprintf("ring[%d] bad hex", i)})
-			return
+			logf("[verify] bad ballot: %v", err)
+			return http.StatusBadRequest, VerifyResponse{OK: false, Error: "ballot: " + err.Error()}
+		}
+		if err := ballot.CheckContext(req.ElectionID, ring); err != nil {
+			logf("[verify] ballot context: %v", err)
+			return http.StatusOK, VerifyResponse{OK: false, Error: err.Error()}
+		}
+		if req.RingDigest != nil && ballot.RingDigest != *req.RingDigest {
+			return http.StatusOK, VerifyResponse{OK: false, Error: triptych.ErrNotSnapshot.Error()}
 		}
-		P, err := triptych.ParseCompressed(b)
+		if triptych.CheckWindow(req.VotingOpens, req.VotingCloses, time.Now()) != nil ||
+			triptych.CheckWindow(req.VotingOpens.Truncate(time.Second), req.VotingCloses, ballot.CreatedAt) != nil {
+			logf("[verify] ballot outside voting window: created %s", ballot.CreatedAt.Format(time.RFC3339))
+			return http.StatusOK, VerifyResponse{OK: false, Error: "ballot is outside the voting window"}
+		}
+		switch ballot.Type {
+		case triptych.BallotEncrypted:
+			if req.ElectionPK == nil {
+				return http.StatusOK, VerifyResponse{OK: false, Error: "encrypted ballots are not enabled"}
+			}
+			encPayload = ballot.Payload
+		default:
+			if req.ElectionPK != nil {
+				return http.StatusOK, VerifyResponse{OK: false, Error: "election requires encrypted ballots"}
+			}
+			if ballot.Type == triptych.BallotCommitment {
+				if _, err := triptych.ParseCompressed(ballot.Payload); err != nil {
+					return http.StatusBadRequest, VerifyResponse{OK: false, Error: "bad commitment: " + err.Error()}
+				}
+			}
+		}
+		info = &BallotInfo{
+			ElectionID: ballot.ElectionID,
+			Type:       ballot.Type.String(),
+			Choices:    ballot.Choices,
+			Seq:        ballot.Seq,
+			CreatedAt:  ballot.CreatedAt.Format(time.RFC3339),
+		}
+		if len(ballot.Payload) > 0 {
+			info.PayloadB64 = base64.StdEncoding.EncodeToString(ballot.Payload)
+		}
+	}
+
+	if req.ElectionPK != nil {
+		if req.MessageB64 == "" {
+			return http.StatusBadRequest, VerifyResponse{OK: false, Error: "encrypted ballot must be sent as messageB64"}
+		}
+		ballot, err := triptych.ParseEncryptedBallot(encPayload)
 		if err != nil {
-			log.Printf("[verify] ring[%d] bad pubkey", i)
-			writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: fmt.Sprintf("ring[%d] bad key", i)})
-			return
+			logf("[verify] bad encrypted ballot: %v", err)
+			return http.StatusBadRequest, VerifyResponse{OK: false, Error: "ballot: " + err.Error()}
+		}
+		if req.MinChoices == nil || req.MaxChoices == nil {
+			return http.StatusBadRequest, VerifyResponse{OK: false, Error: "encrypted ballots need the election's minChoices and maxChoices"}
+		}
+		if req.Candidates > 0 && len(ballot.Ciphertexts) != req.Candidates {
+			return http.StatusOK, VerifyResponse{OK: false, Error: fmt.Sprintf("ballot must have %d ciphertexts", req.Candidates)}
+		}
+		if err := triptych.VerifyEncryptedBallot(req.ElectionPK, ballot, *req.MinChoices, *req.MaxChoices); err != nil {
+			logf("[verify] invalid ballot proof: %v", err)
+			return http.StatusOK, VerifyResponse{OK: false, Error: "invalid ballot: " + err.Error()}
 		}
-		ring[i] = P
 	}
 
 	sig, err := triptych.Deserialize(raw, req.M, req.N, keyImg)
 	if err != nil {
-		log.Printf("[verify] deserialize error: %v", err)
-		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "deserialize: " + err.Error()})
-		return
+		logf("[verify] deserialize error: %v", err)
+		return http.StatusBadRequest, VerifyResponse{OK: false, Error: "deserialize: " + err.Error()}
 	}
 
-	ok, uNumBytes := triptych.VerifyTriptych(sig, []byte(req.Message), ring, req.N, req.M)
+	ok, uNumBytes := triptych.VerifyTriptych(sig, msg, ring, req.N, req.M)
 	if !ok {
-		log.Printf("[verify] signature invalid for msg=%s", req.Message)
-		writeJSON(w, http.StatusOK, VerifyResponse{OK: false, Error: "invalid signature"})
-		return
+		logf("[verify] signature invalid")
+		return http.StatusOK, VerifyResponse{OK: false, Error: "invalid signature"}
 	}
 
 	uNumHex := hex.EncodeToString(uNumBytes)
 	elapsed := time.Since(start)
-	log.Printf("[verify] signature OK for msg=%s uNum=%s (%.3fs)",
-		req.Message, uNumHex, elapsed.Seconds())
+	logf("[verify] signature OK uNum=%s (%.3fs)", uNumHex, elapsed.Seconds())
 
-	writeJSON(w, http.StatusOK, VerifyResponse{
-		OK:      true,
-		UNumber: uNumHex,
-	})
+	return http.StatusOK, VerifyResponse{OK: true, UNumber: uNumHex, Ballot: info}
+}
+
+// guard runs f and turns a panic into a 500 result. Batch items and jobs
+// verify on goroutines net/http does not protect, where a panic on one
+// request would take the process down.
+func guard(tag string, f func() (int, VerifyResponse)) (code int, res VerifyResponse) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("[%s] panic: %v\n%s", tag, p, debug.Stack())
+			code, res = http.StatusInternalServerError, VerifyResponse{OK: false, Error: "internal error"}
+		}
+	}()
+	return f()
+}
+
+func handleReveal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RevealRequest
+	if !decodeBody(w, r, &req, "reveal") {
+		return
+	}
+	if req.Commitment == nil || req.KeyImage == nil || req.Opening == nil || req.Proof == nil || req.CandidateID == "" {
+		log.Printf("[reveal] missing fields")
+		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "missing fields"})
+		return
+	}
+
+	uNumHex := hex.EncodeToString(req.KeyImage.BytesCompressed())
+	if err := triptych.VerifyReveal(req.Commitment, &req.Reveal); err != nil {
+		log.Printf("[reveal] rejected uNum=%s: %v", uNumHex, err)
+		writeJSON(w, http.StatusOK, VerifyResponse{OK: false, Error: err.Error()})
+		return
+	}
+	log.Printf("[reveal] OK uNum=%s candidate=%s", uNumHex, req.CandidateID)
+	writeJSON(w, http.StatusOK, VerifyResponse{OK: true, UNumber: uNumHex})
+}
+
+func handlePossession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PossessionRequest
+	if !decodeBody(w, r, &req, "possession") {
+		return
+	}
+	if req.PublicKey == nil || req.Proof == nil || req.ElectionID == "" || req.Nonce == "" {
+		log.Printf("[possession] missing fields")
+		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "missing fields"})
+		return
+	}
+	if err := triptych.VerifyPossession(req.PublicKey, req.ElectionID, req.FullName, []byte(req.Nonce), req.Proof); err != nil {
+		log.Printf("[possession] rejected %q: %v", req.FullName, err)
+		writeJSON(w, http.StatusOK, VerifyResponse{OK: false, Error: err.Error()})
+		return
+	}
+	if req.RegistrarKey != nil {
+		err := triptych.ErrBadCredential
+		if req.Token != nil {
+			err = triptych.VerifyEligibility(req.RegistrarKey, req.ElectionID, req.PublicKey, req.Token)
+		} else if l := req.Revocations; l != nil && (l.ElectionID != req.ElectionID || l.Verify(req.RegistrarKey) != nil) {
+			err = triptych.ErrBadRevocations
+		} else if req.Credential != nil {
+			err = req.Credential.Check(req.RegistrarKey, req.ElectionID, req.FullName, req.PublicKey, l)
+		}
+		if err != nil {
+			log.Printf("[possession] no credential for %q: %v", req.FullName, err)
+			writeJSON(w, http.StatusOK, VerifyResponse{OK: false, Error: err.Error()})
+			return
+		}
+	}
+	log.Printf("[possession] OK %q", req.FullName)
+	writeJSON(w, http.StatusOK, VerifyResponse{OK: true})
+}
+
+// decodeBody reads a JSON body of at most -max-body bytes and answers 400,
+// or 413 for a body or ring over the limits, itself.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}, tag string) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, cfg.MaxBody)).Decode(v)
+	if err == nil {
+		return true
+	}
+	log.Printf("[%s] bad json: %v", tag, err)
+	code := http.StatusBadRequest
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) || errors.Is(err, errRingTooLarge) {
+		code = http.StatusRequestEntityTooLarge
+	}
+	writeJSON(w, code, VerifyResponse{OK: false, Error: "bad json: " + err.Error()})
+	return false
 }
 
 func writeJSON(w http.ResponseWriter, code int, v interface{}) {
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"container/list"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"coursach/triptych/triptych"
+)
+
+// Rings are registered once with PUT /rings/{digest} and then named by
+// ringId in /verify. The id is triptych.RingDigest, which does not depend on
+// the order of the keys, so the registry keeps every ring in canonical
+// order and signatures made against it must use triptych.RingSignCanonical.
+// Parsed rings live in an LRU cache bounded by the total number of keys;
+// with -rings-dir they are also written to disk and reloaded on a miss, so
+// they survive eviction and restarts.
+
+var (
+	errUnknownRing  = errors.New("unknown ring; register it with PUT /rings/{digest} first")
+	errRingTooLarge = errors.New("ring is over the -max-ring limit")
+)
+
+// ringKeys is a ring in a request body. Its size is checked against
+// -max-ring before any key is decoded, as decoding a key decompresses a
+// point.
+type ringKeys []*triptych.Point
+
+func (r *ringKeys) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*r = nil
+		return nil
+	}
+	if len(raw) > cfg.MaxRing {
+		return fmt.Errorf("%w: %d keys, limit %d", errRingTooLarge, len(raw), cfg.MaxRing)
+	}
+	keys := make(ringKeys, len(raw))
+	for i, k := range raw {
+		if err := json.Unmarshal(k, &keys[i]); err != nil {
+			return fmt.Errorf("ring[%d]: %w", i, err)
+		}
+	}
+	*r = keys
+	return nil
+}
+
+type RingDTO struct {
+	RingID triptych.Hash `json:"ringId"`
+	Size   int           `json:"size"`
+}
+
+type ringEntry struct {
+	id   triptych.Hash
+	keys []*triptych.Point
+}
+
+type ringRegistry struct {
+	dir     string
+	maxKeys int
+
+	mu   sync.Mutex
+	keys int
+	lru  *list.List // of *ringEntry, most recently used first
+	byID map[triptych.Hash]*list.Element
+}
+
+func newRingRegistry(dir string, maxKeys int) (*ringRegistry, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &ringRegistry{dir: dir, maxKeys: maxKeys, lru: list.New(), byID: map[triptych.Hash]*list.Element{}}, nil
+}
+
+// rings is the registry the handlers use; main sets it up.
+var rings *ringRegistry
+
+// get returns the ring in canonical order. The slice is shared and must not
+// be modified.
+func (r *ringRegistry) get(id triptych.Hash) ([]*triptych.Point, error) {
+	r.mu.Lock()
+	if el, ok := r.byID[id]; ok {
+		r.lru.MoveToFront(el)
+		r.mu.Unlock()
+		return el.Value.(*ringEntry).keys, nil
+	}
+	r.mu.Unlock()
+	if r.dir == "" {
+		return nil, errUnknownRing
+	}
+	b, err := os.ReadFile(r.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errUnknownRing
+	} else if err != nil {
+		return nil, err
+	}
+	keys, err := parseRingFile(b)
+	if err != nil || triptych.Hash(triptych.RingDigest(keys)) != id {
+		log.Printf("[rings] %s on disk is corrupt", hex.EncodeToString(id[:]))
+		return nil, errUnknownRing
+	}
+	r.add(id, keys)
+	return keys, nil
+}
+
+// put stores the ring under its digest and reports whether it was new.
+func (r *ringRegistry) put(keys []*triptych.Point) (triptych.Hash, bool, error) {
+	id := triptych.Hash(triptych.RingDigest(keys))
+	if _, err := r.get(id); err == nil {
+		return id, false, nil
+	}
+	keys = triptych.CanonicalRing(keys)
+	if r.dir != "" {
+		buf := make([]byte, 0, len(keys)*33)
+		for _, p := range keys {
+			buf = append(buf, p.BytesCompressed()...)
+		}
+		tmp := r.path(id) + ".tmp"
+		if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+			return id, false, err
+		}
+		if err := os.Rename(tmp, r.path(id)); err != nil {
+			return id, false, err
+		}
+	}
+	r.add(id, keys)
+	return id, true, nil
+}
+
+func (r *ringRegistry) add(id triptych.Hash, keys []*triptych.Point) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if el, ok := r.byID[id]; ok {
+		r.lru.MoveToFront(el)
+		return
+	}
+	r.byID[id] = r.lru.PushFront(&ringEntry{id: id, keys: keys})
+	r.keys += len(keys)
+	// The newest ring stays even if it alone is over the budget.
+	for r.keys > r.maxKeys && r.lru.Len() > 1 {
+		old := r.lru.Remove(r.lru.Back()).(*ringEntry)
+		delete(r.byID, old.id)
+		r.keys -= len(old.keys)
+	}
+}
+
+func (r *ringRegistry) path(id triptych.Hash) string {
+	return filepath.Join(r.dir, hex.EncodeToString(id[:])+".ring")
+}
+
+func parseRingFile(b []byte) ([]*triptych.Point, error) {
+	if len(b) == 0 || len(b)%33 != 0 {
+		return nil, errors.New("bad ring file size")
+	}
+	keys := make([]*triptych.Point, 0, len(b)/33)
+	for i := 0; i < len(b); i += 33 {
+		p, err := triptych.ParseCompressed(b[i : i+33])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, p)
+	}
+	return keys, nil
+}
+
+// handlePutRing registers the JSON array of keys in the body; the digest in
+// the path must match it.
+func handlePutRing(w http.ResponseWriter, r *http.Request) {
+	var want triptych.Hash
+	if err := want.UnmarshalText([]byte(r.PathValue("digest"))); err != nil {
+		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "bad ring digest"})
+		return
+	}
+	var keys ringKeys
+	if !decodeBody(w, r, &keys, "rings") {
+		return
+	}
+	if len(keys) == 0 {
+		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "empty ring"})
+		return
+	}
+	for i, p := range keys {
+		if p.IsIdentity() {
+			writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: fmt.Sprintf("ring[%d] bad key", i)})
+			return
+		}
+	}
+	if got := triptych.Hash(triptych.RingDigest(keys)); got != want {
+		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "ring digest does not match the keys"})
+		return
+	}
+	id, created, err := rings.put(keys)
+	if err != nil {
+		log.Printf("[rings] store %s: %v", r.PathValue("digest"), err)
+		writeJSON(w, http.StatusInternalServerError, VerifyResponse{OK: false, Error: "cannot store ring"})
+		return
+	}
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+		log.Printf("[rings] registered %s (%d keys)", r.PathValue("digest"), len(keys))
+	}
+	writeJSON(w, code, RingDTO{RingID: id, Size: len(keys)})
+}
+
+// handleGetRing lets a client check whether it still needs to upload a ring.
+func handleGetRing(w http.ResponseWriter, r *http.Request) {
+	var id triptych.Hash
+	if err := id.UnmarshalText([]byte(r.PathValue("digest"))); err != nil {
+		writeJSON(w, http.StatusBadRequest, VerifyResponse{OK: false, Error: "bad ring digest"})
+		return
+	}
+	keys, err := rings.get(id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, VerifyResponse{OK: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, RingDTO{RingID: id, Size: len(keys)})
+}
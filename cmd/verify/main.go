@@ -3,11 +3,12 @@ package main
 import (
 	"bufio"
 	"encoding/base64"
-	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"coursach/triptych/triptych"
 )
@@ -25,12 +26,8 @@ func readRing(path string) ([]*triptych.Point, error) {
 		if line == "" {
 			continue
 		}
-		b, err := hex.DecodeString(line)
-		if err != nil {
-			return nil, fmt.Errorf("bad hex pubkey: %w", err)
-		}
-		P, err := triptych.ParseCompressed(b)
-		if err != nil {
+		P := new(triptych.Point)
+		if err := P.UnmarshalText([]byte(line)); err != nil {
 			return nil, fmt.Errorf("bad pubkey: %w", err)
 		}
 		ring = append(ring, P)
@@ -44,6 +41,10 @@ func main() {
 	msg := flag.String("msg", "hello", "сообщение")
 	sigB64 := flag.String("sig", "", "подпись (base64 от keyimg||raw)")
 	ringFile := flag.String("ring", "", "файл с кольцом в порядке использования при подписи")
+	scope := flag.String("scope", "", "область отслеживаемой подписи (для подписей, созданных с -scope)")
+	auditorHex := flag.String("auditor", "", "публичный ключ аудитора (для подписей, созданных с -auditor)")
+	ballotFile := flag.String("ballot", "", "файл с подписанным бюллетенем (base64); если задан, используется вместо -msg")
+	electionID := flag.String("election", "", "ожидаемый идентификатор выборов в бюллетене")
 	flag.Parse()
 
 	if *sigB64 == "" || *ringFile == "" {
@@ -62,12 +63,64 @@ func main() {
 		log.Fatalf("read ring: %v", err)
 	}
 
+	message := []byte(*msg)
+	if *ballotFile != "" {
+		b64, err := os.ReadFile(*ballotFile)
+		if err != nil {
+			log.Fatalf("read ballot: %v", err)
+		}
+		message, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(b64)))
+		if err != nil {
+			log.Fatalf("bad ballot base64: %v", err)
+		}
+		ballot, err := triptych.ParseBallot(message)
+		if err != nil {
+			log.Fatalf("parse ballot: %v", err)
+		}
+		if err := ballot.CheckContext(*electionID, ring); err != nil {
+			fmt.Printf("Verification FAILED: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Ballot: election=%q type=%s choices=%v created=%s\n",
+			ballot.ElectionID, ballot.Type, ballot.Choices, ballot.CreatedAt.Format(time.RFC3339))
+	}
+
+	if *scope != "" {
+		tsig, err := triptych.DeserializeTraceable(blob, *m, *n)
+		if err != nil {
+			log.Fatalf("deserialize: %v", err)
+		}
+		if !triptych.TraceableVerify(tsig, message, []byte(*scope), ring, *n, *m) {
+			fmt.Println("Verification FAILED")
+			os.Exit(1)
+		}
+		fmt.Println("Verification OK")
+		return
+	}
+
+	if *auditorHex != "" {
+		apk := new(triptych.Point)
+		if err := apk.UnmarshalText([]byte(*auditorHex)); err != nil {
+			log.Fatalf("bad auditor key: %v", err)
+		}
+		asig, err := triptych.DeserializeAccountable(raw, *m, *n, keyImg)
+		if err != nil {
+			log.Fatalf("deserialize: %v", err)
+		}
+		if ok, _ := triptych.VerifyAccountable(asig, message, ring, apk, *n, *m); !ok {
+			fmt.Println("Verification FAILED")
+			os.Exit(1)
+		}
+		fmt.Println("Verification OK")
+		return
+	}
+
 	sig, err := triptych.Deserialize(raw, *m, *n, keyImg)
 	if err != nil {
 		log.Fatalf("deserialize: %v", err)
 	}
 
-	ok, _ := triptych.VerifyTriptych(sig, []byte(*msg), ring, *n, *m)
+	ok, _ := triptych.VerifyTriptych(sig, message, ring, *n, *m)
 	if !ok {
 		fmt.Println("Verification FAILED")
 		os.Exit(1)
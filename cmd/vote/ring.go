@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"coursach/triptych/triptych"
+)
+
+// trustedRing returns the frozen ring snapshot once it has been checked:
+// the manifest is signed by the authority key the voter trusts, the
+// snapshot is signed by that key, and every ballot already in the bulletin
+// log was signed against the same ring. A nil result means the backend has
+// no snapshots and the voter allowed an unsigned ring.
+func trustedRing(baseURL string, election ElectionDTO, authorityPK *triptych.Point, allowUnsigned bool) *triptych.RingSnapshot {
+	base := strings.TrimRight(baseURL, "/")
+	if election.RingID == "" {
+		if !allowUnsigned {
+			log.Fatalf("сервер не публикует подписанный снимок кольца; запустите с -allow-unsigned-ring, если доверяете серверу")
+		}
+		fmt.Println("[WARN] Кольцо не подписано комиссией: сервер может подменить ключи в кольце")
+		return nil
+	}
+
+	var snap triptych.RingSnapshot
+	if err := doJSON(http.MethodGet, base+"/api/election/ring", nil, &snap); err != nil {
+		log.Fatalf("fetch ring snapshot: %v", err)
+	}
+	if snap.ID != election.RingID {
+		log.Fatalf("снимок кольца %s не совпадает с объявленным %s", snap.ID, election.RingID)
+	}
+
+	var m triptych.ElectionManifest
+	found, err := getOptional(base+"/api/election/manifest", &m)
+	if err != nil {
+		log.Fatalf("fetch manifest: %v", err)
+	}
+	switch {
+	case !found && !allowUnsigned:
+		log.Fatalf("у выборов нет манифеста комиссии, подпись кольца проверить нечем; запустите с -allow-unsigned-ring, если доверяете серверу")
+	case !found:
+		fmt.Println("[WARN] Манифеста нет: кольцо не проверено ключом комиссии")
+		if _, err := snap.RealKeys(); err != nil || triptych.Hash(triptych.RingDigest(snap.Keys)) != snap.Digest {
+			log.Fatalf("снимок кольца повреждён")
+		}
+	default:
+		if err := m.Verify(); err != nil || m.ElectionID != election.ID {
+			log.Fatalf("манифест выборов недействителен")
+		}
+		// The manifest comes from the server being checked, so its key
+		// proves nothing unless the voter got the same key elsewhere.
+		if authorityPK == nil {
+			pk, _ := m.AuthorityKey.MarshalText()
+			if !allowUnsigned {
+				log.Fatalf("не задан ключ комиссии: сверьте ключ из манифеста (%s) и передайте его через -authority-pk, или запустите с -allow-unsigned-ring, если доверяете серверу", pk)
+			}
+			fmt.Printf("[WARN] Ключ комиссии взят из манифеста сервера (%s): сервер может подписать кольцо сам\n", pk)
+		} else if !authorityPK.Equal(m.AuthorityKey) {
+			log.Fatalf("манифест подписан не тем ключом комиссии")
+		}
+		if err := snap.Verify(election.ID, m.AuthorityKey); err != nil {
+			log.Fatalf("снимок кольца отклонён: %v", err)
+		}
+	}
+
+	crossCheckLog(base, snap.Digest, allowUnsigned)
+	return &snap
+}
+
+// crossCheckLog reads the whole bulletin log and checks that it matches the
+// signed tree head and that every ballot in it names the given ring. A
+// voter handed a private ring would see other voters' ballots disagree. A
+// server that hides its log could do just that, so a missing log is fatal
+// unless the voter allowed an unchecked ring.
+func crossCheckLog(base string, digest triptych.Hash, allowUnsigned bool) {
+	var lk LogKeyDTO
+	if found, err := getOptional(base+"/api/log/key", &lk); err != nil || !found || lk.PublicKey == nil {
+		if !allowUnsigned {
+			log.Fatalf("сервер не публикует журнал бюллетеней, кольцо не сверить с другими избирателями; запустите с -allow-unsigned-ring, если доверяете серверу")
+		}
+		fmt.Println("[WARN] Сервер не ведёт журнал бюллетеней: кольцо не сверено с другими избирателями")
+		return
+	}
+	var sth triptych.SignedTreeHead
+	if err := doJSON(http.MethodGet, base+"/api/log/sth", nil, &sth); err != nil {
+		log.Fatalf("fetch tree head: %v", err)
+	}
+	if err := sth.Verify(lk.PublicKey); err != nil {
+		log.Fatalf("заголовок журнала: %v", err)
+	}
+	var entries []triptych.LogEntry
+	u := fmt.Sprintf("%s/api/log/entries?start=0&end=%d", base, sth.TreeSize)
+	if err := doJSON(http.MethodGet, u, nil, &entries); err != nil {
+		log.Fatalf("fetch log entries: %v", err)
+	}
+	head, err := triptych.VerifyLogChain(entries)
+	if err != nil || uint64(len(entries)) != sth.TreeSize || head != sth.ChainHead {
+		log.Fatalf("записи журнала не совпадают с подписанным заголовком")
+	}
+	leaves := make([]triptych.Hash, len(entries))
+	for i := range entries {
+		leaves[i] = entries[i].LeafHash()
+		b, err := triptych.ParseBallot(entries[i].Ballot)
+		if err != nil {
+			log.Fatalf("запись журнала №%d: %v", i, err)
+		}
+		if triptych.Hash(b.RingDigest) != digest {
+			log.Fatalf("бюллетень №%d в журнале подписан другим кольцом: сервер показывает избирателям разные кольца", i)
+		}
+	}
+	if triptych.MerkleRoot(leaves) != sth.RootHash {
+		log.Fatalf("корень журнала не совпадает с подписанным заголовком")
+	}
+	fmt.Printf("[LOG] Журнал сверен: %d бюллетеней подписаны тем же кольцом\n", len(entries))
+}
+
+// getOptional is a GET that reports a 404 as not found instead of an error.
+func getOptional(url string, out interface{}) (bool, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, nil
+	case res.StatusCode < 200 || res.StatusCode >= 300:
+		return false, fmt.Errorf("http %d", res.StatusCode)
+	}
+	return true, json.NewDecoder(res.Body).Decode(out)
+}
@@ -8,9 +8,11 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -24,40 +26,133 @@ type CandidateDTO struct {
 }
 
 type RingDTO struct {
-	PublicKeys []string `json:"publicKeys"`
-	RingSize   int      `json:"ringSize"`
-	Exp        int      `json:"exp"`
-	Base       int      `json:"base"`
+	PublicKeys []*triptych.Point `json:"publicKeys"`
+	RingSize   int               `json:"ringSize"`
+	Exp        int               `json:"exp"`
+	Base       int               `json:"base"`
+	RingID     string            `json:"ringId"`
+	Digest     *triptych.Hash    `json:"digest"`
 }
 
 type BulletinCreateDTO struct {
-	CandidateID  string   `json:"candidateId"`
-	SignatureB64 string   `json:"signatureB64"`
-	Ring         []string `json:"ring"`
-	N            int      `json:"n"`
-	M            int      `json:"m"`
+	BallotB64    string            `json:"ballotB64"`
+	SignatureB64 string            `json:"signatureB64"`
+	Ring         []*triptych.Point `json:"ring,omitempty"`
+	RingID       *triptych.Hash    `json:"ringId,omitempty"`
+	N            int               `json:"n"`
+	M            int               `json:"m"`
+}
+
+// ElectionDTO: Phase and the ring fields are empty on backends without
+// election phases.
+type ElectionDTO struct {
+	ID         string          `json:"id"`
+	PublicKey  *triptych.Point `json:"publicKey"`
+	Phase      string          `json:"phase"`
+	Revoting   bool            `json:"revoting"`
+	RingID     string          `json:"ringId"`
+	RingDigest *triptych.Hash  `json:"ringDigest"`
+}
+
+type BallotEntryDTO struct {
+	UNumber   string `json:"uNumber"`
+	BallotB64 string `json:"ballotB64"`
 }
 
 type keypairFile struct {
-	FullName  string `json:"fullName"`
-	PublicKey string `json:"publicKey"`
-	SecretKey string `json:"secretKey"`
-	CreatedAt string `json:"createdAt"`
+	FullName  string           `json:"fullName"`
+	PublicKey *triptych.Point  `json:"publicKey"`
+	SecretKey *triptych.Scalar `json:"secretKey"`
+	CreatedAt string           `json:"createdAt"`
+}
+
+// openingFile is what a commit-mode voter keeps until the reveal phase.
+type openingFile struct {
+	URL         string           `json:"url"`
+	CandidateID string           `json:"candidateId"`
+	Commitment  *triptych.Point  `json:"commitment"`
+	Opening     *triptych.Scalar `json:"opening"`
+	KeyImage    string           `json:"keyImage"`
+}
+
+// receiptFile is the vote receipt: the board's log entry for the ballot,
+// a signed tree head and the inclusion proof, plus the log key it was
+// checked against when the vote was cast.
+type receiptFile struct {
+	URL      string            `json:"url"`
+	KeyImage string            `json:"keyImage"`
+	LogKey   *triptych.Point   `json:"logKey"`
+	Receipt  *triptych.Receipt `json:"receipt"`
+}
+
+type LogKeyDTO struct {
+	PublicKey *triptych.Point `json:"publicKey"`
+}
+
+type ConsistencyDTO struct {
+	First  uint64          `json:"first"`
+	Second uint64          `json:"second"`
+	Proof  []triptych.Hash `json:"proof"`
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "reveal":
+			runReveal(os.Args[2:])
+			return
+		case "verify-receipt":
+			runVerifyReceipt(os.Args[2:])
+			return
+		}
+	}
+
 	baseURL := flag.String("url", "", "базовый URL бэкенда (например http://localhost:8080)")
 	keysPath := flag.String("keys", "", "путь к файлу с парой ключей (JSON из keygen)")
 	exp := flag.Int("exp", -1, "экспонента степени 2; будет уменьшена, если ключей не хватает")
+	electionPK := flag.String("election-pk", "", "публичный ключ выборов (33B hex); по умолчанию берётся с сервера, если выборы с шифрованием")
+	commitMode := flag.Bool("commit", false, "отправить только обязательство на выбор; раскрыть позже через vote reveal")
+	openingPath := flag.String("opening", "vote-opening.json", "куда сохранить данные для раскрытия (режим -commit)")
+	ballotKind := flag.String("type", "plurality", "тип бюллетеня: plurality, ranked, approval или score")
+	maxScore := flag.Int("max-score", 10, "максимальная оценка для бюллетеня типа score")
+	receiptPath := flag.String("receipt", "vote-receipt.json", "куда сохранить квитанцию о включении бюллетеня в журнал")
+	authorityPK := flag.String("authority-pk", "", "публичный ключ избирательной комиссии (33B hex), которым подписаны манифест и кольцо")
+	allowUnsigned := flag.Bool("allow-unsigned-ring", false, "разрешить кольцо без подписи комиссии (сервер сможет подменить ключи)")
+	revote := flag.Bool("revote", false, "переголосовать: новый бюллетень заменит прежний, если выборы это разрешают")
 	flag.Parse()
 
 	if *baseURL == "" || *keysPath == "" {
-		log.Fatalf("usage: vote -url http://localhost:8080 -keys ./alice-key.json [-exp -1]")
+		log.Fatalf("usage: vote -url http://localhost:8080 -keys ./alice-key.json [-exp -1] [-election-pk hex | -commit -opening vote-opening.json]\n       vote reveal -url http://localhost:8080 -keys ./alice-key.json -opening vote-opening.json\n       vote verify-receipt -receipt vote-receipt.json")
+	}
+	if *commitMode && *electionPK != "" {
+		log.Fatalf("-commit и -election-pk нельзя использовать вместе")
 	}
 
 	const N = 2
 
-	kf, sk, _ := loadKeys(*keysPath)
+	kf := loadKeys(*keysPath)
+	var trustedPK *triptych.Point
+	if *authorityPK != "" {
+		trustedPK = new(triptych.Point)
+		if err := trustedPK.UnmarshalText([]byte(*authorityPK)); err != nil {
+			log.Fatalf("bad authority pk: %v", err)
+		}
+	}
+	election := fetchElection(*baseURL)
+	if election.Phase != "" && election.Phase != string(triptych.PhaseVoting) {
+		log.Fatalf("голосование не открыто: выборы %q в фазе %s", election.ID, election.Phase)
+	}
+	if *revote && !election.Revoting {
+		log.Fatalf("выборы %q не разрешают повторное голосование", election.ID)
+	}
+	var seq uint32
+	if prev, found := lastSeq(*baseURL, election.ID, hex.EncodeToString(triptych.KeyImage(kf.SecretKey).BytesCompressed())); found {
+		if !*revote {
+			log.Fatalf("с этим ключом уже голосовали; чтобы заменить бюллетень, запустите с -revote")
+		}
+		seq = prev + 1
+		fmt.Printf("[LOG] Повторное голосование: бюллетень №%d заменит прежний\n", seq)
+	}
 
 	cands := fetchCandidates(*baseURL)
 	if len(cands) == 0 {
@@ -68,53 +163,188 @@ func main() {
 	for i, c := range cands {
 		fmt.Printf("[%d] %s  (%s)\n", i, c.Fullname, c.ID)
 	}
-	idx := askIndex(len(cands))
-	cand := cands[idx]
-	msg := []byte(cand.ID)
+	var (
+		cand       CandidateDTO
+		ballotType triptych.BallotType
+		choices    []triptych.BallotChoice
+	)
+	switch *ballotKind {
+	case "plurality":
+		cand = cands[askIndex(len(cands))]
+		ballotType = triptych.BallotPlurality
+		choices = []triptych.BallotChoice{{Candidate: cand.ID, Value: 1}}
+	case "ranked":
+		ballotType = triptych.BallotRanked
+		for r, i := range askIndices("Перечислите номера кандидатов через пробел в порядке предпочтения", len(cands), 1) {
+			choices = append(choices, triptych.BallotChoice{Candidate: cands[i].ID, Value: uint32(r + 1)})
+		}
+	case "approval":
+		ballotType = triptych.BallotApproval
+		for _, i := range askIndices("Перечислите через пробел номера одобряемых кандидатов (пустая строка — ни одного)", len(cands), 0) {
+			choices = append(choices, triptych.BallotChoice{Candidate: cands[i].ID, Value: 1})
+		}
+	case "score":
+		ballotType = triptych.BallotScore
+		for _, c := range cands {
+			choices = append(choices, triptych.BallotChoice{Candidate: c.ID, Value: uint32(askScore(c.Fullname, *maxScore))})
+		}
+	default:
+		log.Fatalf("неизвестный тип бюллетеня %q", *ballotKind)
+	}
+	if ballotType != triptych.BallotPlurality && (*commitMode || *electionPK != "") {
+		log.Fatalf("-commit и шифрование поддерживаются только для -type plurality")
+	}
 
-	ringPointsAll, ringHexAll, ringDTO := fetchRingAll(*baseURL)
+	var epk *triptych.Point
+	if *electionPK != "" {
+		epk = new(triptych.Point)
+		if err := epk.UnmarshalText([]byte(*electionPK)); err != nil {
+			log.Fatalf("bad election pk: %v", err)
+		}
+	} else if election.PublicKey != nil && !*commitMode {
+		if ballotType != triptych.BallotPlurality {
+			log.Fatalf("на этих выборах бюллетени шифруются; используйте -type plurality")
+		}
+		epk = election.PublicKey
+	}
 
-	fmt.Printf("\n[LOG] Получено ключей от сервера: %d\n", len(ringHexAll))
+	var ballotPayload []byte
+	if epk != nil {
+		eb, _, err := triptych.EncryptBallot(epk, candidatePosition(cands, cand.ID), len(cands))
+		if err != nil {
+			log.Fatalf("encrypt ballot: %v", err)
+		}
+		ballotType, choices, ballotPayload = triptych.BallotEncrypted, nil, eb.Bytes()
+	}
+	var commitment *triptych.Point
+	opening := triptych.RandomScalar()
+	if *commitMode {
+		commitment = triptych.CommitCandidate(cand.ID, opening)
+		ballotType, choices, ballotPayload = triptych.BallotCommitment, nil, commitment.BytesCompressed()
+	}
+
+	ringPointsAll, ringDTO := fetchRingAll(*baseURL)
+
+	fmt.Printf("\n[LOG] Получено ключей от сервера: %d\n", len(ringPointsAll))
 	fmt.Printf("[LOG] Метаданные сервера (если есть): exp=%d, ringSize=%d, base=%d\n", ringDTO.Exp, ringDTO.RingSize, ringDTO.Base)
 	fmt.Printf("[LOG] Запрошенная экспонента: %d (n всегда 2)\n", *exp)
 
-	if !containsHex(ringHexAll, kf.PublicKey) {
+	snap := trustedRing(*baseURL, election, trustedPK, *allowUnsigned)
+	if snap != nil {
+		// A frozen ring is signed as a whole, so every voter has the same anonymity set.
+		if ringDTO.RingID != snap.ID || triptych.Hash(triptych.RingDigest(ringPointsAll)) != snap.Digest {
+			log.Fatalf("кольцо сервера не совпадает с зафиксированным снимком %s", snap.ID)
+		}
+		fmt.Printf("[LOG] Кольцо зафиксировано (снимок %s, %d зарегистрированных ключей), подпись по всему кольцу\n", snap.ID, snap.Registered)
+		ringPointsAll = snap.Keys
+		*exp = -1
+	}
+
+	if !containsKey(ringPointsAll, kf.PublicKey) {
 		log.Fatalf("ваш публичный ключ отсутствует в кольце сервера. Сначала зарегистрируйте его через keygen, затем повторите попытку")
 	}
 
-	selectedPoints, selectedHex, m := selectSubsetEnsureSelf(ringPointsAll, ringHexAll, kf.PublicKey, *exp)
+	selectedPoints, m := selectSubsetEnsureSelf(ringPointsAll, kf.PublicKey, *exp)
 
 	targetSize := 1 << uint(m)
 	fmt.Printf("[LOG] Использованная экспонента (m): %d, итоговый размер кольца: 2^%d = %d\n", m, m, targetSize)
 
-	sig, ringUsed, err := triptych.RingSignTriptych(sk, msg, selectedPoints, N, m)
+	ballot, err := triptych.NewBallot(election.ID, selectedPoints, ballotType, choices, ballotPayload)
+	if err != nil {
+		log.Fatalf("ballot: %v", err)
+	}
+	ballot.Seq = seq
+	msg := ballot.Bytes()
+
+	sign := triptych.RingSignTriptych
+	if snap != nil {
+		// The server knows the frozen ring, so it is enough to name it by
+		// digest and sign over the order it will rebuild.
+		sign = triptych.RingSignCanonical
+	}
+	sig, ringUsed, err := sign(kf.SecretKey.Bytes(), msg, selectedPoints, N, m)
 	if err != nil {
 		log.Fatalf("sign: %v", err)
 	}
 	raw, keyImg := triptych.Serialize(sig)
 
 	sigB64 := base64.StdEncoding.EncodeToString(append(keyImg, raw...))
-	ringUsedHex := make([]string, len(ringUsed))
-	for i, p := range ringUsed {
-		ringUsedHex[i] = hex.EncodeToString(p.BytesCompressed())
-	}
 
 	payload := BulletinCreateDTO{
-		CandidateID:  cand.ID,
+		BallotB64:    base64.StdEncoding.EncodeToString(msg),
 		SignatureB64: sigB64,
-		Ring:         ringUsedHex,
+		Ring:         ringUsed,
 		N:            N,
 		M:            m,
 	}
+	if snap != nil {
+		payload.Ring, payload.RingID = nil, &snap.Digest
+	}
+	if *commitMode {
+		// Save the opening before sending: losing it means the vote can never be counted.
+		b, _ := json.MarshalIndent(openingFile{
+			URL:         *baseURL,
+			CandidateID: cand.ID,
+			Commitment:  commitment,
+			Opening:     opening,
+			KeyImage:    hex.EncodeToString(keyImg),
+		}, "", "  ")
+		if err := os.WriteFile(*openingPath, b, 0o600); err != nil {
+			log.Fatalf("write opening: %v", err)
+		}
+		fmt.Printf("Данные для раскрытия сохранены в %s — они понадобятся на этапе раскрытия.\n", *openingPath)
+	}
 
-	sendBulletin(*baseURL, payload)
+	rc := sendBulletin(*baseURL, payload)
+	if rc != nil {
+		saveReceipt(*baseURL, *receiptPath, hex.EncodeToString(keyImg), msg, sigB64, rc)
+	}
 
-	fmt.Printf("\nГолос отправлен. Параметры: n=%d, m=%d (ring=%d, 2^m=%d)\n", N, m, len(selectedHex), targetSize)
+	fmt.Printf("\nГолос отправлен. Параметры: n=%d, m=%d (ring=%d, 2^m=%d)\n", N, m, len(selectedPoints), targetSize)
 	fmt.Printf("Ваш uNumber (key image): %s\n", hex.EncodeToString(keyImg))
 	fmt.Println("Важно: храните uNumber — по нему можно обнаружить повторный голос.")
 }
 
-func loadKeys(path string) (keypairFile, []byte, *triptych.Point) {
+func runReveal(args []string) {
+	fs := flag.NewFlagSet("reveal", flag.ExitOnError)
+	baseURL := fs.String("url", "", "базовый URL бэкенда; по умолчанию берётся из файла раскрытия")
+	keysPath := fs.String("keys", "", "путь к файлу с парой ключей (JSON из keygen)")
+	openingPath := fs.String("opening", "vote-opening.json", "файл, сохранённый при голосовании с -commit")
+	_ = fs.Parse(args)
+
+	if *keysPath == "" {
+		log.Fatalf("usage: vote reveal -url http://localhost:8080 -keys ./alice-key.json -opening vote-opening.json")
+	}
+	kf := loadKeys(*keysPath)
+
+	b, err := os.ReadFile(*openingPath)
+	if err != nil {
+		log.Fatalf("read opening: %v", err)
+	}
+	var of openingFile
+	if err := json.Unmarshal(b, &of); err != nil || of.Commitment == nil || of.Opening == nil {
+		log.Fatalf("parse opening json: %v", err)
+	}
+	if *baseURL == "" {
+		*baseURL = of.URL
+	}
+
+	rv, err := triptych.NewReveal(kf.SecretKey, of.Commitment, of.CandidateID, of.Opening)
+	if err != nil {
+		log.Fatalf("reveal: %v", err)
+	}
+	if ki := hex.EncodeToString(rv.KeyImage.BytesCompressed()); ki != of.KeyImage {
+		log.Fatalf("ключи не соответствуют бюллетеню: key image %s, ожидался %s", ki, of.KeyImage)
+	}
+
+	u := strings.TrimRight(*baseURL, "/") + "/api/bulletin/reveal"
+	if err := doJSON(http.MethodPost, u, rv, nil); err != nil {
+		log.Fatalf("send reveal: %v", err)
+	}
+	fmt.Printf("Голос раскрыт: кандидат %s, uNumber %s\n", of.CandidateID, of.KeyImage)
+}
+
+func loadKeys(path string) keypairFile {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		log.Fatalf("read keys: %v", err)
@@ -123,19 +353,13 @@ func loadKeys(path string) (keypairFile, []byte, *triptych.Point) {
 	if err := json.Unmarshal(b, &kf); err != nil {
 		log.Fatalf("parse keys json: %v", err)
 	}
-	if len(kf.SecretKey) != 64 || len(kf.PublicKey) != 66 {
+	if kf.SecretKey == nil || kf.PublicKey == nil {
 		log.Fatalf("неверный формат ключей (ожидается hex: sk=32B, pk=33B)")
 	}
-	sk, err := hex.DecodeString(kf.SecretKey)
-	if err != nil {
-		log.Fatalf("bad sk hex: %v", err)
-	}
-	pkb, _ := hex.DecodeString(kf.PublicKey)
-	pk, err := triptych.ParseCompressed(pkb)
-	if err != nil {
-		log.Fatalf("bad pk: %v", err)
+	if !triptych.ScalarBaseMult(kf.SecretKey).Equal(kf.PublicKey) {
+		log.Fatalf("публичный ключ не соответствует секретному")
 	}
-	return kf, sk, pk
+	return kf
 }
 
 func fetchCandidates(baseURL string) []CandidateDTO {
@@ -147,7 +371,48 @@ func fetchCandidates(baseURL string) []CandidateDTO {
 	return cands
 }
 
-func fetchRingAll(baseURL string) ([]*triptych.Point, []string, RingDTO) {
+func fetchElection(baseURL string) ElectionDTO {
+	u := strings.TrimRight(baseURL, "/") + "/api/election"
+	var e ElectionDTO
+	if err := doJSON(http.MethodGet, u, nil, &e); err != nil {
+		log.Fatalf("fetch election: %v", err)
+	}
+	if e.ID == "" {
+		log.Fatalf("сервер не сообщил идентификатор выборов")
+	}
+	return e
+}
+
+// lastSeq finds the voter's own ballots on the board by key image and
+// returns the highest sequence number among them.
+func lastSeq(baseURL, electionID, keyImage string) (uint32, bool) {
+	var entries []BallotEntryDTO
+	if err := doJSON(http.MethodGet, strings.TrimRight(baseURL, "/")+"/api/bulletin/ballots", nil, &entries); err != nil {
+		log.Fatalf("fetch ballots: %v", err)
+	}
+	var seq uint32
+	found := false
+	for _, e := range entries {
+		if e.UNumber != keyImage {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(e.BallotB64)
+		if err != nil {
+			continue
+		}
+		b, err := triptych.ParseBallot(raw)
+		if err != nil || b.ElectionID != electionID {
+			continue
+		}
+		if !found || b.Seq > seq {
+			seq = b.Seq
+		}
+		found = true
+	}
+	return seq, found
+}
+
+func fetchRingAll(baseURL string) ([]*triptych.Point, RingDTO) {
 	u := strings.TrimRight(baseURL, "/") + "/api/signer/ring"
 	var resp RingDTO
 	if err := doJSON(http.MethodGet, u, nil, &resp); err != nil {
@@ -156,27 +421,112 @@ func fetchRingAll(baseURL string) ([]*triptych.Point, []string, RingDTO) {
 	if len(resp.PublicKeys) == 0 {
 		log.Fatalf("получено пустое кольцо")
 	}
-	var ring []*triptych.Point
-	for i, hx := range resp.PublicKeys {
-		b, err := hex.DecodeString(hx)
-		if err != nil {
-			log.Fatalf("ring[%d] bad hex: %v", i, err)
-		}
-		P, err := triptych.ParseCompressed(b)
-		if err != nil {
-			log.Fatalf("ring[%d] bad pubkey: %v", i, err)
+	for i, p := range resp.PublicKeys {
+		if p == nil {
+			log.Fatalf("ring[%d] bad pubkey", i)
 		}
-		ring = append(ring, P)
 	}
-	return ring, resp.PublicKeys, resp
+	return resp.PublicKeys, resp
 }
 
-func sendBulletin(baseURL string, payload BulletinCreateDTO) {
+// sendBulletin returns the receipt if the backend issues one; the Spring
+// backend answers with an empty body.
+func sendBulletin(baseURL string, payload BulletinCreateDTO) *triptych.Receipt {
 	u := strings.TrimRight(baseURL, "/") + "/api/bulletin"
-	if err := doJSON(http.MethodPost, u, payload, nil); err != nil {
+	var rc triptych.Receipt
+	if err := doJSON(http.MethodPost, u, payload, &rc); err != nil {
 		log.Fatalf("send bulletin: %v", err)
 	}
 	fmt.Println("Сервер принял бюллетень (HTTP 2xx).")
+	if rc.TreeHead.Signature == nil {
+		fmt.Println("Сервер не выдал квитанцию о включении в журнал.")
+		return nil
+	}
+	return &rc
+}
+
+// saveReceipt checks that the receipt covers exactly the ballot and
+// signature that were sent, then stores it with the board's log key.
+func saveReceipt(baseURL, path, keyImage string, ballot []byte, sigB64 string, rc *triptych.Receipt) {
+	var lk LogKeyDTO
+	if err := doJSON(http.MethodGet, strings.TrimRight(baseURL, "/")+"/api/log/key", nil, &lk); err != nil || lk.PublicKey == nil {
+		log.Fatalf("fetch log key: %v", err)
+	}
+	if !bytes.Equal(rc.Entry.Ballot, ballot) || base64.StdEncoding.EncodeToString(rc.Entry.Signature) != sigB64 {
+		log.Fatalf("квитанция относится к другому бюллетеню")
+	}
+	if err := rc.Verify(lk.PublicKey); err != nil {
+		log.Fatalf("квитанция недействительна: %v", err)
+	}
+	b, _ := json.MarshalIndent(receiptFile{URL: baseURL, KeyImage: keyImage, LogKey: lk.PublicKey, Receipt: rc}, "", "  ")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		log.Fatalf("write receipt: %v", err)
+	}
+	fmt.Printf("Квитанция сохранена в %s: запись №%d, дерево размера %d.\n", path, rc.Entry.Index, rc.TreeHead.TreeSize)
+}
+
+// runVerifyReceipt checks the saved receipt and, unless -offline, that the
+// board's current tree head still contains it.
+func runVerifyReceipt(args []string) {
+	fs := flag.NewFlagSet("verify-receipt", flag.ExitOnError)
+	receiptPath := fs.String("receipt", "vote-receipt.json", "файл квитанции, сохранённый при голосовании")
+	baseURL := fs.String("url", "", "базовый URL доски; по умолчанию берётся из квитанции")
+	logKeyHex := fs.String("log-pk", "", "публичный ключ журнала (33B hex); по умолчанию ключ, сохранённый в квитанции")
+	offline := fs.Bool("offline", false, "проверить только саму квитанцию, не обращаясь к серверу")
+	_ = fs.Parse(args)
+
+	b, err := os.ReadFile(*receiptPath)
+	if err != nil {
+		log.Fatalf("read receipt: %v", err)
+	}
+	var rf receiptFile
+	if err := json.Unmarshal(b, &rf); err != nil || rf.Receipt == nil || rf.LogKey == nil {
+		log.Fatalf("parse receipt json: %v", err)
+	}
+	logKey := rf.LogKey
+	if *logKeyHex != "" {
+		logKey = new(triptych.Point)
+		if err := logKey.UnmarshalText([]byte(*logKeyHex)); err != nil {
+			log.Fatalf("bad log pk: %v", err)
+		}
+	}
+	if *baseURL == "" {
+		*baseURL = rf.URL
+	}
+
+	rc := rf.Receipt
+	if err := rc.Verify(logKey); err != nil {
+		log.Fatalf("квитанция недействительна: %v", err)
+	}
+	if len(rc.Entry.Signature) < 33 || hex.EncodeToString(rc.Entry.Signature[:33]) != rf.KeyImage {
+		log.Fatalf("квитанция не относится к uNumber %s", rf.KeyImage)
+	}
+	fmt.Printf("Квитанция действительна: запись №%d входит в дерево размера %d (корень %x).\n",
+		rc.Entry.Index, rc.TreeHead.TreeSize, rc.TreeHead.RootHash[:])
+	if *offline {
+		return
+	}
+
+	base := strings.TrimRight(*baseURL, "/")
+	var sth triptych.SignedTreeHead
+	if err := doJSON(http.MethodGet, base+"/api/log/sth", nil, &sth); err != nil {
+		log.Fatalf("fetch tree head: %v", err)
+	}
+	if err := sth.Verify(logKey); err != nil {
+		log.Fatalf("текущий заголовок журнала: %v", err)
+	}
+	if sth.TreeSize < rc.TreeHead.TreeSize {
+		log.Fatalf("журнал укоротился: было %d записей, сейчас %d", rc.TreeHead.TreeSize, sth.TreeSize)
+	}
+	var cp ConsistencyDTO
+	u := fmt.Sprintf("%s/api/log/consistency?first=%d&second=%d", base, rc.TreeHead.TreeSize, sth.TreeSize)
+	if err := doJSON(http.MethodGet, u, nil, &cp); err != nil {
+		log.Fatalf("fetch consistency proof: %v", err)
+	}
+	if err := triptych.VerifyConsistency(rc.TreeHead.TreeSize, sth.TreeSize, rc.TreeHead.RootHash, sth.RootHash, cp.Proof); err != nil {
+		log.Fatalf("журнал переписан после выдачи квитанции: %v", err)
+	}
+	fmt.Printf("Журнал согласован: текущее дерево размера %d продолжает дерево из квитанции, бюллетень на месте.\n", sth.TreeSize)
 }
 
 func doJSON(method, url string, in interface{}, out interface{}) error {
@@ -202,7 +552,9 @@ func doJSON(method, url string, in interface{}, out interface{}) error {
 		return fmt.Errorf("http %d", res.StatusCode)
 	}
 	if out != nil {
-		return json.NewDecoder(res.Body).Decode(out)
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil && err != io.EOF {
+			return err
+		}
 	}
 	return nil
 }
@@ -221,10 +573,58 @@ func askIndex(max int) int {
 	}
 }
 
-func containsHex(arr []string, needle string) bool {
-	needle = strings.ToLower(needle)
-	for _, s := range arr {
-		if strings.ToLower(s) == needle {
+// askIndices reads distinct candidate numbers separated by spaces.
+func askIndices(prompt string, max, minCount int) []int {
+	r := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("%s [0..%d]: ", prompt, max-1)
+		line, _ := r.ReadString('\n')
+		fields := strings.Fields(line)
+		seen := make(map[int]bool, len(fields))
+		out := make([]int, 0, len(fields))
+		for _, f := range fields {
+			i, err := strconv.Atoi(f)
+			if err != nil || i < 0 || i >= max || seen[i] {
+				out = nil
+				break
+			}
+			seen[i] = true
+			out = append(out, i)
+		}
+		if out != nil && len(out) >= minCount {
+			return out
+		}
+		fmt.Println("Неверный ввод")
+	}
+}
+
+func askScore(name string, max int) int {
+	r := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Оценка для %s [0..%d]: ", name, max)
+		line, _ := r.ReadString('\n')
+		v, err := strconv.Atoi(strings.TrimSpace(line))
+		if err == nil && v >= 0 && v <= max {
+			return v
+		}
+		fmt.Println("Неверный ввод")
+	}
+}
+
+// candidatePosition is the index of id among candidates sorted by ID; the
+// tally uses the same order for ciphertext slots.
+func candidatePosition(cands []CandidateDTO, id string) int {
+	ids := make([]string, len(cands))
+	for i, c := range cands {
+		ids[i] = c.ID
+	}
+	sort.Strings(ids)
+	return sort.SearchStrings(ids, id)
+}
+
+func containsKey(ring []*triptych.Point, needle *triptych.Point) bool {
+	for _, p := range ring {
+		if p.Equal(needle) {
 			return true
 		}
 	}
@@ -242,16 +642,12 @@ func maxExpForSize(size int) int {
 	return e
 }
 
-func selectSubsetEnsureSelf(ring []*triptych.Point, ringHex []string, selfHex string, desiredExp int) ([]*triptych.Point, []string, int) {
+func selectSubsetEnsureSelf(ring []*triptych.Point, self *triptych.Point, desiredExp int) ([]*triptych.Point, int) {
 	total := len(ring)
-	if total != len(ringHex) {
-		log.Fatalf("internal: несоответствие длин ring и ringHex")
-	}
 
-	selfHex = strings.ToLower(selfHex)
 	selfIdx := -1
-	for i, s := range ringHex {
-		if strings.ToLower(s) == selfHex {
+	for i, p := range ring {
+		if p.Equal(self) {
 			selfIdx = i
 			break
 		}
@@ -280,13 +676,11 @@ func selectSubsetEnsureSelf(ring []*triptych.Point, ringHex []string, selfHex st
 	want := 1 << uint(m)
 
 	selectedPts := make([]*triptych.Point, 0, want)
-	selectedHex := make([]string, 0, want)
 
 	for j := 0; j < want; j++ {
 		idx := (selfIdx + j) % total
 		selectedPts = append(selectedPts, ring[idx])
-		selectedHex = append(selectedHex, ringHex[idx])
 	}
 
-	return selectedPts, selectedHex, m
+	return selectedPts, m
 }
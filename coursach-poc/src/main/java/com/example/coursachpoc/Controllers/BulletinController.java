@@ -1,13 +1,15 @@
 package com.example.coursachpoc.Controllers;
 
+import com.example.coursachpoc.DTOs.BallotEntryDTO;
 import com.example.coursachpoc.DTOs.BulletinCreateDTO;
+import com.example.coursachpoc.DTOs.CommitmentDTO;
+import com.example.coursachpoc.DTOs.RevealDTO;
 import com.example.coursachpoc.Services.BulletinService;
 import lombok.RequiredArgsConstructor;
 import org.springframework.http.ResponseEntity;
-import org.springframework.web.bind.annotation.PostMapping;
-import org.springframework.web.bind.annotation.RequestBody;
-import org.springframework.web.bind.annotation.RequestMapping;
-import org.springframework.web.bind.annotation.RestController;
+import org.springframework.web.bind.annotation.*;
+
+import java.util.List;
 
 @RestController()
 @RequestMapping("/api/bulletin")
@@ -20,4 +22,25 @@ public class BulletinController {
         bulletinService.submit(dto);
         return ResponseEntity.ok().build();
     }
+
+    @PostMapping("/reveal")
+    public ResponseEntity<Void> reveal(@RequestBody RevealDTO dto) {
+        bulletinService.reveal(dto);
+        return ResponseEntity.ok().build();
+    }
+
+    @GetMapping("/commitments")
+    public ResponseEntity<List<CommitmentDTO>> getCommitments() {
+        return ResponseEntity.ok(bulletinService.getCommitments());
+    }
+
+    @GetMapping("/ballots")
+    public ResponseEntity<List<BallotEntryDTO>> getBallots() {
+        return ResponseEntity.ok(bulletinService.getBallots());
+    }
+
+    @GetMapping("/encrypted")
+    public ResponseEntity<List<String>> getEncrypted() {
+        return ResponseEntity.ok(bulletinService.getEncryptedBallots());
+    }
 }
@@ -0,0 +1,19 @@
+package com.example.coursachpoc.Controllers;
+
+import com.example.coursachpoc.DTOs.ElectionDTO;
+import com.example.coursachpoc.Services.ElectionService;
+import lombok.RequiredArgsConstructor;
+import org.springframework.http.ResponseEntity;
+import org.springframework.web.bind.annotation.*;
+
+@RestController()
+@RequestMapping("/api/election")
+@RequiredArgsConstructor
+public class ElectionController {
+    private final ElectionService electionService;
+
+    @GetMapping
+    public ResponseEntity<ElectionDTO> getElection() {
+        return ResponseEntity.ok(electionService.getElection());
+    }
+}
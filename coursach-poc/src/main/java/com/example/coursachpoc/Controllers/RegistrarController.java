@@ -0,0 +1,22 @@
+package com.example.coursachpoc.Controllers;
+
+import com.example.coursachpoc.Services.SignerService;
+import lombok.RequiredArgsConstructor;
+import org.springframework.http.ResponseEntity;
+import org.springframework.web.bind.annotation.*;
+
+import java.util.Map;
+
+@RestController()
+@RequestMapping("/api/registrar")
+@RequiredArgsConstructor
+public class RegistrarController {
+    private final SignerService signerService;
+
+    // список отзыва проверяет verify-http при каждой регистрации
+    @PostMapping("/revocations")
+    public ResponseEntity<Void> publishRevocations(@RequestBody Map<String, Object> list) {
+        signerService.setRevocations(list);
+        return ResponseEntity.ok().build();
+    }
+}
@@ -1,5 +1,6 @@
 package com.example.coursachpoc.Controllers;
 
+import com.example.coursachpoc.DTOs.ChallengeDTO;
 import com.example.coursachpoc.DTOs.RingDTO;
 import com.example.coursachpoc.DTOs.SignerCreateDTO;
 import com.example.coursachpoc.Services.SignerService;
@@ -12,6 +13,11 @@ import org.springframework.web.bind.annotation.*;
 @RequiredArgsConstructor
 public class SignerController {
     private final SignerService signerService;
+    @GetMapping("/challenge")
+    public ResponseEntity<ChallengeDTO> challenge() {
+        return ResponseEntity.ok().body(signerService.issueChallenge());
+    }
+
     @PostMapping
     public ResponseEntity<Void> register(@RequestBody SignerCreateDTO signerCreateDTO) {
         signerService.createSigner(signerCreateDTO);
@@ -0,0 +1,15 @@
+package com.example.coursachpoc.DTOs;
+
+import com.fasterxml.jackson.annotation.JsonProperty;
+import lombok.AllArgsConstructor;
+import lombok.Data;
+import lombok.NoArgsConstructor;
+
+@Data
+@AllArgsConstructor
+@NoArgsConstructor
+public class BallotEntryDTO {
+    @JsonProperty("uNumber")
+    private String uNumber;
+    private String ballotB64;
+}
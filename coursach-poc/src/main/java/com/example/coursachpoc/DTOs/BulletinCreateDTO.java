@@ -5,15 +5,16 @@ import lombok.Data;
 import lombok.NoArgsConstructor;
 
 import java.util.List;
-import java.util.UUID;
 
 @Data
 @AllArgsConstructor
 @NoArgsConstructor
 public class BulletinCreateDTO {
-    private UUID candidateId;
+    private String ballotB64;
     private String signatureB64;
     private List<String> ring;
+    // дайджест кольца, заранее зарегистрированного в verify-http (PUT /rings/{digest}); заменяет ring
+    private String ringId;
     private int n;
     private int m;
 }
\ No newline at end of file
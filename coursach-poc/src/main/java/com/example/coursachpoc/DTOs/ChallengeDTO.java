@@ -0,0 +1,14 @@
+package com.example.coursachpoc.DTOs;
+
+import lombok.AllArgsConstructor;
+import lombok.Data;
+import lombok.NoArgsConstructor;
+
+@Data
+@AllArgsConstructor
+@NoArgsConstructor
+public class ChallengeDTO {
+    private String electionId;
+    private String nonce;
+    private String expiresAt;
+}
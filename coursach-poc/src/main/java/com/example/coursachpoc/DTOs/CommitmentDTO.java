@@ -0,0 +1,19 @@
+package com.example.coursachpoc.DTOs;
+
+import com.fasterxml.jackson.annotation.JsonProperty;
+import lombok.AllArgsConstructor;
+import lombok.Data;
+import lombok.NoArgsConstructor;
+
+@Data
+@AllArgsConstructor
+@NoArgsConstructor
+public class CommitmentDTO {
+    @JsonProperty("uNumber")
+    private String uNumber;
+    private String signatureB64;
+    private String commitment;
+    private String candidateId;
+    private String opening;
+    private String proof;
+}
@@ -0,0 +1,13 @@
+package com.example.coursachpoc.DTOs;
+
+import lombok.AllArgsConstructor;
+import lombok.Data;
+import lombok.NoArgsConstructor;
+
+@Data
+@AllArgsConstructor
+@NoArgsConstructor
+public class ElectionDTO {
+    private String id;
+    private String publicKey;
+}
@@ -0,0 +1,15 @@
+package com.example.coursachpoc.DTOs;
+
+import lombok.AllArgsConstructor;
+import lombok.Data;
+import lombok.NoArgsConstructor;
+
+@Data
+@AllArgsConstructor
+@NoArgsConstructor
+public class RevealDTO {
+    private String keyImage;
+    private String candidateId;
+    private String opening;
+    private String proof;
+}
@@ -4,10 +4,19 @@ import lombok.AllArgsConstructor;
 import lombok.Data;
 import lombok.NoArgsConstructor;
 
+import java.util.Map;
+
 @Data
 @AllArgsConstructor
 @NoArgsConstructor
 public class SignerCreateDTO {
     private String fullName;
     private String publicKey;
+    // nonce из GET /api/signer/challenge и подпись Шнорра, доказывающая владение ключом
+    private String nonce;
+    private String proof;
+    // удостоверение регистратора (JSON из registrar issue), если выборы его требуют
+    private Map<String, Object> credential;
+    // слепой токен регистратора при анонимной регистрации (без ФИО)
+    private Map<String, Object> token;
 }
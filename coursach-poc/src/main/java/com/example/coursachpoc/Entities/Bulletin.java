@@ -20,8 +20,25 @@ public class Bulletin {
     @Column(columnDefinition = "TEXT")
     private String rawData;
 
+    @Column(columnDefinition = "TEXT")
+    private String ballot;
+
+    // порядковый номер бюллетеня избирателя; при переголосовании растёт
+    private Long seq;
+
+    @Column(columnDefinition = "TEXT")
+    private String encryptedBallot;
+
+    @Column(columnDefinition = "TEXT")
+    private String commitment;
+
+    @Column(columnDefinition = "TEXT")
+    private String opening;
+
+    @Column(columnDefinition = "TEXT")
+    private String revealProof;
 
-    @ManyToOne(fetch = FetchType.LAZY, optional = false)
-    @JoinColumn(name = "candidate_id", nullable = false)
+    @ManyToOne(fetch = FetchType.LAZY)
+    @JoinColumn(name = "candidate_id")
     private Candidate candidate;
 }
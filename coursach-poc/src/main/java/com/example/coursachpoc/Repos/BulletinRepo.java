@@ -3,8 +3,14 @@ package com.example.coursachpoc.Repos;
 import com.example.coursachpoc.Entities.Bulletin;
 import org.springframework.data.jpa.repository.JpaRepository;
 
+import java.util.List;
+import java.util.Optional;
 import java.util.UUID;
 
 public interface BulletinRepo extends JpaRepository<Bulletin, UUID> {
     boolean existsByuNumber(String uNumber);
+    List<Bulletin> findAllByEncryptedBallotIsNotNull();
+    List<Bulletin> findAllByCommitmentIsNotNull();
+    List<Bulletin> findAllByBallotIsNotNull();
+    Optional<Bulletin> findByuNumber(String uNumber);
 }
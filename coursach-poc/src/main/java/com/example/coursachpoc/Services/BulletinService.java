@@ -1,6 +1,9 @@
 package com.example.coursachpoc.Services;
 
+import com.example.coursachpoc.DTOs.BallotEntryDTO;
 import com.example.coursachpoc.DTOs.BulletinCreateDTO;
+import com.example.coursachpoc.DTOs.CommitmentDTO;
+import com.example.coursachpoc.DTOs.RevealDTO;
 import com.example.coursachpoc.Entities.Bulletin;
 import com.example.coursachpoc.Entities.Candidate;
 import com.example.coursachpoc.Repos.BulletinRepo;
@@ -11,10 +14,16 @@ import lombok.RequiredArgsConstructor;
 import org.springframework.beans.factory.annotation.Value;
 import org.springframework.http.HttpStatus;
 import org.springframework.stereotype.Service;
+import org.springframework.web.client.HttpClientErrorException;
 import org.springframework.web.client.RestTemplate;
 import org.springframework.web.server.ResponseStatusException;
 
+import java.util.Base64;
+import java.util.HashMap;
+import java.util.HexFormat;
+import java.util.List;
 import java.util.Map;
+import java.util.UUID;
 
 @Service
 @RequiredArgsConstructor
@@ -26,44 +35,200 @@ public class BulletinService {
     @Value("${verify.url:http://localhost:8088/verify}")
     private String verifyUrl;
 
+    // реестр образов ключей в verify-http (-key-images): повтор отсекается атомарно там же;
+    // при переголосовании не используется
+    @Value("${verify.record-key-images:false}")
+    private boolean recordKeyImages;
+
+    @Value("${verify.reveal-url:http://localhost:8088/verify/reveal}")
+    private String revealUrl;
+
+    @Value("${election.id:default}")
+    private String electionId;
+
+    @Value("${election.public-key:}")
+    private String electionPublicKey;
+
+    // правило зашифрованных бюллетеней: 0 — ровно одна отметка, k — не больше k отметок
+    @Value("${election.max-choices:0}")
+    private int maxChoices;
+
+    // после открытия этапа раскрытия новые обязательства не принимаются
+    @Value("${election.reveal-open:false}")
+    private boolean revealOpen;
+
+    // окно голосования (RFC 3339); пусто — без ограничения
+    @Value("${election.voting-opens:}")
+    private String votingOpens;
+
+    @Value("${election.voting-closes:}")
+    private String votingCloses;
+
+    // повторное голосование: новый бюллетень с большим seq заменяет прежний
+    @Value("${election.revoting:false}")
+    private boolean revoting;
+
     public void submit(BulletinCreateDTO dto) {
-        // 1) верификация подписи
-        Map<String,Object> req = Map.of(
-                "message", dto.getCandidateId().toString(),
-                "signatureB64", dto.getSignatureB64(),
-                "ring", dto.getRing(),
-                "n", dto.getN(),
-                "m", dto.getM()
-        );
-
-        VerifyResponse res = rest.postForObject(verifyUrl, req, VerifyResponse.class);
-        if (res == null || !Boolean.TRUE.equals(res.getOk())) {
-            throw new ResponseStatusException(HttpStatus.BAD_REQUEST, "Invalid signature");
+        if (dto.getBallotB64() == null || dto.getBallotB64().isBlank()) {
+            throw new ResponseStatusException(HttpStatus.BAD_REQUEST, "Ballot required");
         }
-        String uNum = res.getUNumber();
 
-        // 2) проверка на повтор
-        if (repo.existsByuNumber(uNum)) {
+        // 1) верификация подписи и содержимого бюллетеня
+        Map<String,Object> req = new HashMap<>();
+        req.put("messageB64", dto.getBallotB64());
+        req.put("electionId", electionId);
+        if (!electionPublicKey.isBlank()) {
+            req.put("electionPublicKey", electionPublicKey);
+            req.put("candidates", candidateRepo.count());
+            req.put("minChoices", maxChoices == 0 ? 1 : 0);
+            req.put("maxChoices", maxChoices == 0 ? 1 : maxChoices);
+        }
+        if (!votingOpens.isBlank()) {
+            req.put("votingOpens", votingOpens);
+        }
+        if (!votingCloses.isBlank()) {
+            req.put("votingCloses", votingCloses);
+        }
+        req.put("signatureB64", dto.getSignatureB64());
+        if (dto.getRing() == null && dto.getRingId() != null) {
+            req.put("ringId", dto.getRingId());
+        } else {
+            req.put("ring", dto.getRing());
+        }
+        req.put("n", dto.getN());
+        req.put("m", dto.getM());
+
+        VerifyResponse res;
+        try {
+            res = rest.postForObject(recordKeyImages && !revoting ? verifyUrl + "?record=true" : verifyUrl,
+                    req, VerifyResponse.class);
+        } catch (HttpClientErrorException.Conflict e) {
             throw new ResponseStatusException(HttpStatus.CONFLICT, "Duplicate vote");
         }
+        if (res == null || !Boolean.TRUE.equals(res.getOk()) || res.getBallot() == null) {
+            throw new ResponseStatusException(HttpStatus.BAD_REQUEST,
+                    res != null && res.getError() != null ? res.getError() : "Invalid signature");
+        }
+        String uNum = res.getUNumber();
+        BallotInfo ballot = res.getBallot();
 
-        // 3) сохранение
-        Candidate cand = candidateRepo.findById(dto.getCandidateId())
-                .orElseThrow(() -> new ResponseStatusException(HttpStatus.NOT_FOUND, "Candidate not found"));
+        if ("commitment".equals(ballot.getType()) && revealOpen) {
+            throw new ResponseStatusException(HttpStatus.FORBIDDEN, "Voting phase is over");
+        }
+
+        // 2) проверка на повтор; при переголосовании храним только последний бюллетень
+        Bulletin prev = repo.findByuNumber(uNum).orElse(null);
+        if (prev != null) {
+            if (!revoting) {
+                throw new ResponseStatusException(HttpStatus.CONFLICT, "Duplicate vote");
+            }
+            long prevSeq = prev.getSeq() != null ? prev.getSeq() : 0;
+            if (ballot.getSeq() <= prevSeq) {
+                throw new ResponseStatusException(HttpStatus.CONFLICT, "Stale ballot");
+            }
+        }
 
+        // 3) сохранение того, что реально подписано
         Bulletin b = new Bulletin();
         b.setUNumber(uNum);
+        b.setSeq(ballot.getSeq());
         b.setRawData(dto.getSignatureB64());
-        b.setCandidate(cand);
+        b.setBallot(dto.getBallotB64());
+        switch (ballot.getType()) {
+            case "encrypted" -> b.setEncryptedBallot(ballot.getPayloadB64());
+            case "commitment" -> b.setCommitment(HexFormat.of().formatHex(Base64.getDecoder().decode(ballot.getPayloadB64())));
+            case "plurality" -> {
+                Candidate cand = candidateRepo.findById(UUID.fromString(ballot.getChoices().get(0).getCandidate()))
+                        .orElseThrow(() -> new ResponseStatusException(HttpStatus.NOT_FOUND, "Candidate not found"));
+                b.setCandidate(cand);
+            }
+            // считаются утилитой tally по списку подписанных бюллетеней
+            case "ranked", "approval", "score" -> { }
+            default -> throw new ResponseStatusException(HttpStatus.BAD_REQUEST, "Unsupported ballot type");
+        }
 
+        if (prev != null) {
+            repo.delete(prev);
+        }
         repo.save(b);
     }
 
+    public void reveal(RevealDTO dto) {
+        if (!revealOpen) {
+            throw new ResponseStatusException(HttpStatus.FORBIDDEN, "Reveal phase is not open");
+        }
+        Bulletin b = repo.findByuNumber(dto.getKeyImage())
+                .orElseThrow(() -> new ResponseStatusException(HttpStatus.NOT_FOUND, "Bulletin not found"));
+        if (b.getCommitment() == null) {
+            throw new ResponseStatusException(HttpStatus.BAD_REQUEST, "Bulletin has no commitment");
+        }
+        if (b.getOpening() != null) {
+            throw new ResponseStatusException(HttpStatus.CONFLICT, "Already revealed");
+        }
+
+        Map<String,Object> req = new HashMap<>();
+        req.put("commitment", b.getCommitment());
+        req.put("keyImage", dto.getKeyImage());
+        req.put("candidateId", dto.getCandidateId());
+        req.put("opening", dto.getOpening());
+        req.put("proof", dto.getProof());
+        VerifyResponse res = rest.postForObject(revealUrl, req, VerifyResponse.class);
+        if (res == null || !Boolean.TRUE.equals(res.getOk())) {
+            throw new ResponseStatusException(HttpStatus.BAD_REQUEST,
+                    res != null && res.getError() != null ? res.getError() : "Invalid reveal");
+        }
+
+        // голос засчитывается только если раскрытие указывает на существующего кандидата
+        Candidate cand = candidateRepo.findById(UUID.fromString(dto.getCandidateId()))
+                .orElseThrow(() -> new ResponseStatusException(HttpStatus.NOT_FOUND, "Candidate not found"));
+        b.setCandidate(cand);
+        b.setOpening(dto.getOpening());
+        b.setRevealProof(dto.getProof());
+        repo.save(b);
+    }
+
+    public List<CommitmentDTO> getCommitments() {
+        return repo.findAllByCommitmentIsNotNull().stream()
+                .map(b -> new CommitmentDTO(b.getUNumber(), b.getRawData(), b.getCommitment(),
+                        b.getCandidate() != null ? b.getCandidate().getId().toString() : null,
+                        b.getOpening(), b.getRevealProof()))
+                .toList();
+    }
+
+    public List<BallotEntryDTO> getBallots() {
+        return repo.findAllByBallotIsNotNull().stream()
+                .map(b -> new BallotEntryDTO(b.getUNumber(), b.getBallot()))
+                .toList();
+    }
+
+    public List<String> getEncryptedBallots() {
+        return repo.findAllByEncryptedBallotIsNotNull().stream()
+                .map(Bulletin::getEncryptedBallot)
+                .toList();
+    }
+
     @Data
     public static class VerifyResponse {
         private Boolean ok;
         @JsonProperty("uNumber")
         private String uNumber;
         private String error;
+        private BallotInfo ballot;
+    }
+
+    @Data
+    public static class BallotInfo {
+        private String electionId;
+        private String type;
+        private List<BallotChoice> choices;
+        private String payloadB64;
+        private long seq;
+        private String createdAt;
+    }
+
+    @Data
+    public static class BallotChoice {
+        private String candidate;
+        private long value;
     }
 }
\ No newline at end of file
@@ -0,0 +1,18 @@
+package com.example.coursachpoc.Services;
+
+import com.example.coursachpoc.DTOs.ElectionDTO;
+import org.springframework.beans.factory.annotation.Value;
+import org.springframework.stereotype.Service;
+
+@Service
+public class ElectionService {
+    @Value("${election.id:default}")
+    private String electionId;
+
+    @Value("${election.public-key:}")
+    private String electionPublicKey;
+
+    public ElectionDTO getElection() {
+        return new ElectionDTO(electionId, electionPublicKey.isBlank() ? null : electionPublicKey);
+    }
+}
@@ -1,23 +1,90 @@
 package com.example.coursachpoc.Services;
 
+import com.example.coursachpoc.DTOs.ChallengeDTO;
 import com.example.coursachpoc.DTOs.RingDTO;
 import com.example.coursachpoc.DTOs.SignerCreateDTO;
 import com.example.coursachpoc.Entities.Signer;
 import com.example.coursachpoc.Repos.SignerRepo;
+import lombok.Data;
 import lombok.RequiredArgsConstructor;
+import org.springframework.beans.factory.annotation.Value;
 import org.springframework.http.HttpStatus;
 import org.springframework.stereotype.Service;
+import org.springframework.web.client.RestTemplate;
 import org.springframework.web.server.ResponseStatusException;
 
+import java.security.SecureRandom;
+import java.time.Duration;
+import java.time.Instant;
 import java.util.*;
+import java.util.concurrent.ConcurrentHashMap;
 import java.util.stream.Collectors;
 
 @Service
 @RequiredArgsConstructor
 public class SignerService {
+    private static final Duration CHALLENGE_TTL = Duration.ofMinutes(5);
+
     private final SignerRepo signerRepo;
+    private final RestTemplate rest;
+    private final SecureRandom random = new SecureRandom();
+    // выданные nonce регистрации; каждый годится для одной попытки
+    private final Map<String, Instant> challenges = new ConcurrentHashMap<>();
+
+    @Value("${verify.possession-url:http://localhost:8088/verify/possession}")
+    private String possessionUrl;
+
+    @Value("${election.id:default}")
+    private String electionId;
+
+    // публичный ключ регистратора; пустой — удостоверения не требуются
+    @Value("${election.registrar-key:}")
+    private String registrarKey;
+
+    // актуальный список отзыва, опубликованный регистратором
+    private volatile Map<String, Object> revocations;
+
+    public void setRevocations(Map<String, Object> list) {
+        if (registrarKey.isEmpty()) {
+            throw new ResponseStatusException(HttpStatus.CONFLICT, "Election has no registrar");
+        }
+        revocations = list;
+    }
+
+    public ChallengeDTO issueChallenge() {
+        Instant now = Instant.now();
+        challenges.values().removeIf(exp -> exp.isBefore(now));
+        byte[] b = new byte[16];
+        random.nextBytes(b);
+        String nonce = HexFormat.of().formatHex(b);
+        Instant exp = now.plus(CHALLENGE_TTL);
+        challenges.put(nonce, exp);
+        return new ChallengeDTO(electionId, nonce, exp.toString());
+    }
 
     public void createSigner(SignerCreateDTO signerDTO){
+        Instant exp = signerDTO.getNonce() == null ? null : challenges.remove(signerDTO.getNonce());
+        if (exp == null || exp.isBefore(Instant.now())) {
+            throw new ResponseStatusException(HttpStatus.BAD_REQUEST, "Unknown or expired registration nonce");
+        }
+        Map<String,Object> req = new HashMap<>();
+        req.put("electionId", electionId);
+        req.put("fullName", signerDTO.getFullName());
+        req.put("publicKey", signerDTO.getPublicKey());
+        req.put("nonce", signerDTO.getNonce());
+        req.put("proof", signerDTO.getProof());
+        if (!registrarKey.isEmpty()) {
+            req.put("registrarKey", registrarKey);
+            req.put("credential", signerDTO.getCredential());
+            req.put("revocations", revocations);
+            req.put("token", signerDTO.getToken());
+        }
+        PossessionResponse res = rest.postForObject(possessionUrl, req, PossessionResponse.class);
+        if (res == null || !Boolean.TRUE.equals(res.getOk())) {
+            throw new ResponseStatusException(HttpStatus.BAD_REQUEST,
+                    res != null && res.getError() != null ? res.getError() : "Invalid proof of possession");
+        }
+
         Optional<Signer>  signerOptional = signerRepo.findSignerByPublicKey(signerDTO.getPublicKey());
         if(signerOptional.isPresent()){
             throw new ResponseStatusException(HttpStatus.BAD_REQUEST,"Signer Already Exists");
@@ -56,5 +123,11 @@ public class SignerService {
         return new RingDTO(publicKeys, (long) count, (long) realExp, 2L);
     }
 
+    @Data
+    public static class PossessionResponse {
+        private Boolean ok;
+        private String error;
+    }
+
 
 }
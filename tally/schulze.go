@@ -0,0 +1,87 @@
+package tally
+
+import "strings"
+
+// schulze computes pairwise preferences (ranked candidates beat unranked
+// ones), the strongest path strengths between every pair, and ranks
+// candidates by how many others they beat on path strength.
+func (r *Report) schulze(candidates []string, rankings [][]string) {
+	n := len(candidates)
+	idx := make(map[string]int, n)
+	for i, c := range candidates {
+		idx[c] = i
+	}
+	d := make([][]int, n)
+	for i := range d {
+		d[i] = make([]int, n)
+	}
+	for _, rk := range rankings {
+		pos := make([]int, n)
+		for i := range pos {
+			pos[i] = n
+		}
+		for p, c := range rk {
+			pos[idx[c]] = p
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				if pos[i] < pos[j] {
+					d[i][j]++
+				}
+			}
+		}
+	}
+
+	p := make([][]int, n)
+	for i := range p {
+		p[i] = make([]int, n)
+		for j := 0; j < n; j++ {
+			if i != j && d[i][j] > d[j][i] {
+				p[i][j] = d[i][j]
+			}
+		}
+	}
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			if i == k {
+				continue
+			}
+			for j := 0; j < n; j++ {
+				if j == i || j == k {
+					continue
+				}
+				if s := min(p[i][k], p[k][j]); s > p[i][j] {
+					p[i][j] = s
+				}
+			}
+		}
+	}
+
+	r.Pairwise = make(map[string]map[string]int, n)
+	wins := zeroTallies(candidates)
+	for i, a := range candidates {
+		r.Pairwise[a] = make(map[string]int, n)
+		for j, b := range candidates {
+			if i == j {
+				continue
+			}
+			r.Pairwise[a][b] = d[i][j]
+			if p[i][j] > p[j][i] {
+				wins[a]++
+			}
+		}
+	}
+
+	order := byTally(candidates, wins)
+	r.Winners = order[:r.Seats]
+	round := Round{Number: 1, Tallies: wins, Elected: r.Winners}
+	var notes []string
+	if wins[order[0]] != float64(n-1) {
+		notes = append(notes, "no candidate beats every other on path strength")
+	}
+	if r.Seats < n && wins[order[r.Seats-1]] == wins[order[r.Seats]] {
+		notes = append(notes, "tie at the last seat broken by candidate ID")
+	}
+	round.Note = strings.Join(notes, "; ")
+	r.Rounds = []Round{round}
+}
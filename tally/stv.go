@@ -0,0 +1,144 @@
+package tally
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// stv runs single transferable vote with the Droop quota; with one seat it
+// is instant-runoff. Surplus is transferred by scaling the weight of every
+// ballot currently held by an elected candidate (weighted inclusive Gregory).
+// Elimination ties are broken by the most recent round in which the tied
+// candidates differed, then by the greatest candidate ID.
+func (r *Report) stv(candidates []string, rankings [][]string, seats int) {
+	weights := make([]float64, len(rankings))
+	for i := range weights {
+		weights[i] = 1
+	}
+	hopeful := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		hopeful[c] = true
+	}
+	droop := math.Floor(float64(len(rankings))/float64(seats+1)) + 1
+	if seats > 1 {
+		r.Quota = droop
+	}
+
+	for len(r.Winners) < seats {
+		tallies := make(map[string]float64, len(hopeful))
+		for c := range hopeful {
+			tallies[c] = 0
+		}
+		holder := make([]string, len(rankings))
+		exhausted := 0.0
+		for i, rk := range rankings {
+			for _, c := range rk {
+				if hopeful[c] {
+					holder[i] = c
+					tallies[c] += weights[i]
+					break
+				}
+			}
+			if holder[i] == "" {
+				exhausted += weights[i]
+			}
+		}
+		// Fractional weights pick up float noise; round it away so that a
+		// tally equal to the quota compares equal.
+		for c := range tallies {
+			tallies[c] = math.Round(tallies[c]*1e9) / 1e9
+		}
+		exhausted = math.Round(exhausted*1e9) / 1e9
+		round := Round{Number: len(r.Rounds) + 1, Tallies: tallies, Exhausted: exhausted}
+		remaining := sortedKeys(hopeful)
+
+		if len(remaining) <= seats-len(r.Winners) {
+			round.Elected = byTally(remaining, tallies)
+			round.Note = "remaining candidates fill the remaining seats"
+			r.Winners = append(r.Winners, round.Elected...)
+			r.Rounds = append(r.Rounds, round)
+			break
+		}
+
+		// IRV elects on a majority of continuing ballots rather than the quota.
+		quota := droop
+		if seats == 1 {
+			quota = math.Floor((float64(len(rankings))-exhausted)/2) + 1
+		}
+		for _, c := range byTally(remaining, tallies) {
+			if tallies[c] >= quota && len(r.Winners)+len(round.Elected) < seats {
+				round.Elected = append(round.Elected, c)
+			}
+		}
+		if len(round.Elected) > 0 {
+			var notes []string
+			for _, c := range round.Elected {
+				factor := (tallies[c] - quota) / tallies[c]
+				for i := range rankings {
+					if holder[i] == c {
+						weights[i] *= factor
+					}
+				}
+				delete(hopeful, c)
+				if seats > 1 {
+					notes = append(notes, fmt.Sprintf("%s: surplus %.4f transferred", c, tallies[c]-quota))
+				}
+			}
+			round.Note = strings.Join(notes, "; ")
+			r.Winners = append(r.Winners, round.Elected...)
+			r.Rounds = append(r.Rounds, round)
+			continue
+		}
+
+		loser, tied := r.lowest(remaining, tallies)
+		if tied {
+			round.Note = "elimination tie broken by earlier rounds / candidate ID"
+		}
+		round.Eliminated = []string{loser}
+		delete(hopeful, loser)
+		r.Rounds = append(r.Rounds, round)
+	}
+}
+
+func (r *Report) lowest(remaining []string, tallies map[string]float64) (string, bool) {
+	min := math.Inf(1)
+	for _, c := range remaining {
+		min = math.Min(min, tallies[c])
+	}
+	var tied []string
+	for _, c := range remaining {
+		if tallies[c] == min {
+			tied = append(tied, c)
+		}
+	}
+	if len(tied) == 1 {
+		return tied[0], false
+	}
+	for k := len(r.Rounds) - 1; k >= 0 && len(tied) > 1; k-- {
+		prev := r.Rounds[k].Tallies
+		m := math.Inf(1)
+		for _, c := range tied {
+			m = math.Min(m, prev[c])
+		}
+		var next []string
+		for _, c := range tied {
+			if prev[c] == m {
+				next = append(next, c)
+			}
+		}
+		tied = next
+	}
+	sort.Strings(tied)
+	return tied[len(tied)-1], true
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,245 @@
+// Package tally counts verified ballots under several voting rules and
+// records each step so the result can be checked by hand.
+package tally
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"coursach/triptych/triptych"
+)
+
+// Entry is one accepted ballot together with the key image that signed it.
+type Entry struct {
+	KeyImage string
+	Ballot   *triptych.Ballot
+}
+
+type Method string
+
+const (
+	Plurality Method = "plurality"
+	Approval  Method = "approval"
+	Score     Method = "score"
+	Borda     Method = "borda"
+	IRV       Method = "irv"
+	STV       Method = "stv"
+	Schulze   Method = "schulze"
+)
+
+type Options struct {
+	// Seats is the number of winners; 0 means 1.
+	Seats int
+	// MaxScore bounds score ballots and is required for Score; a ballot
+	// with a higher score is invalid.
+	MaxScore uint32
+}
+
+type Report struct {
+	Method   Method                    `json:"method"`
+	Seats    int                       `json:"seats"`
+	Ballots  int                       `json:"ballots"`
+	Invalid  int                       `json:"invalid"`
+	Quota    float64                   `json:"quota,omitempty"`
+	Rounds   []Round                   `json:"rounds"`
+	Winners  []string                  `json:"winners"`
+	Pairwise map[string]map[string]int `json:"pairwise,omitempty"`
+}
+
+type Round struct {
+	Number     int                `json:"number"`
+	Tallies    map[string]float64 `json:"tallies"`
+	Exhausted  float64            `json:"exhausted,omitempty"`
+	Elected    []string           `json:"elected,omitempty"`
+	Eliminated []string           `json:"eliminated,omitempty"`
+	Note       string             `json:"note,omitempty"`
+}
+
+var (
+	ErrUnknownMethod = errors.New("unknown tally method")
+	ErrNoMaxScore    = errors.New("score tally needs a maximum score")
+)
+
+// Dedup keeps the first ballot seen for every key image.
+func Dedup(entries []Entry) []*triptych.Ballot {
+	seen := make(map[string]bool, len(entries))
+	out := make([]*triptych.Ballot, 0, len(entries))
+	for _, e := range entries {
+		if e.Ballot == nil || seen[e.KeyImage] {
+			continue
+		}
+		seen[e.KeyImage] = true
+		out = append(out, e.Ballot)
+	}
+	return out
+}
+
+// Latest applies the revoting rule to entries in log order: a ballot
+// replaces the one before it for the same key image if its Seq is higher,
+// and the last ballot standing for every key image is the one counted.
+func Latest(entries []Entry) []*triptych.Ballot {
+	pos := make(map[string]int, len(entries))
+	kept := make([]*triptych.Ballot, 0, len(entries))
+	for _, e := range entries {
+		if e.Ballot == nil {
+			continue
+		}
+		i, ok := pos[e.KeyImage]
+		switch {
+		case !ok:
+			pos[e.KeyImage] = len(kept)
+			kept = append(kept, e.Ballot)
+		case e.Ballot.Seq > kept[i].Seq:
+			kept[i] = nil
+			pos[e.KeyImage] = len(kept)
+			kept = append(kept, e.Ballot)
+		}
+	}
+	out := kept[:0]
+	for _, b := range kept {
+		if b != nil {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Run counts ballots for the given candidates with method. Ballots of a type
+// the method cannot use, or naming unknown candidates, are reported as invalid.
+func Run(method Method, candidates []string, ballots []*triptych.Ballot, opts Options) (*Report, error) {
+	if len(candidates) == 0 {
+		return nil, errors.New("no candidates")
+	}
+	seats := opts.Seats
+	if seats <= 0 {
+		seats = 1
+	}
+	if seats > len(candidates) {
+		return nil, fmt.Errorf("%d seats for %d candidates", seats, len(candidates))
+	}
+	if method == Score && opts.MaxScore == 0 {
+		return nil, ErrNoMaxScore
+	}
+	known := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		known[c] = true
+	}
+	rep := &Report{Method: method, Seats: seats}
+
+	switch method {
+	case Plurality, Approval, Score:
+		tallies := zeroTallies(candidates)
+		for _, b := range ballots {
+			if !accepts(method, b, known, opts) {
+				rep.Invalid++
+				continue
+			}
+			rep.Ballots++
+			for _, c := range b.Choices {
+				if method == Score {
+					tallies[c.Candidate] += float64(c.Value)
+				} else {
+					tallies[c.Candidate]++
+				}
+			}
+		}
+		rep.finishByPoints(candidates, tallies)
+	case Borda, IRV, STV, Schulze:
+		var rankings [][]string
+		for _, b := range ballots {
+			if !accepts(method, b, known, opts) {
+				rep.Invalid++
+				continue
+			}
+			rankings = append(rankings, b.Ranking())
+		}
+		rep.Ballots = len(rankings)
+		switch method {
+		case Borda:
+			rep.borda(candidates, rankings)
+		case IRV:
+			rep.stv(candidates, rankings, 1)
+		case STV:
+			rep.stv(candidates, rankings, seats)
+		case Schulze:
+			rep.schulze(candidates, rankings)
+		}
+	default:
+		return nil, ErrUnknownMethod
+	}
+	return rep, nil
+}
+
+func accepts(method Method, b *triptych.Ballot, known map[string]bool, opts Options) bool {
+	if b == nil {
+		return false
+	}
+	for _, c := range b.Choices {
+		if !known[c.Candidate] {
+			return false
+		}
+	}
+	switch method {
+	case Plurality:
+		return b.Type == triptych.BallotPlurality
+	case Approval:
+		return b.Type == triptych.BallotApproval || b.Type == triptych.BallotPlurality
+	case Score:
+		if b.Type != triptych.BallotScore {
+			return false
+		}
+		for _, c := range b.Choices {
+			if c.Value > opts.MaxScore {
+				return false
+			}
+		}
+		return true
+	default:
+		return b.Type == triptych.BallotRanked || b.Type == triptych.BallotPlurality
+	}
+}
+
+func zeroTallies(candidates []string) map[string]float64 {
+	t := make(map[string]float64, len(candidates))
+	for _, c := range candidates {
+		t[c] = 0
+	}
+	return t
+}
+
+// byTally orders candidates by descending tally, then by ID.
+func byTally(candidates []string, tallies map[string]float64) []string {
+	out := append([]string(nil), candidates...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if tallies[out[i]] != tallies[out[j]] {
+			return tallies[out[i]] > tallies[out[j]]
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// finishByPoints records a single round and takes the top Seats candidates.
+func (r *Report) finishByPoints(candidates []string, tallies map[string]float64) {
+	order := byTally(candidates, tallies)
+	r.Winners = order[:r.Seats]
+	round := Round{Number: 1, Tallies: tallies, Elected: r.Winners}
+	if r.Seats < len(order) && tallies[order[r.Seats-1]] == tallies[order[r.Seats]] {
+		round.Note = "tie at the last seat broken by candidate ID"
+	}
+	r.Rounds = []Round{round}
+}
+
+// borda gives n-r points for rank r (1-based) among n candidates; unranked
+// candidates get nothing.
+func (r *Report) borda(candidates []string, rankings [][]string) {
+	n := len(candidates)
+	tallies := zeroTallies(candidates)
+	for _, rk := range rankings {
+		for i, c := range rk {
+			tallies[c] += float64(n - 1 - i)
+		}
+	}
+	r.finishByPoints(candidates, tallies)
+}
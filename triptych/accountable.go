@@ -0,0 +1,246 @@
+package triptych
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+)
+
+// Accountable signatures escrow the signer's public key to an auditor:
+// C1 = r*G, C2 = P_l + r*A. The extra lists X2/Y2 reuse the Triptych
+// matrices (and so the hidden index l) to show that C2 - P_l = r*A and
+// C1 = r*G for the same r.
+
+type AccountableSignature struct {
+	Signature
+	C1 *Point
+	C2 *Point
+	X2 []*Point
+	Y2 []*Point
+	Z2 *big.Int
+}
+
+var ErrNotOpened = errors.New("ciphertext does not open to a ring member")
+
+func accountableMessage(auditorPK, c1, c2 *Point, X2, Y2 []*Point, message []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("ACCOUNT")
+	buf.Write(auditorPK.BytesCompressed())
+	buf.Write(c1.BytesCompressed())
+	buf.Write(c2.BytesCompressed())
+	for _, p := range X2 {
+		buf.Write(p.BytesCompressed())
+	}
+	for _, p := range Y2 {
+		buf.Write(p.BytesCompressed())
+	}
+	buf.Write(message)
+	return buf.Bytes()
+}
+
+func escrowDiffs(c2 *Point, ring []*Point) []*Point {
+	out := make([]*Point, len(ring))
+	for k, p := range ring {
+		out[k] = pointAdd(c2, pointNeg(p))
+	}
+	return out
+}
+
+func RingSignAccountable(seckey []byte, message []byte, ring []*Point, auditorPK *Point, n, m int) (*AccountableSignature, []*Point, error) {
+	N := 1
+	for i := 0; i < m; i++ {
+		N *= n
+	}
+	if len(ring) != N {
+		return nil, nil, ErrRingSize{Need: N, Got: len(ring)}
+	}
+	if auditorPK == nil || auditorPK.Inf {
+		return nil, nil, errors.New("auditor key is required")
+	}
+
+	realPub := PubKeyFromSecret(seckey)
+	ringSh := make([]*Point, len(ring))
+	copy(ringSh, ring)
+	for i := len(ringSh) - 1; i > 0; i-- {
+		j := randomInt(i + 1)
+		ringSh[i], ringSh[j] = ringSh[j], ringSh[i]
+	}
+	l := -1
+	for i, p := range ringSh {
+		if bytes.Equal(p.BytesCompressed(), realPub.BytesCompressed()) {
+			l = i
+			break
+		}
+	}
+	if l == -1 {
+		return nil, nil, ErrNoRealKey
+	}
+
+	G := NewPoint(Gx, Gy)
+	r := randScalar()
+	c1 := pointScalarMult(r, G)
+	c2 := pointAdd(realPub, pointScalarMult(r, auditorPK))
+
+	commA, randA, matrixA := triptychGetA(n, m)
+	commB, randB, matrixS := triptychGetB(n, m, l)
+	commC, randC, _ := triptychGetC(matrixA, matrixS)
+	commD, randD, _ := triptychGetD(matrixA)
+
+	polys := triptychPolys(matrixS, matrixA, N, n, m)
+
+	rhos := make([]*big.Int, m)
+	rhos2 := make([]*big.Int, m)
+	for j := 0; j < m; j++ {
+		rhos[j] = randScalar()
+		rhos2[j] = randScalar()
+	}
+	X := triptychGetX(polys, ringSh, rhos, G)
+	Y := triptychGetY(rhos)
+	X2 := triptychGetX(polys, escrowDiffs(c2, ringSh), rhos2, auditorPK)
+	Y2 := make([]*Point, m)
+	for j := 0; j < m; j++ {
+		Y2[j] = pointScalarMult(rhos2[j], G)
+	}
+
+	msg := accountableMessage(auditorPK, c1, c2, X2, Y2, message)
+	x := transcriptHash(commA, commB, commC, commD, X, Y, ringSh, msg)
+	f := triptychGetF(matrixS, matrixA, x)
+
+	sk := scalarFromBytes32(seckey)
+	sig := &AccountableSignature{
+		Signature: Signature{
+			CommA: commA, CommB: commB, CommC: commC, CommD: commD,
+			X: X, Y: Y, F: f,
+			ZA: scalarAdd(randA, scalarMul(x, randB)),
+			ZC: scalarAdd(scalarMul(randC, x), randD),
+			Z:  triptychGetZ(sk, rhos, x),
+			U:  pointScalarMult(sk, JPoint),
+		},
+		C1: c1, C2: c2, X2: X2, Y2: Y2,
+		Z2: triptychGetZ(r, rhos2, x),
+	}
+	return sig, ringSh, nil
+}
+
+func VerifyAccountable(sig *AccountableSignature, message []byte, ring []*Point, auditorPK *Point, n, m int) (bool, []byte) {
+	if sig == nil || !finitePoint(auditorPK) || len(sig.X2) != m || len(sig.Y2) != m || sig.Z2 == nil {
+		return false, nil
+	}
+	if !allFinite([]*Point{sig.C1, sig.C2}, sig.X2, sig.Y2) {
+		return false, nil
+	}
+	msg := accountableMessage(auditorPK, sig.C1, sig.C2, sig.X2, sig.Y2, message)
+	ok, uNum := VerifyTriptych(&sig.Signature, msg, ring, n, m)
+	if !ok {
+		return false, nil
+	}
+
+	x := transcriptHash(sig.CommA, sig.CommB, sig.CommC, sig.CommD, sig.X, sig.Y, ring, msg)
+	f := deepCopyMatrix(sig.F)
+	if !triptychCheckMatrices(f, sig.CommA, sig.CommB, sig.CommC, sig.CommD, sig.ZA, sig.ZC, x, n, m) {
+		return false, nil
+	}
+
+	diffs := escrowDiffs(sig.C2, ring)
+	sumDiff := NewInfinity()
+	for k, prodf := range triptychRingProducts(f, len(ring), n, m) {
+		sumDiff = pointAdd(sumDiff, pointScalarMult(prodf, diffs[k]))
+	}
+	if !PointsEqual(sumDiff, pointAdd(powerSum(sig.X2, x), pointScalarMult(sig.Z2, auditorPK))) {
+		return false, nil
+	}
+	lhs := pointScalarMult(scalarPow(x, m), sig.C1)
+	if !PointsEqual(lhs, pointAdd(powerSum(sig.Y2, x), pointScalarMult(sig.Z2, NewPoint(Gx, Gy)))) {
+		return false, nil
+	}
+	return true, uNum
+}
+
+func openingContext(sig *AccountableSignature) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("OPEN")
+	buf.Write(sig.U.BytesCompressed())
+	buf.Write(sig.C1.BytesCompressed())
+	buf.Write(sig.C2.BytesCompressed())
+	return buf.Bytes()
+}
+
+// Open decrypts the escrowed public key. The returned proof shows that the
+// opening used the secret key behind the published auditor key.
+func Open(auditorSK []byte, sig *AccountableSignature) (*Point, *DLEQProof, error) {
+	if sig == nil || sig.C1 == nil || sig.C2 == nil {
+		return nil, nil, errors.New("signature carries no escrow")
+	}
+	a := scalarFromBytes32(auditorSK)
+	shared := pointScalarMult(a, sig.C1)
+	pk := pointAdd(sig.C2, pointNeg(shared))
+	proof := proveDLEQ(a, NewPoint(Gx, Gy), baseScalarMult(a), sig.C1, shared, openingContext(sig))
+	return pk, proof, nil
+}
+
+func VerifyOpening(auditorPK *Point, sig *AccountableSignature, pk *Point, proof *DLEQProof) bool {
+	if sig == nil || sig.C1 == nil || sig.C2 == nil || pk == nil {
+		return false
+	}
+	shared := pointAdd(sig.C2, pointNeg(pk))
+	return verifyDLEQ(proof, NewPoint(Gx, Gy), auditorPK, sig.C1, shared, openingContext(sig))
+}
+
+// OpenInRing is Open followed by a lookup of the recovered key in the ring.
+func OpenInRing(auditorSK []byte, sig *AccountableSignature, ring []*Point) (int, *Point, *DLEQProof, error) {
+	pk, proof, err := Open(auditorSK, sig)
+	if err != nil {
+		return -1, nil, nil, err
+	}
+	for i, p := range ring {
+		if PointsEqual(p, pk) {
+			return i, pk, proof, nil
+		}
+	}
+	return -1, pk, proof, ErrNotOpened
+}
+
+func SerializeAccountable(sig *AccountableSignature) (raw []byte, keyImage []byte) {
+	base, keyImg := Serialize(&sig.Signature)
+	var buf bytes.Buffer
+	buf.Write(base)
+	buf.Write(sig.C1.BytesCompressed())
+	buf.Write(sig.C2.BytesCompressed())
+	for _, p := range sig.X2 {
+		buf.Write(p.BytesCompressed())
+	}
+	for _, p := range sig.Y2 {
+		buf.Write(p.BytesCompressed())
+	}
+	buf.Write(scalarBytes32(sig.Z2))
+	return buf.Bytes(), keyImg
+}
+
+func DeserializeAccountable(raw []byte, m, n int, keyImg []byte) (*AccountableSignature, error) {
+	baseLen := 4*33 + 2*m*33 + m*(n-1)*32 + 3*32
+	extLen := 2*33 + 2*m*33 + 32
+	if len(raw) != baseLen+extLen {
+		return nil, errors.New("invalid raw length for given m,n")
+	}
+	base, err := Deserialize(raw[:baseLen], m, n, keyImg)
+	if err != nil {
+		return nil, err
+	}
+	ext := raw[baseLen:]
+	pts := make([]*Point, 2+2*m)
+	for i := range pts {
+		P, err := parseFinite(ext[i*33 : (i+1)*33])
+		if err != nil {
+			return nil, err
+		}
+		pts[i] = P
+	}
+	return &AccountableSignature{
+		Signature: *base,
+		C1:        pts[0],
+		C2:        pts[1],
+		X2:        pts[2 : 2+m],
+		Y2:        pts[2+m:],
+		Z2:        scalarFromBytes32(ext[len(ext)-32:]),
+	}, nil
+}
@@ -0,0 +1,60 @@
+package triptych
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAccountable(t *testing.T) {
+	sk, ring := testRing(t)
+	auditorSK, auditorPK := GenerateKey()
+	msg := []byte("ballot")
+	sig, ringSh, err := RingSignAccountable(sk, msg, ring, auditorPK, testN, testM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ki := SerializeAccountable(sig)
+	got, err := DeserializeAccountable(raw, testM, testN, ki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := VerifyAccountable(got, msg, ringSh, auditorPK, testN, testM); !ok {
+		t.Fatal("valid accountable signature rejected")
+	}
+	_, pk, proof, err := OpenInRing(auditorSK, got, ringSh)
+	if err != nil || !PointsEqual(pk, PubKeyFromSecret(sk)) || !VerifyOpening(auditorPK, got, pk, proof) {
+		t.Fatalf("opening: %v", err)
+	}
+
+	raw[len(raw)-1] ^= 1
+	if bad, err := DeserializeAccountable(raw, testM, testN, ki); err != nil {
+		t.Fatal(err)
+	} else if ok, _ := VerifyAccountable(bad, msg, ringSh, auditorPK, testN, testM); ok {
+		t.Fatal("accountable signature with a flipped byte verified")
+	}
+}
+
+func TestAccountableMalformed(t *testing.T) {
+	sk, ring := testRing(t)
+	_, auditorPK := GenerateKey()
+	msg := []byte("ballot")
+	sig, ringSh, err := RingSignAccountable(sk, msg, ring, auditorPK, testN, testM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ki := SerializeAccountable(sig)
+	baseLen := 4*33 + 2*testM*33 + testM*(testN-1)*32 + 3*32
+	copy(raw[baseLen:], make([]byte, 33))
+	if _, err := DeserializeAccountable(raw, testM, testN, ki); !errors.Is(err, ErrIdentity) {
+		t.Fatalf("identity C1: got %v", err)
+	}
+
+	s := *sig
+	s.C2 = NewInfinity()
+	if ok, _ := VerifyAccountable(&s, msg, ringSh, auditorPK, testN, testM); ok {
+		t.Fatal("identity C2 verified")
+	}
+	if ok, _ := VerifyAccountable(sig, msg, ringSh, NewInfinity(), testN, testM); ok {
+		t.Fatal("identity auditor key verified")
+	}
+}
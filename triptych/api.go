@@ -15,3 +15,7 @@ func PubKeyFromSecret(sk []byte) *Point {
 	k := scalarFromBytes32(sk)
 	return baseScalarMult(k)
 }
+
+// KeyImage is the uNumber every signature made with sk carries, so a voter
+// can find their own ballots on the board before signing a new one.
+func KeyImage(sk *Scalar) *Point { return pointScalarMult(sk.int(), JPoint) }
@@ -0,0 +1,302 @@
+package triptych
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// Ballot is the message a voter signs. Binding the election ID and the ring
+// digest stops a signature from being replayed in another election or with
+// another ring; the nonce makes two otherwise identical ballots distinct.
+// Seq orders the ballots cast with one key: where revoting is allowed a
+// later ballot supersedes an earlier one only if its Seq is higher.
+//
+// Wire format (big-endian):
+//
+//	version u8 | type u8 | len u16 | electionID | ringDigest [32] | nonce [16] |
+//	seq u32 | createdAt i64 (unix seconds) | count u16 | count × (len u16 | candidate | value u32) |
+//	len u32 | payload
+//
+// Choices are sorted by candidate ID with no duplicates. For plurality and
+// approval ballots every value is 1, ranked ballots hold ranks 1..k, score
+// ballots hold the score itself. Payload carries the encrypted ballot or the
+// commitment for the corresponding ballot types.
+type Ballot struct {
+	ElectionID string
+	RingDigest [32]byte
+	Type       BallotType
+	Choices    []BallotChoice
+	Nonce      [16]byte
+	Seq        uint32
+	CreatedAt  time.Time
+	Payload    []byte
+}
+
+type BallotChoice struct {
+	Candidate string `json:"candidate"`
+	Value     uint32 `json:"value"`
+}
+
+type BallotType uint8
+
+const (
+	BallotPlurality BallotType = iota + 1
+	BallotEncrypted
+	BallotCommitment
+	BallotRanked
+	BallotApproval
+	BallotScore
+)
+
+const ballotVersion = 2
+
+var (
+	ErrNonCanonical  = errors.New("ballot encoding is not canonical")
+	ErrWrongElection = errors.New("ballot is for another election")
+	ErrWrongRing     = errors.New("ballot was made for another ring")
+)
+
+func (t BallotType) String() string {
+	switch t {
+	case BallotPlurality:
+		return "plurality"
+	case BallotEncrypted:
+		return "encrypted"
+	case BallotCommitment:
+		return "commitment"
+	case BallotRanked:
+		return "ranked"
+	case BallotApproval:
+		return "approval"
+	case BallotScore:
+		return "score"
+	}
+	return fmt.Sprintf("type-%d", uint8(t))
+}
+
+// RingDigest hashes the ring as a set, so it does not depend on the order
+// the signer shuffled it into.
+func RingDigest(ring []*Point) [32]byte {
+	var buf bytes.Buffer
+	buf.WriteString("RING")
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(ring)))
+	for _, p := range canonicalRing(ring) {
+		buf.Write(p.BytesCompressed())
+	}
+	return sha256.Sum256(buf.Bytes())
+}
+
+// CanonicalRing returns the ring sorted by compressed key, the order
+// RingSignCanonical signs over.
+func CanonicalRing(ring []*Point) []*Point { return canonicalRing(ring) }
+
+// NewBallot fills in a fresh nonce and the current time and sorts choices.
+func NewBallot(electionID string, ring []*Point, typ BallotType, choices []BallotChoice, payload []byte) (*Ballot, error) {
+	b := &Ballot{
+		ElectionID: electionID,
+		RingDigest: RingDigest(ring),
+		Type:       typ,
+		Choices:    append([]BallotChoice(nil), choices...),
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+		Payload:    payload,
+	}
+	if _, err := rand.Read(b.Nonce[:]); err != nil {
+		return nil, err
+	}
+	sort.Slice(b.Choices, func(i, j int) bool { return b.Choices[i].Candidate < b.Choices[j].Candidate })
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Validate checks the rules Bytes relies on for a canonical encoding and
+// the per-type shape of choices and payload.
+func (b *Ballot) Validate() error {
+	if b.ElectionID == "" || len(b.ElectionID) > 0xffff || !utf8.ValidString(b.ElectionID) {
+		return errors.New("bad election id")
+	}
+	if len(b.Choices) > 0xffff || int64(len(b.Payload)) > 0xffffffff {
+		return errors.New("ballot too large")
+	}
+	for i, c := range b.Choices {
+		if c.Candidate == "" || len(c.Candidate) > 0xffff || !utf8.ValidString(c.Candidate) {
+			return errors.New("bad candidate id")
+		}
+		if i > 0 && b.Choices[i-1].Candidate >= c.Candidate {
+			return errors.New("choices must be sorted and unique")
+		}
+	}
+	switch b.Type {
+	case BallotPlurality:
+		if len(b.Choices) != 1 || b.Choices[0].Value != 1 || len(b.Payload) != 0 {
+			return errors.New("plurality ballot must have exactly one choice")
+		}
+	case BallotEncrypted, BallotCommitment:
+		if len(b.Choices) != 0 || len(b.Payload) == 0 {
+			return fmt.Errorf("%s ballot carries only a payload", b.Type)
+		}
+	case BallotRanked:
+		if len(b.Choices) == 0 || len(b.Payload) != 0 {
+			return errors.New("ranked ballot must rank at least one candidate")
+		}
+		seen := make([]bool, len(b.Choices)+1)
+		for _, c := range b.Choices {
+			if c.Value < 1 || int(c.Value) > len(b.Choices) || seen[c.Value] {
+				return errors.New("ranks must be 1..k without gaps or ties")
+			}
+			seen[c.Value] = true
+		}
+	case BallotApproval:
+		if len(b.Payload) != 0 {
+			return errors.New("approval ballot has no payload")
+		}
+		for _, c := range b.Choices {
+			if c.Value != 1 {
+				return errors.New("approval values must be 1")
+			}
+		}
+	case BallotScore:
+		if len(b.Choices) == 0 || len(b.Payload) != 0 {
+			return errors.New("score ballot must score at least one candidate")
+		}
+	default:
+		return fmt.Errorf("unknown ballot type %d", uint8(b.Type))
+	}
+	return nil
+}
+
+func (b *Ballot) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(ballotVersion)
+	buf.WriteByte(byte(b.Type))
+	writeString16(&buf, b.ElectionID)
+	buf.Write(b.RingDigest[:])
+	buf.Write(b.Nonce[:])
+	_ = binary.Write(&buf, binary.BigEndian, b.Seq)
+	_ = binary.Write(&buf, binary.BigEndian, b.CreatedAt.Unix())
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(b.Choices)))
+	for _, c := range b.Choices {
+		writeString16(&buf, c.Candidate)
+		_ = binary.Write(&buf, binary.BigEndian, c.Value)
+	}
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(b.Payload)))
+	buf.Write(b.Payload)
+	return buf.Bytes()
+}
+
+func writeString16(buf *bytes.Buffer, s string) {
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+// ParseBallot decodes a ballot and rejects anything that would not
+// re-encode to the same bytes.
+func ParseBallot(raw []byte) (*Ballot, error) {
+	r := bytes.NewReader(raw)
+	var hdr [2]byte
+	if _, err := r.Read(hdr[:]); err != nil || hdr[0] != ballotVersion {
+		return nil, errors.New("unsupported ballot version")
+	}
+	b := &Ballot{Type: BallotType(hdr[1])}
+	var err error
+	if b.ElectionID, err = readString16(r); err != nil {
+		return nil, err
+	}
+	if err := readFull(r, b.RingDigest[:]); err != nil {
+		return nil, err
+	}
+	if err := readFull(r, b.Nonce[:]); err != nil {
+		return nil, err
+	}
+	var created int64
+	var count uint16
+	if err := binary.Read(r, binary.BigEndian, &b.Seq); err != nil {
+		return nil, ErrNonCanonical
+	}
+	if err := binary.Read(r, binary.BigEndian, &created); err != nil {
+		return nil, ErrNonCanonical
+	}
+	b.CreatedAt = time.Unix(created, 0).UTC()
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, ErrNonCanonical
+	}
+	for i := 0; i < int(count); i++ {
+		var c BallotChoice
+		if c.Candidate, err = readString16(r); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.BigEndian, &c.Value); err != nil {
+			return nil, ErrNonCanonical
+		}
+		b.Choices = append(b.Choices, c)
+	}
+	var plen uint32
+	if err := binary.Read(r, binary.BigEndian, &plen); err != nil || int64(plen) != int64(r.Len()) {
+		return nil, ErrNonCanonical
+	}
+	if plen > 0 {
+		b.Payload = make([]byte, plen)
+		_ = readFull(r, b.Payload)
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b.Bytes(), raw) {
+		return nil, ErrNonCanonical
+	}
+	return b, nil
+}
+
+func readString16(r *bytes.Reader) (string, error) {
+	var l uint16
+	if err := binary.Read(r, binary.BigEndian, &l); err != nil || int(l) > r.Len() {
+		return "", ErrNonCanonical
+	}
+	s := make([]byte, l)
+	_ = readFull(r, s)
+	return string(s), nil
+}
+
+func readFull(r *bytes.Reader, dst []byte) error {
+	if r.Len() < len(dst) {
+		return ErrNonCanonical
+	}
+	_, _ = r.Read(dst)
+	return nil
+}
+
+// CheckContext ties a parsed ballot to the election and ring it is being
+// verified against. An empty electionID skips the election check.
+func (b *Ballot) CheckContext(electionID string, ring []*Point) error {
+	if electionID != "" && b.ElectionID != electionID {
+		return ErrWrongElection
+	}
+	if b.RingDigest != RingDigest(ring) {
+		return ErrWrongRing
+	}
+	return nil
+}
+
+// Ranking returns the candidates of a ranked or plurality ballot, most
+// preferred first.
+func (b *Ballot) Ranking() []string {
+	switch b.Type {
+	case BallotPlurality:
+		return []string{b.Choices[0].Candidate}
+	case BallotRanked:
+		out := make([]string, len(b.Choices))
+		for _, c := range b.Choices {
+			out[c.Value-1] = c.Candidate
+		}
+		return out
+	}
+	return nil
+}
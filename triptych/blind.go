@@ -0,0 +1,166 @@
+package triptych
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Blind Schnorr signatures let the registrar certify a voter's key without
+// seeing it, so the board cannot link a registered key to a name even with
+// the registrar's help.
+//
+//	signer:  k random, R = k·G                 -> R
+//	user:    α, β random, R' = R + α·G + β·X,
+//	         c' = H(X, R', m), c = c' + β      -> c
+//	signer:  s = k + c·x                       -> s
+//	user:    s' = s + α; (R', s') verifies as s'·G = R' + c'·X
+//
+// Blind Schnorr is forgeable through the ROS attack when the signer answers
+// many sessions concurrently: with more than ~256 open sessions a user gets
+// one more signature than sessions in polynomial time, and Wagner's
+// algorithm needs about 2^(256/(1+⌊log2(ℓ+1)⌋)) work for ℓ sessions. The
+// signer therefore keeps at most MaxBlindSessions open at a time, which
+// leaves the birthday bound of 2^128; sessions expire after
+// BlindSessionTTL and are never answered afterwards.
+
+const (
+	MaxBlindSessions = 2
+	BlindSessionTTL  = 30 * time.Second
+)
+
+var (
+	ErrBlindBusy    = errors.New("too many blind signing sessions in progress")
+	ErrBlindSession = errors.New("unknown or expired blind signing session")
+	ErrBadBlindSig  = errors.New("blind signature does not verify")
+	ErrBadToken     = errors.New("eligibility token is invalid")
+)
+
+// BlindSignature is the unblinded signature (R', s').
+type BlindSignature struct {
+	R *Point  `json:"r"`
+	S *Scalar `json:"s"`
+}
+
+func blindChallenge(signerKey, R *Point, msg []byte) *Scalar {
+	var buf bytes.Buffer
+	buf.WriteString("BLINDSIG")
+	buf.Write(signerKey.BytesCompressed())
+	buf.Write(R.BytesCompressed())
+	buf.Write(msg)
+	return HashToScalar(buf.Bytes())
+}
+
+func VerifyBlindSignature(signerKey *Point, msg []byte, sig *BlindSignature) bool {
+	if sig == nil || sig.R.IsIdentity() || sig.S == nil || signerKey.IsIdentity() {
+		return false
+	}
+	c := blindChallenge(signerKey, sig.R, msg)
+	return ScalarBaseMult(sig.S).Equal(sig.R.Add(signerKey.Mul(c)))
+}
+
+type blindSession struct {
+	k       *Scalar
+	expires time.Time
+}
+
+// BlindSigner is the signer's side. It is safe for concurrent use and
+// enforces MaxBlindSessions.
+type BlindSigner struct {
+	key      *Scalar
+	mu       sync.Mutex
+	sessions map[string]blindSession
+}
+
+func NewBlindSigner(key *Scalar) *BlindSigner {
+	return &BlindSigner{key: key, sessions: map[string]blindSession{}}
+}
+
+// Commit opens a session and returns its id and R.
+func (b *BlindSigner) Commit(now time.Time) (string, *Point, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, s := range b.sessions {
+		if now.After(s.expires) {
+			delete(b.sessions, id)
+		}
+	}
+	if len(b.sessions) >= MaxBlindSessions {
+		return "", nil, ErrBlindBusy
+	}
+	var raw [16]byte
+	_, _ = rand.Read(raw[:])
+	id := hex.EncodeToString(raw[:])
+	k := RandomScalar()
+	b.sessions[id] = blindSession{k: k, expires: now.Add(BlindSessionTTL)}
+	return id, ScalarBaseMult(k), nil
+}
+
+// Respond answers the blinded challenge c and closes the session; each
+// nonce is used at most once.
+func (b *BlindSigner) Respond(id string, c *Scalar, now time.Time) (*Scalar, error) {
+	b.mu.Lock()
+	s, ok := b.sessions[id]
+	delete(b.sessions, id)
+	b.mu.Unlock()
+	if !ok || now.After(s.expires) || c == nil {
+		return nil, ErrBlindSession
+	}
+	return s.k.Add(c.Mul(b.key)), nil
+}
+
+// Abort closes a session without answering it.
+func (b *BlindSigner) Abort(id string) {
+	b.mu.Lock()
+	delete(b.sessions, id)
+	b.mu.Unlock()
+}
+
+// Blinder is the user's side of one session.
+type Blinder struct {
+	signerKey *Point
+	msg       []byte
+	alpha     *Scalar
+	r         *Point
+}
+
+// Blind takes the signer's R and returns the challenge to send back.
+func Blind(signerKey, R *Point, msg []byte) (*Blinder, *Scalar) {
+	alpha, beta := RandomScalar(), RandomScalar()
+	r := R.Add(ScalarBaseMult(alpha)).Add(signerKey.Mul(beta))
+	c := blindChallenge(signerKey, r, msg).Add(beta)
+	return &Blinder{signerKey: signerKey, msg: append([]byte(nil), msg...), alpha: alpha, r: r}, c
+}
+
+// Unblind turns the signer's answer into a signature on the message and
+// checks it, so a cheating signer is caught here.
+func (u *Blinder) Unblind(s *Scalar) (*BlindSignature, error) {
+	if s == nil {
+		return nil, ErrBadBlindSig
+	}
+	sig := &BlindSignature{R: u.r, S: s.Add(u.alpha)}
+	if !VerifyBlindSignature(u.signerKey, u.msg, sig) {
+		return nil, ErrBadBlindSig
+	}
+	return sig, nil
+}
+
+// EligibilityMessage is what the registrar blindly signs: the voter's key
+// in one election. The resulting token carries no name.
+func EligibilityMessage(electionID string, pk *Point) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("ELIGIBLE")
+	writeString16(&buf, electionID)
+	buf.Write(pk.BytesCompressed())
+	return buf.Bytes()
+}
+
+func VerifyEligibility(registrarKey *Point, electionID string, pk *Point, token *BlindSignature) error {
+	if pk.IsIdentity() || len(electionID) > 0xffff || !VerifyBlindSignature(registrarKey, EligibilityMessage(electionID, pk), token) {
+		return ErrBadToken
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package triptych
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blindToken runs one signing session for pk and returns the token.
+func blindToken(t *testing.T, signer *BlindSigner, signerKey *Point, pk *Point) *BlindSignature {
+	t.Helper()
+	now := time.Now()
+	id, R, err := signer.Commit(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, c := Blind(signerKey, R, EligibilityMessage("e1", pk))
+	s, err := signer.Respond(id, c, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := u.Unblind(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestBlindRoundTrip(t *testing.T) {
+	sk := RandomScalar()
+	regPK := ScalarBaseMult(sk)
+	pk := ScalarBaseMult(RandomScalar())
+	sig := blindToken(t, NewBlindSigner(sk), regPK, pk)
+
+	var got BlindSignature
+	raw, err := sig.R.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.R = new(Point)
+	if err := got.R.UnmarshalText(raw); err != nil {
+		t.Fatal(err)
+	}
+	raw, err = sig.S.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.S = new(Scalar)
+	if err := got.S.UnmarshalText(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyEligibility(regPK, "e1", pk, &got); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+}
+
+func TestBlindTamper(t *testing.T) {
+	sk := RandomScalar()
+	regPK := ScalarBaseMult(sk)
+	pk := ScalarBaseMult(RandomScalar())
+	sig := blindToken(t, NewBlindSigner(sk), regPK, pk)
+
+	if err := VerifyEligibility(regPK, "e2", pk, sig); !errors.Is(err, ErrBadToken) {
+		t.Fatalf("other election: got %v", err)
+	}
+	if err := VerifyEligibility(regPK, "e1", ScalarBaseMult(RandomScalar()), sig); !errors.Is(err, ErrBadToken) {
+		t.Fatalf("other key: got %v", err)
+	}
+	if err := VerifyEligibility(ScalarBaseMult(RandomScalar()), "e1", pk, sig); !errors.Is(err, ErrBadToken) {
+		t.Fatalf("other registrar: got %v", err)
+	}
+	raw := sig.S.Bytes()
+	raw[len(raw)-1] ^= 1
+	s, err := ScalarFromBytes(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyEligibility(regPK, "e1", pk, &BlindSignature{R: sig.R, S: s}); !errors.Is(err, ErrBadToken) {
+		t.Fatalf("flipped byte in s: got %v", err)
+	}
+
+	// A signer answering with the wrong key is caught when unblinding.
+	signer := NewBlindSigner(RandomScalar())
+	now := time.Now()
+	id, R, err := signer.Commit(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, c := Blind(regPK, R, EligibilityMessage("e1", pk))
+	s, err = signer.Respond(id, c, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Unblind(s); !errors.Is(err, ErrBadBlindSig) {
+		t.Fatalf("answer under another key: got %v", err)
+	}
+}
+
+func TestBlindMalformed(t *testing.T) {
+	sk := RandomScalar()
+	regPK := ScalarBaseMult(sk)
+	pk := ScalarBaseMult(RandomScalar())
+	sig := blindToken(t, NewBlindSigner(sk), regPK, pk)
+
+	for name, bad := range map[string]*BlindSignature{
+		"nil token":  nil,
+		"identity R": {R: NewInfinity(), S: sig.S},
+		"nil R":      {S: sig.S},
+		"nil s":      {R: sig.R},
+	} {
+		if err := VerifyEligibility(regPK, "e1", pk, bad); !errors.Is(err, ErrBadToken) {
+			t.Fatalf("%s: got %v", name, err)
+		}
+	}
+	for _, key := range []*Point{nil, NewInfinity()} {
+		if err := VerifyEligibility(key, "e1", pk, sig); !errors.Is(err, ErrBadToken) {
+			t.Fatalf("identity registrar key: got %v", err)
+		}
+		if err := VerifyEligibility(regPK, "e1", key, sig); !errors.Is(err, ErrBadToken) {
+			t.Fatalf("identity voter key: got %v", err)
+		}
+	}
+	// A token's R comes from JSON, where 33 zero bytes decode to the identity.
+	var zero Point
+	if err := zero.UnmarshalText([]byte(strings.Repeat("00", 33))); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyEligibility(regPK, "e1", pk, &BlindSignature{R: &zero, S: sig.S}); !errors.Is(err, ErrBadToken) {
+		t.Fatalf("zero R: got %v", err)
+	}
+
+	// A signer that sends the identity as R, or a user blinding against
+	// an identity key, ends up with nothing that verifies.
+	signer := NewBlindSigner(sk)
+	u, c := Blind(regPK, NewInfinity(), EligibilityMessage("e1", pk))
+	if _, err := u.Unblind(c); !errors.Is(err, ErrBadBlindSig) {
+		t.Fatalf("identity R: got %v", err)
+	}
+	now := time.Now()
+	id, R, err := signer.Commit(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, c = Blind(NewInfinity(), R, EligibilityMessage("e1", pk))
+	s, err := signer.Respond(id, c, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Unblind(s); !errors.Is(err, ErrBadBlindSig) {
+		t.Fatalf("identity signer key: got %v", err)
+	}
+	if _, err := u.Unblind(nil); !errors.Is(err, ErrBadBlindSig) {
+		t.Fatalf("missing answer: got %v", err)
+	}
+}
+
+func TestBlindSessions(t *testing.T) {
+	signer := NewBlindSigner(RandomScalar())
+	now := time.Now()
+	ids := make([]string, MaxBlindSessions)
+	for i := range ids {
+		id, _, err := signer.Commit(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	if _, _, err := signer.Commit(now); !errors.Is(err, ErrBlindBusy) {
+		t.Fatalf("session over the limit: got %v", err)
+	}
+	c := RandomScalar()
+	if _, err := signer.Respond(ids[0], c, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Respond(ids[0], c, now); !errors.Is(err, ErrBlindSession) {
+		t.Fatalf("second answer: got %v", err)
+	}
+	if _, err := signer.Respond(ids[1], nil, now); !errors.Is(err, ErrBlindSession) {
+		t.Fatalf("missing challenge: got %v", err)
+	}
+
+	id, _, err := signer.Commit(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Respond(id, c, now.Add(BlindSessionTTL+time.Second)); !errors.Is(err, ErrBlindSession) {
+		t.Fatalf("expired session: got %v", err)
+	}
+	id, _, err = signer.Commit(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.Abort(id)
+	if _, err := signer.Respond(id, c, now); !errors.Is(err, ErrBlindSession) {
+		t.Fatalf("aborted session: got %v", err)
+	}
+	for i := 0; i < MaxBlindSessions; i++ {
+		if _, _, err := signer.Commit(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := signer.Commit(now.Add(BlindSessionTTL + time.Second)); err != nil {
+		t.Fatalf("expired sessions still count: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package triptych
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// Bulletin log: every accepted ballot becomes a LogEntry that names the
+// chain head before it, and the entries are the leaves of a Merkle tree.
+// The board signs tree heads; a voter's receipt is their entry, a signed
+// tree head and the inclusion proof linking the two. Consistency proofs
+// between tree heads show that nothing was dropped or rewritten since.
+
+// LogEntry is one accepted ballot. Its leaf hash is the chain head after it,
+// so each entry commits to every entry before it.
+type LogEntry struct {
+	Index      uint64 `json:"index"`
+	PrevHead   Hash   `json:"prevHead"`
+	Ballot     []byte `json:"ballot"`
+	Signature  []byte `json:"signature"`
+	AcceptedAt int64  `json:"acceptedAt"`
+}
+
+// SignedTreeHead is the board's statement about the log at TreeSize
+// entries. Timestamp is in unix milliseconds.
+type SignedTreeHead struct {
+	TreeSize  uint64            `json:"treeSize"`
+	Timestamp int64             `json:"timestamp"`
+	RootHash  Hash              `json:"rootHash"`
+	ChainHead Hash              `json:"chainHead"`
+	Signature *SchnorrSignature `json:"signature"`
+}
+
+// Receipt is what a voter keeps to later prove their ballot was logged.
+type Receipt struct {
+	Entry     LogEntry       `json:"entry"`
+	TreeHead  SignedTreeHead `json:"treeHead"`
+	Inclusion []Hash         `json:"inclusion"`
+}
+
+var (
+	ErrBadTreeHead = errors.New("tree head signature is invalid")
+	ErrBrokenChain = errors.New("log entry does not follow the chain head")
+)
+
+// Bytes is the canonical leaf encoding:
+//
+//	"BBLOG" | index u64 | prevHead [32] | acceptedAt i64 |
+//	len u32 | ballot | len u32 | signature
+func (e *LogEntry) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("BBLOG")
+	_ = binary.Write(&buf, binary.BigEndian, e.Index)
+	buf.Write(e.PrevHead[:])
+	_ = binary.Write(&buf, binary.BigEndian, e.AcceptedAt)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(e.Ballot)))
+	buf.Write(e.Ballot)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(e.Signature)))
+	buf.Write(e.Signature)
+	return buf.Bytes()
+}
+
+func (e *LogEntry) LeafHash() Hash { return MerkleLeafHash(e.Bytes()) }
+
+// VerifyLogChain checks that entries start at index 0 and each names the
+// head left by the previous one, and returns the final chain head.
+func VerifyLogChain(entries []LogEntry) (Hash, error) {
+	var head Hash
+	for i := range entries {
+		if entries[i].Index != uint64(i) || entries[i].PrevHead != head {
+			return Hash{}, ErrBrokenChain
+		}
+		head = entries[i].LeafHash()
+	}
+	return head, nil
+}
+
+func (h *SignedTreeHead) signedBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("TREEHEAD")
+	_ = binary.Write(&buf, binary.BigEndian, h.TreeSize)
+	_ = binary.Write(&buf, binary.BigEndian, h.Timestamp)
+	buf.Write(h.RootHash[:])
+	buf.Write(h.ChainHead[:])
+	return buf.Bytes()
+}
+
+func (h *SignedTreeHead) Sign(sk *Scalar) {
+	h.Signature = SchnorrSign(sk, h.signedBytes())
+}
+
+func (h *SignedTreeHead) Verify(logPK *Point) error {
+	if !VerifySchnorr(logPK, h.signedBytes(), h.Signature) {
+		return ErrBadTreeHead
+	}
+	return nil
+}
+
+// Verify checks the tree head signature and the inclusion of the entry. If
+// the tree head was taken right after the entry, its chain head must be the
+// entry's own.
+func (r *Receipt) Verify(logPK *Point) error {
+	if err := r.TreeHead.Verify(logPK); err != nil {
+		return err
+	}
+	leaf := r.Entry.LeafHash()
+	if r.TreeHead.TreeSize == r.Entry.Index+1 && r.TreeHead.ChainHead != leaf {
+		return ErrBrokenChain
+	}
+	return VerifyInclusion(leaf, r.Entry.Index, r.TreeHead.TreeSize, r.Inclusion, r.TreeHead.RootHash)
+}
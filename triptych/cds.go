@@ -0,0 +1,106 @@
+package triptych
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+)
+
+// DisjunctiveProof is a Cramer–Damgård–Schoenmakers OR-proof that an
+// exponential ElGamal ciphertext encrypts one of a public list of values.
+// Branch i holds the challenge and response for value Values[i]; the
+// commitments are recomputed by the verifier.
+type DisjunctiveProof struct {
+	C []*big.Int
+	S []*big.Int
+}
+
+func cdsChallenge(pk *Point, ct *Ciphertext, values []int, context []byte, commits []*Point) *big.Int {
+	var buf bytes.Buffer
+	buf.WriteString("CDS")
+	buf.Write(context)
+	buf.Write(pk.BytesCompressed())
+	buf.Write(ct.Bytes())
+	for _, v := range values {
+		buf.Write(scalarBytes32(NewScalar(big.NewInt(int64(v))).int()))
+	}
+	for _, p := range commits {
+		buf.Write(p.BytesCompressed())
+	}
+	return hashToScalar(buf.Bytes())
+}
+
+func cdsShifted(ct *Ciphertext, v int) *Point {
+	return pointAdd(ct.C2, pointNeg(pointScalarMult(NewScalar(big.NewInt(int64(v))).int(), NewPoint(Gx, Gy))))
+}
+
+// ProveEncryptsOneOf proves that ct = EncryptExp(pk, values[index], r).
+func ProveEncryptsOneOf(pk *Point, ct *Ciphertext, values []int, index int, r *Scalar, context []byte) (*DisjunctiveProof, error) {
+	if index < 0 || index >= len(values) {
+		return nil, errors.New("index out of range")
+	}
+	G := NewPoint(Gx, Gy)
+	k := len(values)
+	proof := &DisjunctiveProof{C: make([]*big.Int, k), S: make([]*big.Int, k)}
+	commits := make([]*Point, 2*k)
+	sumC := big.NewInt(0)
+	w := randScalar()
+	for i, v := range values {
+		if i == index {
+			commits[2*i] = pointScalarMult(w, G)
+			commits[2*i+1] = pointScalarMult(w, pk)
+			continue
+		}
+		c, s := randScalar(), randScalar()
+		proof.C[i], proof.S[i] = c, s
+		sumC = scalarAdd(sumC, c)
+		commits[2*i] = pointAdd(pointScalarMult(s, G), pointNeg(pointScalarMult(c, ct.C1)))
+		commits[2*i+1] = pointAdd(pointScalarMult(s, pk), pointNeg(pointScalarMult(c, cdsShifted(ct, v))))
+	}
+	c := cdsChallenge(pk, ct, values, context, commits)
+	proof.C[index] = scalarSub(c, sumC)
+	proof.S[index] = scalarAdd(w, scalarMul(proof.C[index], r.int()))
+	return proof, nil
+}
+
+func VerifyEncryptsOneOf(pk *Point, ct *Ciphertext, values []int, proof *DisjunctiveProof, context []byte) bool {
+	if proof == nil || ct == nil || len(proof.C) != len(values) || len(proof.S) != len(values) {
+		return false
+	}
+	G := NewPoint(Gx, Gy)
+	commits := make([]*Point, 2*len(values))
+	sumC := big.NewInt(0)
+	for i, v := range values {
+		c, s := proof.C[i], proof.S[i]
+		sumC = scalarAdd(sumC, c)
+		commits[2*i] = pointAdd(pointScalarMult(s, G), pointNeg(pointScalarMult(c, ct.C1)))
+		commits[2*i+1] = pointAdd(pointScalarMult(s, pk), pointNeg(pointScalarMult(c, cdsShifted(ct, v))))
+	}
+	return cdsChallenge(pk, ct, values, context, commits).Cmp(sumC) == 0
+}
+
+func (p *DisjunctiveProof) Bytes() []byte {
+	var buf bytes.Buffer
+	for i := range p.C {
+		buf.Write(scalarBytes32(p.C[i]))
+		buf.Write(scalarBytes32(p.S[i]))
+	}
+	return buf.Bytes()
+}
+
+func parseDisjunctiveProof(b []byte, branches int) *DisjunctiveProof {
+	p := &DisjunctiveProof{C: make([]*big.Int, branches), S: make([]*big.Int, branches)}
+	for i := 0; i < branches; i++ {
+		p.C[i] = scalarFromBytes32(b[i*64 : i*64+32])
+		p.S[i] = scalarFromBytes32(b[i*64+32 : i*64+64])
+	}
+	return p
+}
+
+func valueRange(lo, hi int) []int {
+	out := make([]int, 0, hi-lo+1)
+	for v := lo; v <= hi; v++ {
+		out = append(out, v)
+	}
+	return out
+}
@@ -17,19 +17,43 @@ func grwzsr(n, m int) [][]*big.Int {
 	return mat
 }
 
-func matrixPedersenCommit(matrix [][]*big.Int, randomness *big.Int) *Point {
-	rows := len(matrix)
-	cols := len(matrix[0])
-	H := getMatrixNUMS(rows, cols)
+// vectorPedersenCommit commits values[i] under getLabeledNUMS(label, i).
+func vectorPedersenCommit(label string, values []*big.Int, randomness *big.Int) *Point {
 	var pts []*Point
-	for i := 0; i < rows; i++ {
-		for j := 0; j < cols; j++ {
-			if matrix[i][j].Sign() == 0 {
-				continue
-			}
-			pts = append(pts, pointScalarMult(matrix[i][j], H[i][j]))
+	for i, v := range values {
+		if v.Sign() == 0 {
+			continue
 		}
+		pts = append(pts, pointScalarMult(v, getLabeledNUMS(label, i)))
 	}
 	pts = append(pts, pointScalarMult(randomness, NewPoint(Gx, Gy)))
 	return pointsSum(pts)
 }
+
+func matrixPedersenCommit(matrix [][]*big.Int, randomness *big.Int) *Point {
+	rows := len(matrix)
+	cols := len(matrix[0])
+	flat := make([]*big.Int, 0, rows*cols)
+	for i := 0; i < rows; i++ {
+		flat = append(flat, matrix[i][:cols]...)
+	}
+	return vectorPedersenCommit("NUMS", flat, randomness)
+}
+
+// ValueGenerator is the H in PedersenCommit's v*H + r*G.
+func ValueGenerator() *Point { return getNUMS(0) }
+
+func PedersenCommit(value, blind *Scalar) *Point {
+	return vectorPedersenCommit("NUMS", []*big.Int{value.int()}, blind.int())
+}
+
+// VectorCommit commits to values[i] under the i-th "VCOMMIT" generator.
+// These are kept apart from the "NUMS" ones, one of which is JPoint, so no
+// length of vector reuses the key-image base.
+func VectorCommit(values []*Scalar, blind *Scalar) *Point {
+	vals := make([]*big.Int, len(values))
+	for i, v := range values {
+		vals[i] = v.int()
+	}
+	return vectorPedersenCommit("VCOMMIT", vals, blind.int())
+}
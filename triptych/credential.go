@@ -0,0 +1,124 @@
+package triptych
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Credential is the registrar's statement that FullName is eligible to vote
+// in ElectionID with PublicKey. The registrar works offline and signs it
+// after checking the voter's identity; the board then accepts only keys
+// that come with a valid credential that is not on the revocation list.
+type Credential struct {
+	ElectionID string            `json:"electionId"`
+	FullName   string            `json:"fullName"`
+	PublicKey  *Point            `json:"publicKey"`
+	Serial     string            `json:"serial"`
+	IssuedAt   time.Time         `json:"issuedAt"`
+	Signature  *SchnorrSignature `json:"signature"`
+}
+
+// RevocationList names the credential serials the registrar has withdrawn.
+// A newer list replaces an older one, so it always carries every serial
+// revoked so far, sorted.
+type RevocationList struct {
+	ElectionID string            `json:"electionId"`
+	Serials    []string          `json:"serials"`
+	IssuedAt   time.Time         `json:"issuedAt"`
+	Signature  *SchnorrSignature `json:"signature"`
+}
+
+var (
+	ErrBadCredential  = errors.New("credential is invalid")
+	ErrRevoked        = errors.New("credential is revoked")
+	ErrBadRevocations = errors.New("revocation list is invalid")
+)
+
+func (c *Credential) signedBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("CREDENTIAL")
+	writeString16(&buf, c.ElectionID)
+	writeString16(&buf, c.FullName)
+	buf.Write(c.PublicKey.BytesCompressed())
+	writeString16(&buf, c.Serial)
+	writeTime(&buf, c.IssuedAt)
+	return buf.Bytes()
+}
+
+func (c *Credential) Sign(registrarKey *Scalar) {
+	c.Signature = SchnorrSign(registrarKey, c.signedBytes())
+}
+
+// Verify checks the registrar's signature only; Check also binds the
+// credential to a registration.
+func (c *Credential) Verify(registrarKey *Point) error {
+	if c == nil || c.PublicKey.IsIdentity() || c.Serial == "" || len(c.ElectionID) > 0xffff || len(c.FullName) > 0xffff || len(c.Serial) > 0xffff ||
+		!VerifySchnorr(registrarKey, c.signedBytes(), c.Signature) {
+		return ErrBadCredential
+	}
+	return nil
+}
+
+// Check accepts the credential for registering pk under fullName in
+// electionID, unless the revocation list (which may be nil) names it.
+func (c *Credential) Check(registrarKey *Point, electionID, fullName string, pk *Point, revoked *RevocationList) error {
+	if err := c.Verify(registrarKey); err != nil {
+		return err
+	}
+	if c.ElectionID != electionID || c.FullName != fullName || !c.PublicKey.Equal(pk) {
+		return ErrBadCredential
+	}
+	if revoked.Revoked(c.Serial) {
+		return ErrRevoked
+	}
+	return nil
+}
+
+func (l *RevocationList) signedBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("REVOCATIONS")
+	writeString16(&buf, l.ElectionID)
+	writeTime(&buf, l.IssuedAt)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(l.Serials)))
+	for _, s := range l.Serials {
+		writeString16(&buf, s)
+	}
+	return buf.Bytes()
+}
+
+// Sign sorts and deduplicates the serials and signs the list.
+func (l *RevocationList) Sign(registrarKey *Scalar) {
+	sorted := append([]string(nil), l.Serials...)
+	sort.Strings(sorted)
+	l.Serials = []string{}
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			l.Serials = append(l.Serials, s)
+		}
+	}
+	l.Signature = SchnorrSign(registrarKey, l.signedBytes())
+}
+
+func (l *RevocationList) Verify(registrarKey *Point) error {
+	if l == nil || !sort.StringsAreSorted(l.Serials) || !VerifySchnorr(registrarKey, l.signedBytes(), l.Signature) {
+		return ErrBadRevocations
+	}
+	for i, s := range l.Serials {
+		if len(s) > 0xffff || (i > 0 && s == l.Serials[i-1]) {
+			return ErrBadRevocations
+		}
+	}
+	return nil
+}
+
+// Revoked reports whether serial is on the list; a nil list revokes nothing.
+func (l *RevocationList) Revoked(serial string) bool {
+	if l == nil {
+		return false
+	}
+	i := sort.SearchStrings(l.Serials, serial)
+	return i < len(l.Serials) && l.Serials[i] == serial
+}
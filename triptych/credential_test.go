@@ -0,0 +1,143 @@
+package triptych
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCredential(t *testing.T) (*Scalar, *Credential) {
+	t.Helper()
+	sk := RandomScalar()
+	c := &Credential{
+		ElectionID: "e1",
+		FullName:   "Иванов Иван",
+		PublicKey:  ScalarBaseMult(RandomScalar()),
+		Serial:     "0001",
+		IssuedAt:   time.Unix(1700000000, 0).UTC(),
+	}
+	c.Sign(sk)
+	return sk, c
+}
+
+func TestCredentialRoundTrip(t *testing.T) {
+	sk, c := testCredential(t)
+	raw, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Credential
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	regPK := ScalarBaseMult(sk)
+	if err := got.Check(regPK, "e1", c.FullName, c.PublicKey, nil); err != nil {
+		t.Fatalf("valid credential rejected: %v", err)
+	}
+
+	l := &RevocationList{ElectionID: "e1", Serials: []string{"0003", "0001", "0003"}}
+	l.Sign(sk)
+	if err := l.Verify(regPK); err != nil {
+		t.Fatalf("valid revocation list rejected: %v", err)
+	}
+	if len(l.Serials) != 2 || !l.Revoked("0003") || l.Revoked("0002") {
+		t.Fatalf("revocation list not sorted and deduplicated: %v", l.Serials)
+	}
+	if err := got.Check(regPK, "e1", c.FullName, c.PublicKey, l); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("revoked credential: got %v, want ErrRevoked", err)
+	}
+}
+
+func TestCredentialTamper(t *testing.T) {
+	sk, c := testCredential(t)
+	regPK := ScalarBaseMult(sk)
+	if err := c.Check(regPK, "e2", c.FullName, c.PublicKey, nil); !errors.Is(err, ErrBadCredential) {
+		t.Fatalf("other election: got %v", err)
+	}
+	if err := c.Check(regPK, "e1", "Петров Пётр", c.PublicKey, nil); !errors.Is(err, ErrBadCredential) {
+		t.Fatalf("other name: got %v", err)
+	}
+	if err := c.Check(regPK, "e1", c.FullName, ScalarBaseMult(RandomScalar()), nil); !errors.Is(err, ErrBadCredential) {
+		t.Fatalf("other key: got %v", err)
+	}
+	if err := c.Verify(ScalarBaseMult(RandomScalar())); !errors.Is(err, ErrBadCredential) {
+		t.Fatalf("other registrar: got %v", err)
+	}
+
+	raw := c.Signature.Bytes()
+	raw[len(raw)-1] ^= 1
+	sig, err := ParseSchnorrSignature(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := *c
+	bad.Signature = sig
+	if err := bad.Verify(regPK); !errors.Is(err, ErrBadCredential) {
+		t.Fatalf("flipped signature byte: got %v", err)
+	}
+	bad = *c
+	bad.Serial = "0002"
+	if err := bad.Verify(regPK); !errors.Is(err, ErrBadCredential) {
+		t.Fatalf("altered serial: got %v", err)
+	}
+
+	l := &RevocationList{ElectionID: "e1", Serials: []string{"0001"}}
+	l.Sign(sk)
+	l.Serials = nil
+	if err := l.Verify(regPK); !errors.Is(err, ErrBadRevocations) {
+		t.Fatalf("emptied revocation list: got %v", err)
+	}
+}
+
+func TestCredentialMalformed(t *testing.T) {
+	sk, c := testCredential(t)
+	regPK := ScalarBaseMult(sk)
+
+	bad := *c
+	bad.PublicKey = NewInfinity()
+	bad.Sign(sk)
+	if err := bad.Verify(regPK); !errors.Is(err, ErrBadCredential) {
+		t.Fatalf("identity voter key: got %v", err)
+	}
+	bad.PublicKey = nil
+	if err := bad.Verify(regPK); !errors.Is(err, ErrBadCredential) {
+		t.Fatalf("missing voter key: got %v", err)
+	}
+	bad = *c
+	bad.Signature = nil
+	if err := bad.Verify(regPK); !errors.Is(err, ErrBadCredential) {
+		t.Fatalf("missing signature: got %v", err)
+	}
+	for _, key := range []*Point{nil, NewInfinity()} {
+		if err := c.Verify(key); !errors.Is(err, ErrBadCredential) {
+			t.Fatalf("identity registrar key: got %v", err)
+		}
+	}
+	var none *Credential
+	if err := none.Verify(regPK); !errors.Is(err, ErrBadCredential) {
+		t.Fatalf("nil credential: got %v", err)
+	}
+	var noList *RevocationList
+	if err := noList.Verify(regPK); !errors.Is(err, ErrBadRevocations) {
+		t.Fatalf("nil revocation list: got %v", err)
+	}
+
+	// A zero public key in JSON decodes to the identity and must not pass.
+	raw, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero := strings.Repeat("00", 33)
+	raw = bytes.Replace(raw, []byte(hex.EncodeToString(c.PublicKey.BytesCompressed())), []byte(zero), 1)
+	var got Credential
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := got.Verify(regPK); !errors.Is(err, ErrBadCredential) {
+		t.Fatalf("zero voter key: got %v", err)
+	}
+}
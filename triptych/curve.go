@@ -83,10 +83,13 @@ func sqrtModP(a *big.Int) (*big.Int, bool) {
 
 func pointAdd(P, Q *Point) *Point {
 	if P == nil || P.Inf {
-		return &Point{X: new(big.Int).Set(Q.X), Y: new(big.Int).Set(Q.Y), Inf: Q.Inf}
+		if Q == nil || Q.Inf {
+			return NewInfinity()
+		}
+		return NewPoint(Q.X, Q.Y)
 	}
 	if Q == nil || Q.Inf {
-		return &Point{X: new(big.Int).Set(P.X), Y: new(big.Int).Set(P.Y), Inf: P.Inf}
+		return NewPoint(P.X, P.Y)
 	}
 	if P.X.Cmp(Q.X) == 0 {
 		sumY := modAdd(P.Y, Q.Y, secpP)
@@ -118,6 +121,13 @@ func pointDouble(P *Point) *Point {
 	return NewPoint(x3, y3)
 }
 
+func pointNeg(P *Point) *Point {
+	if P == nil || P.Inf {
+		return NewInfinity()
+	}
+	return NewPoint(P.X, modSub(big.NewInt(0), P.Y, secpP))
+}
+
 func pointScalarMult(k *big.Int, P *Point) *Point {
 	if P == nil || P.Inf {
 		return NewInfinity()
@@ -194,6 +204,39 @@ func ParseCompressed(b []byte) (*Point, error) {
 	return P, nil
 }
 
+// ErrIdentity is returned for the point at infinity where a proof, key or
+// ciphertext needs a real point.
+var ErrIdentity = errors.New("point at infinity is not allowed here")
+
+// finitePoint reports whether P is a usable point other than the identity.
+func finitePoint(P *Point) bool {
+	return P != nil && !P.Inf && P.X != nil && P.Y != nil
+}
+
+// allFinite reports whether every point in every group is finite.
+func allFinite(groups ...[]*Point) bool {
+	for _, g := range groups {
+		for _, P := range g {
+			if !finitePoint(P) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseFinite is ParseCompressed for points that may not be the identity.
+func parseFinite(b []byte) (*Point, error) {
+	P, err := ParseCompressed(b)
+	if err != nil {
+		return nil, err
+	}
+	if P.Inf {
+		return nil, ErrIdentity
+	}
+	return P, nil
+}
+
 func PointsEqual(a, b *Point) bool {
 	if a.Inf && b.Inf {
 		return true
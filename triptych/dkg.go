@@ -0,0 +1,298 @@
+package triptych
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+)
+
+// Distributed key generation for t-of-n trustees (Joint-Feldman VSS).
+// Trustees are numbered 1..n. Dealer i picks a random polynomial f_i of
+// degree t-1, publishes Feldman commitments a_ik*G and hands f_i(j) to
+// trustee j. Trustee j's key share is the sum of f_i(j) over all dealers,
+// the election key is the sum of the constant-term commitments.
+
+// DealerCommitment is the public part of a dealing. Proof shows knowledge
+// of the constant term so a dealer cannot cancel someone else's key.
+type DealerCommitment struct {
+	Dealer      int        `json:"dealer"`
+	Commitments []*Point   `json:"commitments"`
+	Proof       *DLEQProof `json:"proof"`
+}
+
+// EncryptedShare carries f_i(j) to trustee j: V = share + H(r*PK_j) with R = r*G.
+type EncryptedShare struct {
+	Recipient int     `json:"recipient"`
+	R         *Point  `json:"r"`
+	V         *Scalar `json:"v"`
+}
+
+type Dealing struct {
+	Commitment *DealerCommitment `json:"commitment"`
+	Shares     []*EncryptedShare `json:"shares"`
+}
+
+// DecryptionShare holds x_j*C1 for each ciphertext together with a
+// Chaum–Pedersen proof that the same x_j is behind the verification key.
+type DecryptionShare struct {
+	Trustee int          `json:"trustee"`
+	D       []*Point     `json:"d"`
+	Proofs  []*DLEQProof `json:"proofs"`
+}
+
+var (
+	ErrBadThreshold = errors.New("threshold must satisfy 1 <= t <= n")
+	ErrBadDealing   = errors.New("dealing does not match its commitments")
+	ErrFewShares    = errors.New("not enough decryption shares")
+)
+
+func checkThreshold(t, n int) error {
+	if t < 1 || n < 1 || t > n {
+		return ErrBadThreshold
+	}
+	return nil
+}
+
+func dealerContext(dealer int) []byte {
+	return binary.BigEndian.AppendUint32([]byte("DKG-DEALER"), uint32(dealer))
+}
+
+// NewDealing creates dealer's polynomial and encrypts its evaluations to the
+// trustees' transport keys; transportKeys[j-1] belongs to trustee j.
+func NewDealing(dealer, t int, transportKeys []*Point) (*Dealing, error) {
+	n := len(transportKeys)
+	if err := checkThreshold(t, n); err != nil {
+		return nil, err
+	}
+	if dealer < 1 || dealer > n {
+		return nil, errors.New("dealer index out of range")
+	}
+	G := NewPoint(Gx, Gy)
+	coeffs := make([]*big.Int, t)
+	c := &DealerCommitment{Dealer: dealer, Commitments: make([]*Point, t)}
+	for k := range coeffs {
+		coeffs[k] = randScalar()
+		c.Commitments[k] = pointScalarMult(coeffs[k], G)
+	}
+	c.Proof = proveDLEQ(coeffs[0], G, c.Commitments[0], G, c.Commitments[0], dealerContext(dealer))
+
+	d := &Dealing{Commitment: c, Shares: make([]*EncryptedShare, n)}
+	for j := 1; j <= n; j++ {
+		share := &Scalar{k: evalPoly(coeffs, j)}
+		d.Shares[j-1] = encryptShare(transportKeys[j-1], share, dealer, j)
+	}
+	return d, nil
+}
+
+func evalPoly(coeffs []*big.Int, x int) *big.Int {
+	X := big.NewInt(int64(x))
+	acc := big.NewInt(0)
+	for k := len(coeffs) - 1; k >= 0; k-- {
+		acc = scalarAdd(scalarMul(acc, X), coeffs[k])
+	}
+	return acc
+}
+
+func sharePad(shared *Point, dealer, recipient int) *big.Int {
+	var buf bytes.Buffer
+	buf.WriteString("DKG-SHARE")
+	buf.Write(shared.BytesCompressed())
+	_ = binary.Write(&buf, binary.BigEndian, uint32(dealer))
+	_ = binary.Write(&buf, binary.BigEndian, uint32(recipient))
+	return hashToScalar(buf.Bytes())
+}
+
+func encryptShare(pk *Point, share *Scalar, dealer, recipient int) *EncryptedShare {
+	r := randScalar()
+	pad := sharePad(pointScalarMult(r, pk), dealer, recipient)
+	return &EncryptedShare{
+		Recipient: recipient,
+		R:         pointScalarMult(r, NewPoint(Gx, Gy)),
+		V:         &Scalar{k: scalarAdd(share.int(), pad)},
+	}
+}
+
+// OpenShare decrypts the share addressed to the holder of transportSK and
+// checks it against the dealer's commitments.
+func (d *Dealing) OpenShare(recipient int, transportSK *Scalar) (*Scalar, error) {
+	if d == nil || d.Commitment == nil || recipient < 1 || recipient > len(d.Shares) {
+		return nil, ErrBadDealing
+	}
+	es := d.Shares[recipient-1]
+	if es == nil || es.Recipient != recipient || !finitePoint(es.R) || es.V == nil {
+		return nil, ErrBadDealing
+	}
+	pad := sharePad(pointScalarMult(transportSK.int(), es.R), d.Commitment.Dealer, recipient)
+	share := &Scalar{k: scalarSub(es.V.int(), pad)}
+	if !VerifyShare(d.Commitment, recipient, share) {
+		return nil, ErrBadDealing
+	}
+	return share, nil
+}
+
+// VerifyDealerCommitment checks the proof of knowledge of the constant term.
+func VerifyDealerCommitment(c *DealerCommitment, t int) bool {
+	if c == nil || len(c.Commitments) != t || t < 1 {
+		return false
+	}
+	for _, P := range c.Commitments {
+		if P.IsIdentity() {
+			return false
+		}
+	}
+	G := NewPoint(Gx, Gy)
+	A0 := c.Commitments[0]
+	return verifyDLEQ(c.Proof, G, A0, G, A0, dealerContext(c.Dealer))
+}
+
+// VerifyShare checks share*G == sum_k A_k * j^k.
+func VerifyShare(c *DealerCommitment, recipient int, share *Scalar) bool {
+	if c == nil || len(c.Commitments) == 0 {
+		return false
+	}
+	return PointsEqual(baseScalarMult(share.int()), evalCommitments(c.Commitments, recipient))
+}
+
+func evalCommitments(commitments []*Point, x int) *Point {
+	X := big.NewInt(int64(x))
+	acc := NewInfinity()
+	for k := len(commitments) - 1; k >= 0; k-- {
+		acc = pointAdd(pointScalarMult(X, acc), commitments[k])
+	}
+	return acc
+}
+
+// DKGPublicKey is the election key implied by the qualified dealers. It is
+// the identity if any commitment is missing, which no election key equals.
+func DKGPublicKey(commitments []*DealerCommitment) *Point {
+	Y := NewInfinity()
+	for _, c := range commitments {
+		if c == nil || len(c.Commitments) == 0 {
+			return NewInfinity()
+		}
+		Y = pointAdd(Y, c.Commitments[0])
+	}
+	return Y
+}
+
+// VerificationKey returns x_j*G for trustee j, computable by anyone. Like
+// DKGPublicKey it is the identity if any commitment is missing.
+func VerificationKey(commitments []*DealerCommitment, trustee int) *Point {
+	Y := NewInfinity()
+	for _, c := range commitments {
+		if c == nil || len(c.Commitments) == 0 {
+			return NewInfinity()
+		}
+		Y = pointAdd(Y, evalCommitments(c.Commitments, trustee))
+	}
+	return Y
+}
+
+func CombineKeyShares(shares []*Scalar) *Scalar {
+	x := ScalarFromInt(0)
+	for _, s := range shares {
+		x = x.Add(s)
+	}
+	return x
+}
+
+func decryptionContext(trustee, k int) []byte {
+	out := binary.BigEndian.AppendUint32([]byte("DKG-DECRYPT"), uint32(trustee))
+	return binary.BigEndian.AppendUint32(out, uint32(k))
+}
+
+func PartialDecrypt(trustee int, share *Scalar, cts []*Ciphertext) *DecryptionShare {
+	G := NewPoint(Gx, Gy)
+	vk := baseScalarMult(share.int())
+	ds := &DecryptionShare{Trustee: trustee, D: make([]*Point, len(cts)), Proofs: make([]*DLEQProof, len(cts))}
+	for k, ct := range cts {
+		ds.D[k] = pointScalarMult(share.int(), ct.C1)
+		ds.Proofs[k] = proveDLEQ(share.int(), G, vk, ct.C1, ds.D[k], decryptionContext(trustee, k))
+	}
+	return ds
+}
+
+func VerifyDecryptionShare(vk *Point, cts []*Ciphertext, ds *DecryptionShare) bool {
+	if ds == nil || len(ds.D) != len(cts) || len(ds.Proofs) != len(cts) || !finitePoint(vk) {
+		return false
+	}
+	G := NewPoint(Gx, Gy)
+	for k, ct := range cts {
+		if !ct.finite() || !finitePoint(ds.D[k]) {
+			return false
+		}
+		if !verifyDLEQ(ds.Proofs[k], G, vk, ct.C1, ds.D[k], decryptionContext(ds.Trustee, k)) {
+			return false
+		}
+	}
+	return true
+}
+
+func lagrangeAtZero(j int, set []int) *big.Int {
+	num, den := big.NewInt(1), big.NewInt(1)
+	for _, m := range set {
+		if m == j {
+			continue
+		}
+		num = scalarMul(num, big.NewInt(int64(m)))
+		den = scalarMul(den, NewScalar(big.NewInt(int64(m-j))).int())
+	}
+	return scalarMul(num, modInv(den, secpN))
+}
+
+// CombineDecryptionShares recovers m_k*G for every ciphertext from any t
+// shares. The shares must already be verified; extra shares are ignored.
+func CombineDecryptionShares(cts []*Ciphertext, shares []*DecryptionShare, t int) ([]*Point, error) {
+	for _, ct := range cts {
+		if !ct.finite() {
+			return nil, errors.New("ciphertext has an identity or missing component")
+		}
+	}
+	seen := make(map[int]bool)
+	var use []*DecryptionShare
+	for _, ds := range shares {
+		if ds == nil || ds.Trustee < 1 || seen[ds.Trustee] || len(ds.D) != len(cts) {
+			continue
+		}
+		seen[ds.Trustee] = true
+		use = append(use, ds)
+		if len(use) == t {
+			break
+		}
+	}
+	if t < 1 || len(use) < t {
+		return nil, ErrFewShares
+	}
+	set := make([]int, len(use))
+	for i, ds := range use {
+		set[i] = ds.Trustee
+	}
+	out := make([]*Point, len(cts))
+	for k, ct := range cts {
+		acc := NewInfinity()
+		for _, ds := range use {
+			acc = pointAdd(acc, pointScalarMult(lagrangeAtZero(ds.Trustee, set), ds.D[k]))
+		}
+		out[k] = pointAdd(ct.C2, pointNeg(acc))
+	}
+	return out, nil
+}
+
+func (p *DLEQProof) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(p.Bytes())), nil
+}
+
+func (p *DLEQProof) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	q, err := ParseDLEQProof(b)
+	if err != nil {
+		return err
+	}
+	*p = *q
+	return nil
+}
@@ -0,0 +1,173 @@
+package triptych
+
+import (
+	"errors"
+	"testing"
+)
+
+const testT, testTrustees = 2, 3
+
+// runDKG deals among testTrustees trustees and returns the commitments and
+// every trustee's combined key share; shares[j-1] belongs to trustee j.
+func runDKG(t *testing.T) ([]*DealerCommitment, []*Scalar) {
+	t.Helper()
+	transportSK := make([]*Scalar, testTrustees)
+	transportPK := make([]*Point, testTrustees)
+	for j := range transportSK {
+		transportSK[j] = RandomScalar()
+		transportPK[j] = ScalarBaseMult(transportSK[j])
+	}
+	var commits []*DealerCommitment
+	got := make([][]*Scalar, testTrustees)
+	for dealer := 1; dealer <= testTrustees; dealer++ {
+		d, err := NewDealing(dealer, testT, transportPK)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyDealerCommitment(d.Commitment, testT) {
+			t.Fatalf("dealer %d: valid commitment rejected", dealer)
+		}
+		for j := 1; j <= testTrustees; j++ {
+			s, err := d.OpenShare(j, transportSK[j-1])
+			if err != nil {
+				t.Fatalf("dealer %d, trustee %d: %v", dealer, j, err)
+			}
+			got[j-1] = append(got[j-1], s)
+		}
+		commits = append(commits, d.Commitment)
+	}
+	shares := make([]*Scalar, testTrustees)
+	for j := range shares {
+		shares[j] = CombineKeyShares(got[j])
+		if !ScalarBaseMult(shares[j]).Equal(VerificationKey(commits, j+1)) {
+			t.Fatalf("trustee %d: share does not match its verification key", j+1)
+		}
+	}
+	return commits, shares
+}
+
+func TestThresholdDecryption(t *testing.T) {
+	commits, shares := runDKG(t)
+	pk := DKGPublicKey(commits)
+	cts := []*Ciphertext{
+		EncryptExp(pk, 3, RandomScalar()).Add(EncryptExp(pk, 4, RandomScalar())),
+		EncryptExp(pk, 0, RandomScalar()),
+	}
+	// Trustees 1 and 3 are enough; trustee 2 stays offline.
+	var ds []*DecryptionShare
+	for _, j := range []int{3, 1} {
+		d := PartialDecrypt(j, shares[j-1], cts)
+		if !VerifyDecryptionShare(VerificationKey(commits, j), cts, d) {
+			t.Fatalf("trustee %d: valid decryption share rejected", j)
+		}
+		ds = append(ds, d)
+	}
+	if _, err := CombineDecryptionShares(cts, ds[:1], testT); !errors.Is(err, ErrFewShares) {
+		t.Fatalf("one share: got %v, want ErrFewShares", err)
+	}
+	points, err := CombineDecryptionShares(cts, ds, testT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range []int{7, 0} {
+		m, err := SolveDLog(points[k], 10)
+		if err != nil || m != want {
+			t.Fatalf("ciphertext %d: got %d, %v; want %d", k, m, err, want)
+		}
+	}
+}
+
+func TestDKGTamper(t *testing.T) {
+	transportSK := RandomScalar()
+	pks := []*Point{ScalarBaseMult(transportSK), ScalarBaseMult(RandomScalar())}
+	d, err := NewDealing(2, 2, pks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Shares[0].V = d.Shares[0].V.Add(ScalarFromInt(1))
+	if _, err := d.OpenShare(1, transportSK); !errors.Is(err, ErrBadDealing) {
+		t.Fatalf("altered share: got %v, want ErrBadDealing", err)
+	}
+	if VerifyDealerCommitment(d.Commitment, 3) {
+		t.Fatal("commitment verified for another threshold")
+	}
+	raw := d.Commitment.Proof.Bytes()
+	raw[len(raw)-1] ^= 1
+	bad, err := ParseDLEQProof(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Commitment.Proof = bad
+	if VerifyDealerCommitment(d.Commitment, 2) {
+		t.Fatal("commitment with a flipped proof byte verified")
+	}
+
+	commits, shares := runDKG(t)
+	cts := []*Ciphertext{EncryptExp(DKGPublicKey(commits), 1, RandomScalar())}
+	ds := PartialDecrypt(1, shares[0], cts)
+	raw = ds.Proofs[0].Bytes()
+	raw[0] ^= 1
+	if ds.Proofs[0], err = ParseDLEQProof(raw); err != nil {
+		t.Fatal(err)
+	}
+	if VerifyDecryptionShare(VerificationKey(commits, 1), cts, ds) {
+		t.Fatal("decryption share with a flipped proof byte verified")
+	}
+	if VerifyDecryptionShare(VerificationKey(commits, 2), cts, PartialDecrypt(1, shares[0], cts)) {
+		t.Fatal("decryption share verified under another trustee's key")
+	}
+}
+
+func TestDKGMalformed(t *testing.T) {
+	commits, shares := runDKG(t)
+	pk := DKGPublicKey(commits)
+	cts := []*Ciphertext{EncryptExp(pk, 2, RandomScalar())}
+	vk := VerificationKey(commits, 1)
+
+	ds := PartialDecrypt(1, shares[0], cts)
+	ds.D[0] = NewInfinity()
+	if VerifyDecryptionShare(vk, cts, ds) {
+		t.Fatal("identity decryption share verified")
+	}
+	ds = PartialDecrypt(1, shares[0], cts)
+	for _, bad := range [][]*Ciphertext{{nil}, {{C1: NewInfinity(), C2: cts[0].C2}}, {ZeroCiphertext()}} {
+		if VerifyDecryptionShare(vk, bad, ds) {
+			t.Fatal("decryption share verified for an identity ciphertext")
+		}
+		if _, err := CombineDecryptionShares(bad, []*DecryptionShare{ds}, 1); err == nil {
+			t.Fatal("combined shares of an identity ciphertext")
+		}
+	}
+	if VerifyDecryptionShare(NewInfinity(), cts, ds) || VerifyDecryptionShare(nil, cts, ds) {
+		t.Fatal("decryption share verified under an identity key")
+	}
+
+	c := &DealerCommitment{Dealer: 1, Commitments: []*Point{commits[0].Commitments[0], NewInfinity()}, Proof: commits[0].Proof}
+	if VerifyDealerCommitment(c, 2) {
+		t.Fatal("commitment with an identity coefficient verified")
+	}
+	if !DKGPublicKey([]*DealerCommitment{commits[0], nil}).IsIdentity() ||
+		!DKGPublicKey([]*DealerCommitment{commits[0], {Dealer: 2}}).IsIdentity() {
+		t.Fatal("election key derived from a missing commitment")
+	}
+	if !VerificationKey([]*DealerCommitment{nil}, 1).IsIdentity() {
+		t.Fatal("verification key derived from a missing commitment")
+	}
+
+	transportSK := RandomScalar()
+	d, err := NewDealing(1, 1, []*Point{ScalarBaseMult(transportSK)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Shares[0].R = NewInfinity()
+	if _, err := d.OpenShare(1, transportSK); !errors.Is(err, ErrBadDealing) {
+		t.Fatalf("identity R: got %v, want ErrBadDealing", err)
+	}
+	d.Shares[0].R, d.Shares[0].V = ScalarBaseMult(RandomScalar()), nil
+	if _, err := d.OpenShare(1, transportSK); !errors.Is(err, ErrBadDealing) {
+		t.Fatalf("missing V: got %v, want ErrBadDealing", err)
+	}
+	if _, err := ParseDLEQProof(make([]byte, 63)); err == nil {
+		t.Fatal("short DLEQ proof parsed")
+	}
+}
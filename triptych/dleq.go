@@ -0,0 +1,54 @@
+package triptych
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+)
+
+// DLEQProof is a Chaum–Pedersen proof that log_G1(H1) == log_G2(H2).
+type DLEQProof struct {
+	C *big.Int
+	S *big.Int
+}
+
+func dleqChallenge(context []byte, G1, H1, G2, H2, R1, R2 *Point) *big.Int {
+	var buf bytes.Buffer
+	buf.WriteString("DLEQ")
+	buf.Write(context)
+	for _, p := range []*Point{G1, H1, G2, H2, R1, R2} {
+		buf.Write(p.BytesCompressed())
+	}
+	h := sha256.Sum256(buf.Bytes())
+	return new(big.Int).Mod(new(big.Int).SetBytes(h[:]), secpN)
+}
+
+func proveDLEQ(x *big.Int, G1, H1, G2, H2 *Point, context []byte) *DLEQProof {
+	k := randScalar()
+	R1 := pointScalarMult(k, G1)
+	R2 := pointScalarMult(k, G2)
+	c := dleqChallenge(context, G1, H1, G2, H2, R1, R2)
+	return &DLEQProof{C: c, S: scalarSub(k, scalarMul(c, x))}
+}
+
+func verifyDLEQ(p *DLEQProof, G1, H1, G2, H2 *Point, context []byte) bool {
+	if p == nil || p.C == nil || p.S == nil {
+		return false
+	}
+	R1 := pointAdd(pointScalarMult(p.S, G1), pointScalarMult(p.C, H1))
+	R2 := pointAdd(pointScalarMult(p.S, G2), pointScalarMult(p.C, H2))
+	return dleqChallenge(context, G1, H1, G2, H2, R1, R2).Cmp(p.C) == 0
+}
+
+func (p *DLEQProof) Bytes() []byte {
+	out := make([]byte, 0, 64)
+	out = append(out, scalarBytes32(p.C)...)
+	return append(out, scalarBytes32(p.S)...)
+}
+
+func ParseDLEQProof(b []byte) (*DLEQProof, error) {
+	if len(b) != 64 {
+		return nil, errorsNew("dleq proof must be 64 bytes")
+	}
+	return &DLEQProof{C: scalarFromBytes32(b[:32]), S: scalarFromBytes32(b[32:])}, nil
+}
@@ -0,0 +1,212 @@
+package triptych
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Election tracks the lifecycle of one election. Phases only move forward:
+//
+//	setup → registration → frozen → voting → closed → tallied
+//
+// Keys are registered only during registration; freezing takes a snapshot
+// of the ring that every ballot must then be signed against, so all voters
+// share the same anonymity set. Zero window bounds are open-ended. With a
+// manifest, voting cannot open until the authority has signed the snapshot.
+// With Revoting a voter may cast again and only their latest ballot, by log
+// position, counts; otherwise the first ballot per key image is final. With
+// a RegistrarKey only keys with an unrevoked credential from that registrar
+// are registered and frozen into the ring. MaxChoices is the rule for
+// encrypted ballots, see ChoiceBounds.
+type Election struct {
+	ID                 string            `json:"id"`
+	Phase              ElectionPhase     `json:"phase"`
+	RegistrationOpens  time.Time         `json:"registrationOpens,omitzero"`
+	RegistrationCloses time.Time         `json:"registrationCloses,omitzero"`
+	VotingOpens        time.Time         `json:"votingOpens,omitzero"`
+	VotingCloses       time.Time         `json:"votingCloses,omitzero"`
+	Revoting           bool              `json:"revoting,omitempty"`
+	RegistrarKey       *Point            `json:"registrarKey,omitempty"`
+	MaxChoices         int               `json:"maxChoices,omitempty"`
+	Ring               *RingSnapshot     `json:"ring,omitempty"`
+	Manifest           *ElectionManifest `json:"manifest,omitempty"`
+}
+
+type ElectionPhase string
+
+const (
+	PhaseSetup        ElectionPhase = "setup"
+	PhaseRegistration ElectionPhase = "registration"
+	PhaseFrozen       ElectionPhase = "frozen"
+	PhaseVoting       ElectionPhase = "voting"
+	PhaseClosed       ElectionPhase = "closed"
+	PhaseTallied      ElectionPhase = "tallied"
+)
+
+var phaseOrder = []ElectionPhase{PhaseSetup, PhaseRegistration, PhaseFrozen, PhaseVoting, PhaseClosed, PhaseTallied}
+
+// RingSnapshot is the frozen ring. Keys are in canonical order and padded
+// with NUMS points to a power of two, so the whole snapshot is a valid
+// n=2 ring; Registered is the number of real keys.
+type RingSnapshot struct {
+	ID         string            `json:"id"`
+	Digest     Hash              `json:"digest"`
+	Keys       []*Point          `json:"keys"`
+	Registered int               `json:"registered"`
+	FrozenAt   time.Time         `json:"frozenAt"`
+	Signature  *SchnorrSignature `json:"signature,omitempty"`
+}
+
+var (
+	ErrWrongPhase    = errors.New("not allowed in this election phase")
+	ErrOutsideWindow = errors.New("outside the time window")
+	ErrNotSnapshot   = errors.New("ballot is not signed against the frozen ring")
+)
+
+func (p ElectionPhase) index() int {
+	for i, q := range phaseOrder {
+		if q == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// Next is the phase after p, or "" if p is the last one.
+func (p ElectionPhase) Next() ElectionPhase {
+	i := p.index()
+	if i < 0 || i+1 >= len(phaseOrder) {
+		return ""
+	}
+	return phaseOrder[i+1]
+}
+
+func ParseElectionPhase(s string) (ElectionPhase, error) {
+	p := ElectionPhase(s)
+	if p.index() < 0 {
+		return "", fmt.Errorf("unknown election phase %q", s)
+	}
+	return p, nil
+}
+
+// CheckWindow reports ErrOutsideWindow unless opens <= t < closes.
+func CheckWindow(opens, closes, t time.Time) error {
+	if (!opens.IsZero() && t.Before(opens)) || (!closes.IsZero() && !t.Before(closes)) {
+		return ErrOutsideWindow
+	}
+	return nil
+}
+
+// FreezeRing snapshots the registered keys. The ID is derived from the
+// digest, so the same set of keys always gets the same ID.
+func FreezeRing(keys []*Point, now time.Time) (*RingSnapshot, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no keys to freeze")
+	}
+	ring := canonicalRing(keys)
+	for i := 1; i < len(ring); i++ {
+		if PointsEqual(ring[i-1], ring[i]) {
+			return nil, errors.New("duplicate key in ring")
+		}
+	}
+	size := 2
+	for size < len(ring) {
+		size <<= 1
+	}
+	for i := 0; len(ring) < size; i++ {
+		ring = append(ring, getLabeledNUMS("RINGPAD", i))
+	}
+	d := RingDigest(ring)
+	return &RingSnapshot{
+		ID:         snapshotID(d),
+		Digest:     d,
+		Keys:       ring,
+		Registered: len(keys),
+		FrozenAt:   now.UTC(),
+	}, nil
+}
+
+func snapshotID(d [32]byte) string { return hex.EncodeToString(d[:8]) }
+
+// RealKeys returns the registered keys and checks that the rest of the ring
+// is the deterministic NUMS padding, for which nobody knows a secret key.
+func (r *RingSnapshot) RealKeys() ([]*Point, error) {
+	if r.Registered < 1 || r.Registered > len(r.Keys) {
+		return nil, errors.New("bad registered count")
+	}
+	for i, p := range r.Keys[r.Registered:] {
+		if p == nil || !PointsEqual(p, getLabeledNUMS("RINGPAD", i)) {
+			return nil, errors.New("ring padding is not the NUMS padding")
+		}
+	}
+	keys := r.Keys[:r.Registered]
+	for i, p := range keys {
+		if p == nil || (i > 0 && bytes.Compare(keys[i-1].BytesCompressed(), p.BytesCompressed()) >= 0) {
+			return nil, errors.New("ring keys are not in canonical order")
+		}
+	}
+	return keys, nil
+}
+
+// M is the ring exponent for n=2.
+func (r *RingSnapshot) M() int {
+	m := 0
+	for 1<<uint(m) < len(r.Keys) {
+		m++
+	}
+	return m
+}
+
+// Advance moves the election to the next phase. Freezing needs the ring
+// snapshot; the other transitions need nothing.
+func (e *Election) Advance(to ElectionPhase, ring *RingSnapshot) error {
+	if to == "" || e.Phase.Next() != to {
+		return fmt.Errorf("%w: cannot go from %s to %s", ErrWrongPhase, e.Phase, to)
+	}
+	if to == PhaseFrozen {
+		if ring == nil {
+			return errors.New("freezing requires a ring snapshot")
+		}
+		e.Ring = ring
+	}
+	if to == PhaseVoting && e.Manifest != nil {
+		if err := e.Ring.Verify(e.ID, e.Manifest.AuthorityKey); err != nil {
+			return err
+		}
+	}
+	e.Phase = to
+	return nil
+}
+
+// CanRegister reports whether a key may be registered at time now.
+func (e *Election) CanRegister(now time.Time) error {
+	if e.Phase != PhaseRegistration {
+		return ErrWrongPhase
+	}
+	return CheckWindow(e.RegistrationOpens, e.RegistrationCloses, now)
+}
+
+// CheckBallot accepts a ballot only while voting is open, only if it was
+// created inside the voting window and only if it was signed against the
+// frozen ring.
+func (e *Election) CheckBallot(b *Ballot, now time.Time) error {
+	if b.ElectionID != e.ID {
+		return ErrWrongElection
+	}
+	if e.Phase != PhaseVoting {
+		return ErrWrongPhase
+	}
+	if err := CheckWindow(e.VotingOpens, e.VotingCloses, now); err != nil {
+		return err
+	}
+	if err := CheckWindow(e.VotingOpens.Truncate(time.Second), e.VotingCloses, b.CreatedAt); err != nil {
+		return err
+	}
+	if e.Ring == nil || b.RingDigest != e.Ring.Digest {
+		return ErrNotSnapshot
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package triptych
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Ciphertext is an exponential ElGamal encryption (r*G, m*G + r*PK), so
+// adding ciphertexts adds plaintexts.
+type Ciphertext struct {
+	C1 *Point `json:"c1"`
+	C2 *Point `json:"c2"`
+}
+
+var ErrDLogNotFound = errors.New("discrete log not found in range")
+
+func EncryptExp(pk *Point, m int64, r *Scalar) *Ciphertext {
+	G := NewPoint(Gx, Gy)
+	return &Ciphertext{
+		C1: pointScalarMult(r.int(), G),
+		C2: pointAdd(pointScalarMult(NewScalar(big.NewInt(m)).int(), G), pointScalarMult(r.int(), pk)),
+	}
+}
+
+func ZeroCiphertext() *Ciphertext {
+	return &Ciphertext{C1: NewInfinity(), C2: NewInfinity()}
+}
+
+// finite reports whether both components are real points, as in every
+// ciphertext a voter can produce.
+func (c *Ciphertext) finite() bool {
+	return c != nil && finitePoint(c.C1) && finitePoint(c.C2)
+}
+
+func (c *Ciphertext) Add(d *Ciphertext) *Ciphertext {
+	return &Ciphertext{C1: pointAdd(c.C1, d.C1), C2: pointAdd(c.C2, d.C2)}
+}
+
+// DecryptExp returns m*G; use SolveDLog to recover small m.
+func DecryptExp(sk *Scalar, c *Ciphertext) *Point {
+	return pointAdd(c.C2, pointNeg(pointScalarMult(sk.int(), c.C1)))
+}
+
+// SolveDLog finds 0 <= m <= max with M = m*G by baby-step giant-step.
+func SolveDLog(M *Point, max int) (int, error) {
+	if max < 0 {
+		return 0, ErrDLogNotFound
+	}
+	step := 1
+	for step*step <= max {
+		step++
+	}
+	G := NewPoint(Gx, Gy)
+	baby := make(map[string]int, step)
+	acc := NewInfinity()
+	for j := 0; j < step; j++ {
+		baby[string(acc.BytesCompressed())] = j
+		acc = pointAdd(acc, G)
+	}
+	giant := pointNeg(pointScalarMult(big.NewInt(int64(step)), G))
+	cur := M
+	for i := 0; i*step <= max; i++ {
+		if j, ok := baby[string(cur.BytesCompressed())]; ok && i*step+j <= max {
+			return i*step + j, nil
+		}
+		cur = pointAdd(cur, giant)
+	}
+	return 0, ErrDLogNotFound
+}
+
+func (c *Ciphertext) Bytes() []byte {
+	return append(c.C1.BytesCompressed(), c.C2.BytesCompressed()...)
+}
+
+// ParseCiphertext rejects identity components; a fresh encryption never
+// has one.
+func ParseCiphertext(b []byte) (*Ciphertext, error) {
+	if len(b) != 66 {
+		return nil, errors.New("ciphertext must be 66 bytes")
+	}
+	c1, err := parseFinite(b[:33])
+	if err != nil {
+		return nil, err
+	}
+	c2, err := parseFinite(b[33:])
+	if err != nil {
+		return nil, err
+	}
+	return &Ciphertext{C1: c1, C2: c2}, nil
+}
@@ -0,0 +1,68 @@
+package triptych
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestElGamalRoundTrip(t *testing.T) {
+	sk := RandomScalar()
+	pk := ScalarBaseMult(sk)
+	sum := ZeroCiphertext()
+	for _, m := range []int64{1, 0, 3, 2} {
+		c, err := ParseCiphertext(EncryptExp(pk, m, RandomScalar()).Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum = sum.Add(c)
+	}
+	got, err := SolveDLog(DecryptExp(sk, sum), 10)
+	if err != nil || got != 6 {
+		t.Fatalf("decrypted sum = %d, %v; want 6", got, err)
+	}
+}
+
+func TestElGamalTamper(t *testing.T) {
+	sk := RandomScalar()
+	pk := ScalarBaseMult(sk)
+	b := EncryptExp(pk, 1, RandomScalar()).Bytes()
+	b[65] ^= 1
+	c, err := ParseCiphertext(b)
+	if err != nil {
+		return
+	}
+	if got, err := SolveDLog(DecryptExp(sk, c), 10); err == nil && got == 1 {
+		t.Fatal("ciphertext with a flipped byte still decrypts to 1")
+	}
+}
+
+func TestZeroCiphertextSum(t *testing.T) {
+	sum := ZeroCiphertext().Add(ZeroCiphertext())
+	if !sum.C1.Inf || !sum.C2.Inf {
+		t.Fatal("zero + zero is not zero")
+	}
+	if got, err := SolveDLog(DecryptExp(RandomScalar(), sum), 0); err != nil || got != 0 {
+		t.Fatalf("zero decrypts to %d, %v", got, err)
+	}
+}
+
+func TestParseCiphertextMalformed(t *testing.T) {
+	pk := ScalarBaseMult(RandomScalar())
+	good := EncryptExp(pk, 1, RandomScalar()).Bytes()
+	for name, b := range map[string][]byte{
+		"zero":       make([]byte, 66),
+		"zero C1":    append(make([]byte, 33), good[33:]...),
+		"zero C2":    append(append([]byte(nil), good[:33]...), make([]byte, 33)...),
+		"bad prefix": append([]byte{0x07}, good[1:]...),
+	} {
+		_, err := ParseCiphertext(b)
+		if err == nil {
+			t.Errorf("%s: accepted", name)
+		} else if name != "bad prefix" && !errors.Is(err, ErrIdentity) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+	if _, err := ParseCiphertext(good[:65]); err == nil {
+		t.Error("short ciphertext accepted")
+	}
+}
@@ -0,0 +1,237 @@
+package triptych
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// EncryptedBallot holds one exponential ElGamal ciphertext per candidate.
+// Each ciphertext carries a proof that it encrypts 0 or 1, and SumProof
+// shows that the homomorphic sum lies in [MinChoices, MaxChoices]:
+// [1, 1] for plurality, [0, k] for approval voting with at most k marks.
+type EncryptedBallot struct {
+	MinChoices  int
+	MaxChoices  int
+	Ciphertexts []*Ciphertext
+	Proofs      []*DisjunctiveProof
+	SumProof    *DisjunctiveProof
+}
+
+const encryptedBallotVersion = 2
+
+var (
+	ErrBadBallot  = errors.New("malformed encrypted ballot")
+	ErrChoiceRule = errors.New("ballot choice bounds differ from the election's")
+)
+
+// ChoiceBounds turns an election's MaxChoices into the bounds its encrypted
+// ballots must carry: 0 is plurality, exactly one mark; k is approval, at
+// most k marks.
+func ChoiceBounds(maxChoices int) (int, int) {
+	if maxChoices == 0 {
+		return 1, 1
+	}
+	return 0, maxChoices
+}
+
+func EncryptBallot(electionPK *Point, choice, candidates int) (*EncryptedBallot, []*Scalar, error) {
+	if candidates <= 0 || choice < 0 || choice >= candidates {
+		return nil, nil, errors.New("choice out of range")
+	}
+	return encryptBallot(electionPK, []int{choice}, candidates, 1, 1)
+}
+
+func EncryptApprovalBallot(electionPK *Point, choices []int, candidates, maxChoices int) (*EncryptedBallot, []*Scalar, error) {
+	if maxChoices <= 0 || maxChoices > candidates || len(choices) > maxChoices {
+		return nil, nil, errors.New("too many choices")
+	}
+	seen := make(map[int]bool, len(choices))
+	for _, c := range choices {
+		if c < 0 || c >= candidates || seen[c] {
+			return nil, nil, errors.New("choice out of range")
+		}
+		seen[c] = true
+	}
+	return encryptBallot(electionPK, choices, candidates, 0, maxChoices)
+}
+
+func encryptBallot(pk *Point, choices []int, candidates, minChoices, maxChoices int) (*EncryptedBallot, []*Scalar, error) {
+	marked := make([]int, candidates)
+	for _, c := range choices {
+		marked[c] = 1
+	}
+	b := &EncryptedBallot{
+		MinChoices:  minChoices,
+		MaxChoices:  maxChoices,
+		Ciphertexts: make([]*Ciphertext, candidates),
+		Proofs:      make([]*DisjunctiveProof, candidates),
+	}
+	rs := make([]*Scalar, candidates)
+	rSum := ScalarFromInt(0)
+	for i := 0; i < candidates; i++ {
+		rs[i] = RandomScalar()
+		rSum = rSum.Add(rs[i])
+		b.Ciphertexts[i] = EncryptExp(pk, int64(marked[i]), rs[i])
+	}
+	header := b.proofContext()
+	for i := 0; i < candidates; i++ {
+		p, err := ProveEncryptsOneOf(pk, b.Ciphertexts[i], []int{0, 1}, marked[i], rs[i], indexedContext(header, i))
+		if err != nil {
+			return nil, nil, err
+		}
+		b.Proofs[i] = p
+	}
+	p, err := ProveEncryptsOneOf(pk, b.markSum(), valueRange(minChoices, maxChoices), len(choices)-minChoices, rSum, indexedContext(header, -1))
+	if err != nil {
+		return nil, nil, err
+	}
+	b.SumProof = p
+	return b, rs, nil
+}
+
+func (b *EncryptedBallot) markSum() *Ciphertext {
+	sum := ZeroCiphertext()
+	for _, c := range b.Ciphertexts {
+		sum = sum.Add(c)
+	}
+	return sum
+}
+
+func (b *EncryptedBallot) proofContext() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("BALLOT")
+	_ = binary.Write(&buf, binary.BigEndian, uint16(b.MinChoices))
+	_ = binary.Write(&buf, binary.BigEndian, uint16(b.MaxChoices))
+	for _, c := range b.Ciphertexts {
+		buf.Write(c.Bytes())
+	}
+	return buf.Bytes()
+}
+
+func indexedContext(header []byte, i int) []byte {
+	out := append([]byte(nil), header...)
+	return binary.BigEndian.AppendUint32(out, uint32(int32(i)))
+}
+
+// VerifyEncryptedBallot checks every per-candidate proof and the sum proof.
+// The bounds come from the election, not the ballot: a ballot that embeds
+// other bounds is rejected even if its proofs hold.
+func VerifyEncryptedBallot(electionPK *Point, b *EncryptedBallot, minChoices, maxChoices int) error {
+	if b == nil || len(b.Ciphertexts) == 0 || len(b.Proofs) != len(b.Ciphertexts) || !finitePoint(electionPK) {
+		return ErrBadBallot
+	}
+	// Checked before markSum adds them up.
+	for _, c := range b.Ciphertexts {
+		if !c.finite() {
+			return ErrBadBallot
+		}
+	}
+	if b.MinChoices != minChoices || b.MaxChoices != maxChoices {
+		return ErrChoiceRule
+	}
+	if b.MinChoices < 0 || b.MaxChoices < b.MinChoices || b.MaxChoices > len(b.Ciphertexts) {
+		return ErrBadBallot
+	}
+	header := b.proofContext()
+	for i, ct := range b.Ciphertexts {
+		if !VerifyEncryptsOneOf(electionPK, ct, []int{0, 1}, b.Proofs[i], indexedContext(header, i)) {
+			return errors.New("ciphertext does not encrypt 0 or 1")
+		}
+	}
+	if !VerifyEncryptsOneOf(electionPK, b.markSum(), valueRange(b.MinChoices, b.MaxChoices), b.SumProof, indexedContext(header, -1)) {
+		return errors.New("number of marks is outside the allowed range")
+	}
+	return nil
+}
+
+func (b *EncryptedBallot) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(encryptedBallotVersion)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(b.Ciphertexts)))
+	_ = binary.Write(&buf, binary.BigEndian, uint16(b.MinChoices))
+	_ = binary.Write(&buf, binary.BigEndian, uint16(b.MaxChoices))
+	for _, c := range b.Ciphertexts {
+		buf.Write(c.Bytes())
+	}
+	for _, p := range b.Proofs {
+		buf.Write(p.Bytes())
+	}
+	buf.Write(b.SumProof.Bytes())
+	return buf.Bytes()
+}
+
+func ParseEncryptedBallot(raw []byte) (*EncryptedBallot, error) {
+	if len(raw) < 7 || raw[0] != encryptedBallotVersion {
+		return nil, ErrBadBallot
+	}
+	count := int(binary.BigEndian.Uint16(raw[1:3]))
+	minC := int(binary.BigEndian.Uint16(raw[3:5]))
+	maxC := int(binary.BigEndian.Uint16(raw[5:7]))
+	if count == 0 || maxC < minC || maxC > count {
+		return nil, ErrBadBallot
+	}
+	sumBranches := maxC - minC + 1
+	if len(raw) != 7+count*66+count*128+sumBranches*64 {
+		return nil, ErrBadBallot
+	}
+	b := &EncryptedBallot{
+		MinChoices:  minC,
+		MaxChoices:  maxC,
+		Ciphertexts: make([]*Ciphertext, count),
+		Proofs:      make([]*DisjunctiveProof, count),
+	}
+	off := 7
+	for i := 0; i < count; i++ {
+		c, err := ParseCiphertext(raw[off : off+66])
+		if err != nil {
+			return nil, err
+		}
+		b.Ciphertexts[i] = c
+		off += 66
+	}
+	for i := 0; i < count; i++ {
+		b.Proofs[i] = parseDisjunctiveProof(raw[off:off+128], 2)
+		off += 128
+	}
+	b.SumProof = parseDisjunctiveProof(raw[off:], sumBranches)
+	return b, nil
+}
+
+// SumBallots adds the ballots candidate by candidate. All ballots must have
+// the same number of ciphertexts, none of them with an identity component.
+func SumBallots(ballots []*EncryptedBallot, candidates int) ([]*Ciphertext, error) {
+	sums := make([]*Ciphertext, candidates)
+	for i := range sums {
+		sums[i] = ZeroCiphertext()
+	}
+	for _, b := range ballots {
+		if b == nil || len(b.Ciphertexts) != candidates {
+			return nil, ErrBadBallot
+		}
+		for i, c := range b.Ciphertexts {
+			if !c.finite() {
+				return nil, ErrBadBallot
+			}
+			sums[i] = sums[i].Add(c)
+		}
+	}
+	return sums, nil
+}
+
+// TallyEncrypted decrypts only the per-candidate totals.
+func TallyEncrypted(ballots []*EncryptedBallot, electionSK *Scalar, candidates int) ([]int, error) {
+	sums, err := SumBallots(ballots, candidates)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]int, candidates)
+	for i, c := range sums {
+		v, err := SolveDLog(DecryptExp(electionSK, c), len(ballots))
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,79 @@
+package triptych
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEncryptedBallotRoundTrip(t *testing.T) {
+	sk := RandomScalar()
+	pk := ScalarBaseMult(sk)
+	var ballots []*EncryptedBallot
+	for _, choices := range [][]int{{0, 2}, {2}, {}} {
+		b, _, err := EncryptApprovalBallot(pk, choices, 3, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseEncryptedBallot(b.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		lo, hi := ChoiceBounds(2)
+		if err := VerifyEncryptedBallot(pk, got, lo, hi); err != nil {
+			t.Fatal(err)
+		}
+		ballots = append(ballots, got)
+	}
+	counts, err := TallyEncrypted(ballots, sk, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[0] != 1 || counts[1] != 0 || counts[2] != 2 {
+		t.Fatalf("counts = %v", counts)
+	}
+}
+
+func TestEncryptedBallotTamper(t *testing.T) {
+	pk := ScalarBaseMult(RandomScalar())
+	b, _, err := EncryptBallot(pk, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := b.Bytes()
+	raw[len(raw)-1] ^= 1
+	got, err := ParseEncryptedBallot(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyEncryptedBallot(pk, got, 1, 1) == nil {
+		t.Fatal("ballot with a flipped byte verified")
+	}
+	if err := VerifyEncryptedBallot(pk, b, 0, 1); !errors.Is(err, ErrChoiceRule) {
+		t.Fatalf("other bounds: got %v", err)
+	}
+}
+
+func TestEncryptedBallotIdentity(t *testing.T) {
+	pk := ScalarBaseMult(RandomScalar())
+	b, _, err := EncryptBallot(pk, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := b.Bytes()
+	copy(raw[7:], make([]byte, 66))
+	if _, err := ParseEncryptedBallot(raw); !errors.Is(err, ErrIdentity) {
+		t.Fatalf("identity ciphertext parsed: %v", err)
+	}
+
+	bad := *b
+	bad.Ciphertexts = []*Ciphertext{ZeroCiphertext(), b.Ciphertexts[1]}
+	if err := VerifyEncryptedBallot(pk, &bad, 1, 1); !errors.Is(err, ErrBadBallot) {
+		t.Fatalf("verify: got %v", err)
+	}
+	if _, err := SumBallots([]*EncryptedBallot{b, &bad}, 2); !errors.Is(err, ErrBadBallot) {
+		t.Fatalf("sum: got %v", err)
+	}
+	if err := VerifyEncryptedBallot(NewInfinity(), b, 1, 1); !errors.Is(err, ErrBadBallot) {
+		t.Fatalf("identity election key: got %v", err)
+	}
+}
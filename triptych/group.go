@@ -0,0 +1,134 @@
+package triptych
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+)
+
+// Scalar is an element of Z_n, n being the order of secp256k1.
+type Scalar struct {
+	k *big.Int
+}
+
+var errScalarRange = errors.New("scalar is not reduced modulo the group order")
+
+func NewScalar(k *big.Int) *Scalar {
+	return &Scalar{k: new(big.Int).Mod(k, secpN)}
+}
+
+func ScalarFromInt(v int64) *Scalar { return NewScalar(big.NewInt(v)) }
+
+func RandomScalar() *Scalar { return &Scalar{k: randScalar()} }
+
+// ScalarFromBytes parses a 32-byte big-endian scalar and rejects values >= n.
+func ScalarFromBytes(b []byte) (*Scalar, error) {
+	if len(b) != 32 {
+		return nil, errors.New("scalar must be 32 bytes")
+	}
+	k := new(big.Int).SetBytes(b)
+	if k.Cmp(secpN) >= 0 {
+		return nil, errScalarRange
+	}
+	return &Scalar{k: k}, nil
+}
+
+// HashToScalar reduces SHA-256 of the concatenated inputs modulo n.
+func HashToScalar(data ...[]byte) *Scalar {
+	var seed []byte
+	for _, d := range data {
+		seed = append(seed, d...)
+	}
+	return &Scalar{k: hashToScalar(seed)}
+}
+
+func (s *Scalar) int() *big.Int {
+	if s == nil || s.k == nil {
+		return big.NewInt(0)
+	}
+	return s.k
+}
+
+func (s *Scalar) BigInt() *big.Int { return new(big.Int).Set(s.int()) }
+func (s *Scalar) Bytes() []byte    { return scalarBytes32(s.int()) }
+func (s *Scalar) IsZero() bool     { return s.int().Sign() == 0 }
+
+func (s *Scalar) Add(t *Scalar) *Scalar { return &Scalar{k: scalarAdd(s.int(), t.int())} }
+func (s *Scalar) Sub(t *Scalar) *Scalar { return &Scalar{k: scalarSub(s.int(), t.int())} }
+func (s *Scalar) Mul(t *Scalar) *Scalar { return &Scalar{k: scalarMul(s.int(), t.int())} }
+func (s *Scalar) Neg() *Scalar          { return &Scalar{k: scalarSub(big.NewInt(0), s.int())} }
+
+func (s *Scalar) Inverse() *Scalar {
+	if s.IsZero() {
+		return &Scalar{k: big.NewInt(0)}
+	}
+	return &Scalar{k: modInv(s.int(), secpN)}
+}
+
+func (s *Scalar) Equal(t *Scalar) bool { return s.int().Cmp(t.int()) == 0 }
+
+func (s *Scalar) MarshalBinary() ([]byte, error) { return s.Bytes(), nil }
+
+func (s *Scalar) UnmarshalBinary(b []byte) error {
+	v, err := ScalarFromBytes(b)
+	if err != nil {
+		return err
+	}
+	s.k = v.k
+	return nil
+}
+
+func (s *Scalar) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(s.Bytes())), nil
+}
+
+func (s *Scalar) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	return s.UnmarshalBinary(b)
+}
+
+func Generator() *Point { return NewPoint(Gx, Gy) }
+
+func ScalarBaseMult(s *Scalar) *Point { return baseScalarMult(s.int()) }
+
+func (P *Point) Add(Q *Point) *Point { return pointAdd(P, Q) }
+func (P *Point) Sub(Q *Point) *Point { return pointAdd(P, pointNeg(Q)) }
+func (P *Point) Neg() *Point         { return pointNeg(P) }
+func (P *Point) Mul(s *Scalar) *Point {
+	return pointScalarMult(s.int(), P)
+}
+
+func (P *Point) Equal(Q *Point) bool {
+	if P == nil || Q == nil {
+		return P.IsIdentity() && Q.IsIdentity()
+	}
+	return PointsEqual(P, Q)
+}
+
+func (P *Point) IsIdentity() bool { return P == nil || P.Inf }
+
+func (P *Point) MarshalBinary() ([]byte, error) { return P.BytesCompressed(), nil }
+
+func (P *Point) UnmarshalBinary(b []byte) error {
+	Q, err := ParseCompressed(b)
+	if err != nil {
+		return err
+	}
+	*P = *Q
+	return nil
+}
+
+func (P *Point) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(P.BytesCompressed())), nil
+}
+
+func (P *Point) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	return P.UnmarshalBinary(b)
+}
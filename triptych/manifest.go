@@ -0,0 +1,155 @@
+package triptych
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ElectionManifest is the election authority's signed description of an
+// election. Its AuthorityKey is the key voters pin; ring snapshots must be
+// signed with it. RegistrarKey, if set, signs voter credentials and the
+// revocation list.
+type ElectionManifest struct {
+	ElectionID         string            `json:"electionId"`
+	AuthorityKey       *Point            `json:"authorityKey"`
+	ElectionPK         *Point            `json:"electionPublicKey,omitempty"`
+	RegistrationOpens  time.Time         `json:"registrationOpens,omitzero"`
+	RegistrationCloses time.Time         `json:"registrationCloses,omitzero"`
+	VotingOpens        time.Time         `json:"votingOpens,omitzero"`
+	VotingCloses       time.Time         `json:"votingCloses,omitzero"`
+	Revoting           bool              `json:"revoting,omitempty"`
+	RegistrarKey       *Point            `json:"registrarKey,omitempty"`
+	MaxChoices         int               `json:"maxChoices,omitempty"`
+	Version            int               `json:"version,omitempty"`
+	CreatedAt          time.Time         `json:"createdAt"`
+	Signature          *SchnorrSignature `json:"signature"`
+}
+
+// manifestVersion is the signed layout Sign writes. Version 0 is the
+// layout from before MaxChoices, which such manifests are still checked
+// in; it cannot carry MaxChoices.
+const manifestVersion = 2
+
+var (
+	ErrBadManifest      = errors.New("manifest signature is invalid")
+	ErrUnsignedSnapshot = errors.New("ring snapshot is not signed by the authority")
+)
+
+func writeTime(buf *bytes.Buffer, t time.Time) {
+	var v int64
+	if !t.IsZero() {
+		v = t.UnixMilli()
+	}
+	_ = binary.Write(buf, binary.BigEndian, v)
+}
+
+func (m *ElectionManifest) signedBytes() ([]byte, error) {
+	if m.MaxChoices < 0 || m.MaxChoices > 0xffff {
+		return nil, errors.New("manifest maxChoices is out of range")
+	}
+	var buf bytes.Buffer
+	buf.WriteString("MANIFEST")
+	switch m.Version {
+	case 0:
+		if m.MaxChoices != 0 {
+			return nil, errors.New("unversioned manifest cannot set maxChoices")
+		}
+	case manifestVersion:
+		// Version 0 goes on with the length of a non-empty election ID, so
+		// it never has two zero bytes here.
+		buf.Write([]byte{0, 0, manifestVersion})
+	default:
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	writeString16(&buf, m.ElectionID)
+	buf.Write(m.AuthorityKey.BytesCompressed())
+	if m.ElectionPK != nil {
+		buf.WriteByte(1)
+		buf.Write(m.ElectionPK.BytesCompressed())
+	} else {
+		buf.WriteByte(0)
+	}
+	for _, t := range []time.Time{m.RegistrationOpens, m.RegistrationCloses, m.VotingOpens, m.VotingCloses, m.CreatedAt} {
+		writeTime(&buf, t)
+	}
+	if m.Revoting {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	if m.RegistrarKey != nil {
+		buf.WriteByte(1)
+		buf.Write(m.RegistrarKey.BytesCompressed())
+	} else {
+		buf.WriteByte(0)
+	}
+	if m.Version == manifestVersion {
+		_ = binary.Write(&buf, binary.BigEndian, uint16(m.MaxChoices))
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign sets AuthorityKey from sk and signs the manifest in the current
+// version.
+func (m *ElectionManifest) Sign(sk *Scalar) error {
+	if m.ElectionID == "" {
+		return errors.New("manifest needs an election ID")
+	}
+	m.AuthorityKey = ScalarBaseMult(sk)
+	m.Version = manifestVersion
+	b, err := m.signedBytes()
+	if err != nil {
+		return err
+	}
+	m.Signature = SchnorrSign(sk, b)
+	return nil
+}
+
+// Verify checks the manifest against its own AuthorityKey; callers compare
+// that key with the one they trust.
+func (m *ElectionManifest) Verify() error {
+	if m.ElectionID == "" || m.AuthorityKey == nil {
+		return ErrBadManifest
+	}
+	b, err := m.signedBytes()
+	if err != nil || !VerifySchnorr(m.AuthorityKey, b, m.Signature) {
+		return ErrBadManifest
+	}
+	return nil
+}
+
+func (r *RingSnapshot) signedBytes(electionID string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RINGSNAPSHOT")
+	writeString16(&buf, electionID)
+	buf.Write(r.Digest[:])
+	_ = binary.Write(&buf, binary.BigEndian, uint32(r.Registered))
+	writeTime(&buf, r.FrozenAt)
+	return buf.Bytes()
+}
+
+func (r *RingSnapshot) Sign(electionID string, sk *Scalar) {
+	r.Signature = SchnorrSign(sk, r.signedBytes(electionID))
+}
+
+// Verify recomputes the digest and ID from the keys and checks the
+// authority's signature over them.
+func (r *RingSnapshot) Verify(electionID string, authorityKey *Point) error {
+	d := RingDigest(r.Keys)
+	if Hash(d) != r.Digest || r.ID != snapshotID(d) {
+		return errors.New("ring snapshot does not match its keys")
+	}
+	if _, err := r.RealKeys(); err != nil {
+		return err
+	}
+	if r.Signature == nil {
+		return ErrUnsignedSnapshot
+	}
+	if !VerifySchnorr(authorityKey, r.signedBytes(electionID), r.Signature) {
+		return errors.New("ring snapshot signature is invalid")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package triptych
+
+import (
+	"testing"
+	"time"
+)
+
+func testManifest() ElectionManifest {
+	return ElectionManifest{ElectionID: "e1", MaxChoices: 3, CreatedAt: time.UnixMilli(1700000000000).UTC()}
+}
+
+func TestManifestSignVerify(t *testing.T) {
+	m := testManifest()
+	if err := m.Sign(RandomScalar()); err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != manifestVersion {
+		t.Fatalf("version = %d", m.Version)
+	}
+	if err := m.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	for name, mutate := range map[string]func(m *ElectionManifest){
+		"maxChoices": func(m *ElectionManifest) { m.MaxChoices = 2 },
+		"version 0":  func(m *ElectionManifest) { m.Version = 0 },
+		"version 9":  func(m *ElectionManifest) { m.Version = 9 },
+		"election":   func(m *ElectionManifest) { m.ElectionID = "e2" },
+	} {
+		c := m
+		mutate(&c)
+		if c.Verify() == nil {
+			t.Errorf("%s: tampered manifest verified", name)
+		}
+	}
+}
+
+func TestManifestMaxChoicesRange(t *testing.T) {
+	for _, v := range []int{-1, 0x10000, 0x10000 + 3} {
+		m := testManifest()
+		m.MaxChoices = v
+		if m.Sign(RandomScalar()) == nil {
+			t.Errorf("maxChoices %d signed", v)
+		}
+	}
+}
+
+// A manifest signed before versions existed still verifies as version 0.
+func TestManifestUnversioned(t *testing.T) {
+	sk := RandomScalar()
+	m := testManifest()
+	m.MaxChoices = 0
+	m.AuthorityKey = ScalarBaseMult(sk)
+	b, err := m.signedBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Signature = SchnorrSign(sk, b)
+	if err := m.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	m.MaxChoices = 1
+	if m.Verify() == nil {
+		t.Fatal("unversioned manifest with maxChoices verified")
+	}
+}
@@ -0,0 +1,195 @@
+package triptych
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// Merkle tree over log entries as in Certificate Transparency (RFC 6962):
+// leaves are hashed as H(0x00 || data), interior nodes as H(0x01 || l || r),
+// and a tree of n leaves splits at the largest power of two below n.
+
+type Hash [32]byte
+
+var (
+	ErrBadInclusion   = errors.New("inclusion proof does not match the tree head")
+	ErrBadConsistency = errors.New("tree heads are not consistent")
+)
+
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h[:])), nil
+}
+
+func (h *Hash) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	if len(b) != len(h) {
+		return errorsNew("hash must be 32 bytes")
+	}
+	copy(h[:], b)
+	return nil
+}
+
+func MerkleLeafHash(data []byte) Hash {
+	return sha256.Sum256(append([]byte{0x00}, data...))
+}
+
+func merkleNode(l, r Hash) Hash {
+	buf := make([]byte, 0, 65)
+	buf = append(buf, 0x01)
+	buf = append(buf, l[:]...)
+	return sha256.Sum256(append(buf, r[:]...))
+}
+
+// splitPoint is the largest power of two strictly below n (n > 1).
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// MerkleRoot is MTH over leaf hashes; the empty tree hashes to SHA-256("").
+func MerkleRoot(leaves []Hash) Hash {
+	switch len(leaves) {
+	case 0:
+		return sha256.Sum256(nil)
+	case 1:
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return merkleNode(MerkleRoot(leaves[:k]), MerkleRoot(leaves[k:]))
+}
+
+// InclusionProof is the audit path for leaves[index] in the tree made of
+// all of leaves.
+func InclusionProof(leaves []Hash, index int) ([]Hash, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, errorsNew("leaf index out of range")
+	}
+	return inclusionPath(index, leaves), nil
+}
+
+func inclusionPath(m int, leaves []Hash) []Hash {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if m < k {
+		return append(inclusionPath(m, leaves[:k]), MerkleRoot(leaves[k:]))
+	}
+	return append(inclusionPath(m-k, leaves[k:]), MerkleRoot(leaves[:k]))
+}
+
+// ConsistencyProof shows that the tree of the first m leaves is a prefix of
+// the tree made of all of leaves.
+func ConsistencyProof(leaves []Hash, m int) ([]Hash, error) {
+	if m < 0 || m > len(leaves) {
+		return nil, errorsNew("tree size out of range")
+	}
+	if m == 0 || m == len(leaves) {
+		return nil, nil
+	}
+	return subproof(m, leaves, true), nil
+}
+
+func subproof(m int, leaves []Hash, complete bool) []Hash {
+	n := len(leaves)
+	if m == n {
+		if complete {
+			return nil
+		}
+		return []Hash{MerkleRoot(leaves)}
+	}
+	k := splitPoint(n)
+	if m <= k {
+		return append(subproof(m, leaves[:k], complete), MerkleRoot(leaves[k:]))
+	}
+	return append(subproof(m-k, leaves[k:], false), MerkleRoot(leaves[:k]))
+}
+
+// VerifyInclusion checks an audit path against a tree head (RFC 9162,
+// section 2.1.3.2).
+func VerifyInclusion(leaf Hash, index, size uint64, proof []Hash, root Hash) error {
+	if index >= size {
+		return ErrBadInclusion
+	}
+	fn, sn, r := index, size-1, leaf
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrBadInclusion
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNode(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNode(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || r != root {
+		return ErrBadInclusion
+	}
+	return nil
+}
+
+// VerifyConsistency checks that the tree of size first with root firstRoot
+// is a prefix of the tree of size second with root secondRoot (RFC 9162,
+// section 2.1.4.2).
+func VerifyConsistency(first, second uint64, firstRoot, secondRoot Hash, proof []Hash) error {
+	switch {
+	case first > second:
+		return ErrBadConsistency
+	case first == second:
+		if len(proof) != 0 || firstRoot != secondRoot {
+			return ErrBadConsistency
+		}
+		return nil
+	case first == 0:
+		if len(proof) != 0 {
+			return ErrBadConsistency
+		}
+		return nil
+	}
+	if first&(first-1) == 0 {
+		proof = append([]Hash{firstRoot}, proof...)
+	}
+	if len(proof) == 0 {
+		return ErrBadConsistency
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrBadConsistency
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = merkleNode(c, fr)
+			sr = merkleNode(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = merkleNode(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || fr != firstRoot || sr != secondRoot {
+		return ErrBadConsistency
+	}
+	return nil
+}
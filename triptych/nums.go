@@ -2,11 +2,24 @@ package triptych
 
 import "math/big"
 
-func getNUMS(idx int) *Point {
-	seed := make([]byte, 0, 8)
-	seed = append(seed, []byte("NUMS")...)
+func getNUMS(idx int) *Point { return getLabeledNUMS("NUMS", idx) }
+
+func getLabeledNUMS(label string, idx int) *Point {
+	seed := make([]byte, 0, len(label)+4)
+	seed = append(seed, []byte(label)...)
 	seed = append(seed, byte((idx>>24)&0xff), byte((idx>>16)&0xff), byte((idx>>8)&0xff), byte(idx&0xff))
-	x := hashToField(seed)
+	return liftX(hashToField(seed))
+}
+
+func hashToPoint(domain string, data ...[]byte) *Point {
+	seed := []byte(domain)
+	for _, d := range data {
+		seed = append(seed, d...)
+	}
+	return liftX(hashToField(seed))
+}
+
+func liftX(x *big.Int) *Point {
 	one := big.NewInt(1)
 	for {
 		rhs := modAdd(modMul(x, modMul(x, x, secpP), secpP), secpB, secpP)
@@ -21,15 +34,4 @@ func getNUMS(idx int) *Point {
 	}
 }
 
-func getMatrixNUMS(rows, cols int) [][]*Point {
-	pts := make([][]*Point, rows)
-	for i := 0; i < rows; i++ {
-		pts[i] = make([]*Point, cols)
-		for j := 0; j < cols; j++ {
-			pts[i][j] = getNUMS(i*cols + j)
-		}
-	}
-	return pts
-}
-
 var JPoint = getNUMS(254)
@@ -0,0 +1,196 @@
+package triptych
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+)
+
+// OneOfManyProof is a Groth–Kohlweiss proof that one commitment in a list
+// is r*G for a known r, i.e. a Pedersen commitment to zero. Lists are
+// padded to a power of two by repeating the last commitment.
+type OneOfManyProof struct {
+	CommA *Point
+	CommB *Point
+	CommC *Point
+	CommD *Point
+	X     []*Point
+	F     [][]*big.Int
+	ZA    *big.Int
+	ZC    *big.Int
+	Z     *big.Int
+}
+
+const oneOfManyBase = 2
+
+func oneOfManyShape(size int) (padded []int, m int) {
+	m = 1
+	for (1 << uint(m)) < size {
+		m++
+	}
+	padded = make([]int, 1<<uint(m))
+	for i := range padded {
+		if i < size {
+			padded[i] = i
+		} else {
+			padded[i] = size - 1
+		}
+	}
+	return padded, m
+}
+
+func padCommitments(commitments []*Point) ([]*Point, int) {
+	idx, m := oneOfManyShape(len(commitments))
+	out := make([]*Point, len(idx))
+	for i, k := range idx {
+		out[i] = commitments[k]
+	}
+	return out, m
+}
+
+func ProveOneOfMany(commitments []*Point, index int, opening *Scalar) (*OneOfManyProof, error) {
+	if len(commitments) == 0 {
+		return nil, errors.New("commitment list is empty")
+	}
+	if index < 0 || index >= len(commitments) {
+		return nil, errors.New("index out of range")
+	}
+	G := NewPoint(Gx, Gy)
+	if !PointsEqual(commitments[index], pointScalarMult(opening.int(), G)) {
+		return nil, errors.New("commitment at index does not open to zero")
+	}
+
+	list, m := padCommitments(commitments)
+	n := oneOfManyBase
+
+	commA, randA, matrixA := triptychGetA(n, m)
+	commB, randB, matrixS := triptychGetB(n, m, index)
+	commC, randC, _ := triptychGetC(matrixA, matrixS)
+	commD, randD, _ := triptychGetD(matrixA)
+
+	polys := triptychPolys(matrixS, matrixA, len(list), n, m)
+	rhos := make([]*big.Int, m)
+	for j := 0; j < m; j++ {
+		rhos[j] = randScalar()
+	}
+	X := triptychGetX(polys, list, rhos, G)
+
+	x := transcriptHash(commA, commB, commC, commD, X, nil, list, []byte("ONEOFMANY"))
+	return &OneOfManyProof{
+		CommA: commA, CommB: commB, CommC: commC, CommD: commD,
+		X: X, F: triptychGetF(matrixS, matrixA, x),
+		ZA: scalarAdd(randA, scalarMul(x, randB)),
+		ZC: scalarAdd(scalarMul(randC, x), randD),
+		Z:  triptychGetZ(opening.int(), rhos, x),
+	}, nil
+}
+
+func VerifyOneOfMany(commitments []*Point, proof *OneOfManyProof) bool {
+	if proof == nil || len(commitments) == 0 {
+		return false
+	}
+	// The listed commitments may be the identity; the proof's points may not.
+	for _, C := range commitments {
+		if C == nil {
+			return false
+		}
+	}
+	list, m := padCommitments(commitments)
+	n := oneOfManyBase
+	if len(proof.X) != m || !allFinite([]*Point{proof.CommA, proof.CommB, proof.CommC, proof.CommD}, proof.X) ||
+		!fullMatrix(proof.F, m, n-1) || proof.ZA == nil || proof.ZC == nil || proof.Z == nil {
+		return false
+	}
+
+	x := transcriptHash(proof.CommA, proof.CommB, proof.CommC, proof.CommD, proof.X, nil, list, []byte("ONEOFMANY"))
+	f := deepCopyMatrix(proof.F)
+	if !triptychCheckMatrices(f, proof.CommA, proof.CommB, proof.CommC, proof.CommD, proof.ZA, proof.ZC, x, n, m) {
+		return false
+	}
+
+	sum := NewInfinity()
+	for k, prodf := range triptychRingProducts(f, len(list), n, m) {
+		sum = pointAdd(sum, pointScalarMult(prodf, list[k]))
+	}
+	return PointsEqual(sum, pointAdd(powerSum(proof.X, x), pointScalarMult(proof.Z, NewPoint(Gx, Gy))))
+}
+
+func membershipList(commitment *Point, set []*Scalar) []*Point {
+	H := ValueGenerator()
+	out := make([]*Point, len(set))
+	for i, v := range set {
+		out[i] = pointAdd(commitment, pointNeg(pointScalarMult(v.int(), H)))
+	}
+	return out
+}
+
+// ProveSetMembership shows that commitment = PedersenCommit(set[index], blind)
+// without revealing index.
+func ProveSetMembership(commitment *Point, set []*Scalar, index int, blind *Scalar) (*OneOfManyProof, error) {
+	return ProveOneOfMany(membershipList(commitment, set), index, blind)
+}
+
+func VerifySetMembership(commitment *Point, set []*Scalar, proof *OneOfManyProof) bool {
+	return VerifyOneOfMany(membershipList(commitment, set), proof)
+}
+
+func (p *OneOfManyProof) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, P := range []*Point{p.CommA, p.CommB, p.CommC, p.CommD} {
+		buf.Write(P.BytesCompressed())
+	}
+	for _, P := range p.X {
+		buf.Write(P.BytesCompressed())
+	}
+	for j := range p.F {
+		for _, v := range p.F[j] {
+			buf.Write(scalarBytes32(v))
+		}
+	}
+	for _, v := range []*big.Int{p.ZA, p.ZC, p.Z} {
+		buf.Write(scalarBytes32(v))
+	}
+	return buf.Bytes()
+}
+
+// ParseOneOfManyProof decodes a proof made over a list of listSize commitments.
+func ParseOneOfManyProof(b []byte, listSize int) (*OneOfManyProof, error) {
+	if listSize <= 0 {
+		return nil, errors.New("list size must be positive")
+	}
+	_, m := oneOfManyShape(listSize)
+	n := oneOfManyBase
+	if len(b) != 4*33+m*33+m*(n-1)*32+3*32 {
+		return nil, errors.New("invalid one-of-many proof length")
+	}
+	off := 0
+	readPoint := func() (*Point, error) {
+		P, err := parseFinite(b[off : off+33])
+		off += 33
+		return P, err
+	}
+	readScalar := func() *big.Int {
+		k := scalarFromBytes32(b[off : off+32])
+		off += 32
+		return k
+	}
+
+	pts := make([]*Point, 4+m)
+	for i := range pts {
+		P, err := readPoint()
+		if err != nil {
+			return nil, err
+		}
+		pts[i] = P
+	}
+	p := &OneOfManyProof{CommA: pts[0], CommB: pts[1], CommC: pts[2], CommD: pts[3], X: pts[4:]}
+	p.F = make([][]*big.Int, m)
+	for j := 0; j < m; j++ {
+		p.F[j] = make([]*big.Int, n-1)
+		for i := range p.F[j] {
+			p.F[j][i] = readScalar()
+		}
+	}
+	p.ZA, p.ZC, p.Z = readScalar(), readScalar(), readScalar()
+	return p, nil
+}
@@ -0,0 +1,137 @@
+package triptych
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// oneOfManyList returns size random points with r*G at index.
+func oneOfManyList(size, index int) ([]*Point, *Scalar) {
+	G := NewPoint(Gx, Gy)
+	list := make([]*Point, size)
+	for i := range list {
+		list[i] = pointScalarMult(randScalar(), G)
+	}
+	r := RandomScalar()
+	list[index] = pointScalarMult(r.int(), G)
+	return list, r
+}
+
+func TestOneOfManyRoundTrip(t *testing.T) {
+	for _, size := range []int{1, 3, 4, 5} {
+		list, r := oneOfManyList(size, size-1)
+		proof, err := ProveOneOfMany(list, size-1, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseOneOfManyProof(proof.Bytes(), size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyOneOfMany(list, got) {
+			t.Fatalf("size %d: valid proof rejected", size)
+		}
+	}
+}
+
+func TestSetMembership(t *testing.T) {
+	set := []*Scalar{NewScalar(big.NewInt(1)), NewScalar(big.NewInt(2)), NewScalar(big.NewInt(3))}
+	blind := RandomScalar()
+	C := PedersenCommit(set[1], blind)
+	proof, err := ProveSetMembership(C, set, 1, blind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySetMembership(C, set, proof) {
+		t.Fatal("valid membership proof rejected")
+	}
+	if VerifySetMembership(C, set[:1], proof) {
+		t.Fatal("membership proof verified for another set")
+	}
+	if _, err := ProveSetMembership(PedersenCommit(NewScalar(big.NewInt(7)), blind), set, 1, blind); err == nil {
+		t.Fatal("proved membership of a value outside the set")
+	}
+}
+
+func TestOneOfManyTamper(t *testing.T) {
+	list, r := oneOfManyList(4, 2)
+	proof, err := ProveOneOfMany(list, 2, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := proof.Bytes()
+	raw[len(raw)-1] ^= 1
+	bad, err := ParseOneOfManyProof(raw, len(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyOneOfMany(list, bad) {
+		t.Fatal("proof with a flipped byte verified")
+	}
+	list[0] = pointAdd(list[0], NewPoint(Gx, Gy))
+	if VerifyOneOfMany(list, proof) {
+		t.Fatal("proof verified against another list")
+	}
+}
+
+func TestOneOfManyMalformed(t *testing.T) {
+	list, r := oneOfManyList(3, 0)
+	proof, err := ProveOneOfMany(list, 0, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := proof.Bytes()
+
+	zeroA := append([]byte(nil), raw...)
+	copy(zeroA[:33], make([]byte, 33))
+	if _, err := ParseOneOfManyProof(zeroA, len(list)); !errors.Is(err, ErrIdentity) {
+		t.Fatalf("identity CommA: got %v, want ErrIdentity", err)
+	}
+	if _, err := ParseOneOfManyProof(make([]byte, len(raw)), len(list)); err == nil {
+		t.Fatal("all-zero proof parsed")
+	}
+	if _, err := ParseOneOfManyProof(raw[:len(raw)-1], len(list)); err == nil {
+		t.Fatal("short proof parsed")
+	}
+	if _, err := ParseOneOfManyProof(raw, 0); err == nil {
+		t.Fatal("parsed a proof for an empty list")
+	}
+
+	mutations := map[string]func(p *OneOfManyProof){
+		"identity CommB": func(p *OneOfManyProof) { p.CommB = NewInfinity() },
+		"nil CommD":      func(p *OneOfManyProof) { p.CommD = nil },
+		"identity X":     func(p *OneOfManyProof) { p.X[0] = NewInfinity() },
+		"short X":        func(p *OneOfManyProof) { p.X = p.X[:1] },
+		"short F":        func(p *OneOfManyProof) { p.F = p.F[:1] },
+		"nil F entry":    func(p *OneOfManyProof) { p.F[1][0] = nil },
+		"nil Z":          func(p *OneOfManyProof) { p.Z = nil },
+	}
+	for name, mutate := range mutations {
+		p, err := ParseOneOfManyProof(raw, len(list))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mutate(p)
+		if VerifyOneOfMany(list, p) {
+			t.Fatalf("%s: proof verified", name)
+		}
+	}
+	if VerifyOneOfMany([]*Point{list[0], nil, list[2]}, proof) {
+		t.Fatal("proof verified with a nil commitment in the list")
+	}
+}
+
+func TestVectorCommitHomomorphic(t *testing.T) {
+	a := []*Scalar{NewScalar(big.NewInt(2)), NewScalar(big.NewInt(5))}
+	b := []*Scalar{NewScalar(big.NewInt(3)), NewScalar(big.NewInt(1))}
+	ra, rb := RandomScalar(), RandomScalar()
+	sum := []*Scalar{NewScalar(big.NewInt(5)), NewScalar(big.NewInt(6))}
+	got := pointAdd(VectorCommit(a, ra), VectorCommit(b, rb))
+	if !PointsEqual(got, VectorCommit(sum, NewScalar(scalarAdd(ra.int(), rb.int())))) {
+		t.Fatal("vector commitments do not add")
+	}
+	if PointsEqual(VectorCommit(a[:1], ra), PedersenCommit(a[0], ra)) {
+		t.Fatal("vector commitment shares a generator with PedersenCommit")
+	}
+}
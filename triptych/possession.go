@@ -0,0 +1,39 @@
+package triptych
+
+import (
+	"bytes"
+	"errors"
+)
+
+// A registration proof is a Schnorr signature by the registered key over
+// the voter's name, the election and a nonce the server issued for this
+// registration. It shows the registrant holds the secret key, so nobody can
+// enrol someone else's key or a key they cannot sign with, and it cannot be
+// replayed into another election or another registration.
+
+var ErrBadPossession = errors.New("proof of possession is invalid")
+
+func possessionMessage(pk *Point, electionID, fullName string, nonce []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("REGISTER")
+	writeString16(&buf, electionID)
+	writeString16(&buf, fullName)
+	buf.Write(pk.BytesCompressed())
+	writeString16(&buf, string(nonce))
+	return buf.Bytes()
+}
+
+// ProvePossession is run by the registrant with the nonce from the server.
+func ProvePossession(sk *Scalar, electionID, fullName string, nonce []byte) *SchnorrSignature {
+	return SchnorrSign(sk, possessionMessage(ScalarBaseMult(sk), electionID, fullName, nonce))
+}
+
+// VerifyPossession checks a registration proof for pk; the caller checks
+// that it issued the nonce and has not seen it used.
+func VerifyPossession(pk *Point, electionID, fullName string, nonce []byte, proof *SchnorrSignature) error {
+	if pk.IsIdentity() || len(nonce) == 0 || len(nonce) > 0xffff || len(fullName) > 0xffff || len(electionID) > 0xffff ||
+		!VerifySchnorr(pk, possessionMessage(pk, electionID, fullName, nonce), proof) {
+		return ErrBadPossession
+	}
+	return nil
+}
@@ -0,0 +1,442 @@
+package triptych
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sync"
+)
+
+// Bulletproofs range proofs (Bünz et al.) over V = v*H + gamma*G, where H is
+// ValueGenerator and G the curve base point, i.e. the same commitments as
+// PedersenCommit. Several values can share one aggregated proof.
+
+type RangeProof struct {
+	A    *Point
+	S    *Point
+	T1   *Point
+	T2   *Point
+	TauX *big.Int
+	Mu   *big.Int
+	THat *big.Int
+	L    []*Point
+	R    []*Point
+	IPA  *big.Int
+	IPB  *big.Int
+}
+
+var (
+	ErrRangeBits  = errors.New("bits must be one of 8, 16, 32, 64")
+	ErrRangeCount = errors.New("number of aggregated values must be a power of two")
+	ErrOutOfRange = errors.New("value does not fit into the requested number of bits")
+)
+
+var (
+	bpGensMu sync.Mutex
+	bpGensG  []*Point
+	bpGensH  []*Point
+)
+
+func bulletproofGens(size int) ([]*Point, []*Point) {
+	bpGensMu.Lock()
+	defer bpGensMu.Unlock()
+	for len(bpGensG) < size {
+		i := len(bpGensG)
+		bpGensG = append(bpGensG, getLabeledNUMS("BP-G", i))
+		bpGensH = append(bpGensH, getLabeledNUMS("BP-H", i))
+	}
+	return bpGensG[:size], bpGensH[:size]
+}
+
+type transcript struct {
+	buf bytes.Buffer
+}
+
+func newTranscript(label string) *transcript {
+	t := &transcript{}
+	t.buf.WriteString(label)
+	return t
+}
+
+func (t *transcript) appendPoints(pts ...*Point) {
+	for _, p := range pts {
+		t.buf.Write(p.BytesCompressed())
+	}
+}
+
+func (t *transcript) appendScalars(ks ...*big.Int) {
+	for _, k := range ks {
+		t.buf.Write(scalarBytes32(k))
+	}
+}
+
+func (t *transcript) challenge() *big.Int {
+	c := hashToScalar(t.buf.Bytes())
+	t.buf.Write(scalarBytes32(c))
+	return c
+}
+
+func rangeTranscript(commitments []*Point, bits int) *transcript {
+	t := newTranscript("BULLETPROOF")
+	t.buf.WriteByte(byte(bits))
+	_ = binary.Write(&t.buf, binary.BigEndian, uint32(len(commitments)))
+	t.appendPoints(commitments...)
+	return t
+}
+
+func checkRangeShape(bits, count int) error {
+	switch bits {
+	case 8, 16, 32, 64:
+	default:
+		return ErrRangeBits
+	}
+	if count <= 0 || count&(count-1) != 0 {
+		return ErrRangeCount
+	}
+	return nil
+}
+
+func innerProduct(a, b []*big.Int) *big.Int {
+	acc := big.NewInt(0)
+	for i := range a {
+		acc = scalarAdd(acc, scalarMul(a[i], b[i]))
+	}
+	return acc
+}
+
+func multiScalarMult(scalars []*big.Int, pts []*Point) *Point {
+	acc := NewInfinity()
+	for i := range scalars {
+		if scalars[i].Sign() == 0 {
+			continue
+		}
+		acc = pointAdd(acc, pointScalarMult(scalars[i], pts[i]))
+	}
+	return acc
+}
+
+func scalarPowers(x *big.Int, n int) []*big.Int {
+	out := make([]*big.Int, n)
+	cur := big.NewInt(1)
+	for i := 0; i < n; i++ {
+		out[i] = cur
+		cur = scalarMul(cur, x)
+	}
+	return out
+}
+
+// rangeZBlock returns the vector z^(2+j) * 2^k at position j*bits+k.
+func rangeZBlock(z *big.Int, bits, count int) []*big.Int {
+	out := make([]*big.Int, bits*count)
+	twoN := scalarPowers(big.NewInt(2), bits)
+	zj := scalarMul(z, z)
+	for j := 0; j < count; j++ {
+		for k := 0; k < bits; k++ {
+			out[j*bits+k] = scalarMul(zj, twoN[k])
+		}
+		zj = scalarMul(zj, z)
+	}
+	return out
+}
+
+func ProveRange(value uint64, blind *Scalar, bits int) (*RangeProof, *Point, error) {
+	proof, comms, err := ProveRangeAggregated([]uint64{value}, []*Scalar{blind}, bits)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proof, comms[0], nil
+}
+
+func VerifyRange(commitment *Point, proof *RangeProof, bits int) bool {
+	return VerifyRangeAggregated([]*Point{commitment}, proof, bits)
+}
+
+func ProveRangeAggregated(values []uint64, blinds []*Scalar, bits int) (*RangeProof, []*Point, error) {
+	count := len(values)
+	if err := checkRangeShape(bits, count); err != nil {
+		return nil, nil, err
+	}
+	if len(blinds) != count {
+		return nil, nil, errors.New("need one blinding factor per value")
+	}
+	nm := bits * count
+	Gs, Hs := bulletproofGens(nm)
+	B := ValueGenerator()
+	Bb := NewPoint(Gx, Gy)
+
+	comms := make([]*Point, count)
+	aL := make([]*big.Int, nm)
+	aR := make([]*big.Int, nm)
+	one := big.NewInt(1)
+	for j, v := range values {
+		if bits < 64 && v>>uint(bits) != 0 {
+			return nil, nil, ErrOutOfRange
+		}
+		comms[j] = PedersenCommit(NewScalar(new(big.Int).SetUint64(v)), blinds[j])
+		for k := 0; k < bits; k++ {
+			bit := big.NewInt(int64((v >> uint(k)) & 1))
+			aL[j*bits+k] = bit
+			aR[j*bits+k] = scalarSub(bit, one)
+		}
+	}
+
+	t := rangeTranscript(comms, bits)
+
+	alpha := randScalar()
+	A := pointAdd(pointScalarMult(alpha, Bb), pointAdd(multiScalarMult(aL, Gs), multiScalarMult(aR, Hs)))
+	sL := make([]*big.Int, nm)
+	sR := make([]*big.Int, nm)
+	for i := 0; i < nm; i++ {
+		sL[i] = randScalar()
+		sR[i] = randScalar()
+	}
+	rho := randScalar()
+	S := pointAdd(pointScalarMult(rho, Bb), pointAdd(multiScalarMult(sL, Gs), multiScalarMult(sR, Hs)))
+	t.appendPoints(A, S)
+	y := t.challenge()
+	z := t.challenge()
+
+	yN := scalarPowers(y, nm)
+	zBlock := rangeZBlock(z, bits, count)
+	l0 := make([]*big.Int, nm)
+	r0 := make([]*big.Int, nm)
+	r1 := make([]*big.Int, nm)
+	for i := 0; i < nm; i++ {
+		l0[i] = scalarSub(aL[i], z)
+		r0[i] = scalarAdd(scalarMul(yN[i], scalarAdd(aR[i], z)), zBlock[i])
+		r1[i] = scalarMul(yN[i], sR[i])
+	}
+	t1 := scalarAdd(innerProduct(l0, r1), innerProduct(sL, r0))
+	t2 := innerProduct(sL, r1)
+
+	tau1, tau2 := randScalar(), randScalar()
+	T1 := pointAdd(pointScalarMult(t1, B), pointScalarMult(tau1, Bb))
+	T2 := pointAdd(pointScalarMult(t2, B), pointScalarMult(tau2, Bb))
+	t.appendPoints(T1, T2)
+	x := t.challenge()
+
+	l := make([]*big.Int, nm)
+	r := make([]*big.Int, nm)
+	for i := 0; i < nm; i++ {
+		l[i] = scalarAdd(l0[i], scalarMul(sL[i], x))
+		r[i] = scalarAdd(r0[i], scalarMul(r1[i], x))
+	}
+	tHat := innerProduct(l, r)
+	tauX := scalarAdd(scalarMul(tau2, scalarMul(x, x)), scalarMul(tau1, x))
+	zj := scalarMul(z, z)
+	for j := 0; j < count; j++ {
+		tauX = scalarAdd(tauX, scalarMul(zj, blinds[j].int()))
+		zj = scalarMul(zj, z)
+	}
+	mu := scalarAdd(alpha, scalarMul(rho, x))
+
+	t.appendScalars(tauX, mu, tHat)
+	w := t.challenge()
+	Q := pointScalarMult(w, B)
+
+	yInv := modInv(y, secpN)
+	Hp := make([]*Point, nm)
+	for i, yi := range scalarPowers(yInv, nm) {
+		Hp[i] = pointScalarMult(yi, Hs[i])
+	}
+	Ls, Rs, a, b := proveInnerProduct(t, Gs, Hp, Q, l, r)
+
+	return &RangeProof{
+		A: A, S: S, T1: T1, T2: T2,
+		TauX: tauX, Mu: mu, THat: tHat,
+		L: Ls, R: Rs, IPA: a, IPB: b,
+	}, comms, nil
+}
+
+func proveInnerProduct(t *transcript, G, H []*Point, Q *Point, a, b []*big.Int) ([]*Point, []*Point, *big.Int, *big.Int) {
+	G = append([]*Point(nil), G...)
+	H = append([]*Point(nil), H...)
+	a = append([]*big.Int(nil), a...)
+	b = append([]*big.Int(nil), b...)
+	var Ls, Rs []*Point
+	for len(a) > 1 {
+		k := len(a) / 2
+		cL := innerProduct(a[:k], b[k:])
+		cR := innerProduct(a[k:], b[:k])
+		L := pointAdd(pointAdd(multiScalarMult(a[:k], G[k:]), multiScalarMult(b[k:], H[:k])), pointScalarMult(cL, Q))
+		R := pointAdd(pointAdd(multiScalarMult(a[k:], G[:k]), multiScalarMult(b[:k], H[k:])), pointScalarMult(cR, Q))
+		Ls = append(Ls, L)
+		Rs = append(Rs, R)
+		t.appendPoints(L, R)
+		u := t.challenge()
+		uInv := modInv(u, secpN)
+
+		for i := 0; i < k; i++ {
+			G[i] = pointAdd(pointScalarMult(uInv, G[i]), pointScalarMult(u, G[k+i]))
+			H[i] = pointAdd(pointScalarMult(u, H[i]), pointScalarMult(uInv, H[k+i]))
+			a[i] = scalarAdd(scalarMul(u, a[i]), scalarMul(uInv, a[k+i]))
+			b[i] = scalarAdd(scalarMul(uInv, b[i]), scalarMul(u, b[k+i]))
+		}
+		G, H, a, b = G[:k], H[:k], a[:k], b[:k]
+	}
+	return Ls, Rs, a[0], b[0]
+}
+
+func VerifyRangeAggregated(commitments []*Point, proof *RangeProof, bits int) bool {
+	count := len(commitments)
+	if proof == nil || checkRangeShape(bits, count) != nil {
+		return false
+	}
+	nm := bits * count
+	rounds := 0
+	for (1 << uint(rounds)) < nm {
+		rounds++
+	}
+	if len(proof.L) != rounds || len(proof.R) != rounds ||
+		!allFinite([]*Point{proof.A, proof.S, proof.T1, proof.T2}, proof.L, proof.R) {
+		return false
+	}
+	for _, k := range []*big.Int{proof.TauX, proof.Mu, proof.THat, proof.IPA, proof.IPB} {
+		if k == nil {
+			return false
+		}
+	}
+	for _, C := range commitments {
+		if C == nil {
+			return false
+		}
+	}
+	Gs, Hs := bulletproofGens(nm)
+	B := ValueGenerator()
+	Bb := NewPoint(Gx, Gy)
+
+	t := rangeTranscript(commitments, bits)
+	t.appendPoints(proof.A, proof.S)
+	y := t.challenge()
+	z := t.challenge()
+	t.appendPoints(proof.T1, proof.T2)
+	x := t.challenge()
+	t.appendScalars(proof.TauX, proof.Mu, proof.THat)
+	w := t.challenge()
+
+	yN := scalarPowers(y, nm)
+	zz := scalarMul(z, z)
+	sumY := big.NewInt(0)
+	for _, v := range yN {
+		sumY = scalarAdd(sumY, v)
+	}
+	sum2 := scalarSub(new(big.Int).Lsh(big.NewInt(1), uint(bits)), big.NewInt(1))
+	delta := scalarMul(scalarSub(z, zz), sumY)
+	zj := scalarMul(zz, z)
+	for j := 0; j < count; j++ {
+		delta = scalarSub(delta, scalarMul(zj, sum2))
+		zj = scalarMul(zj, z)
+	}
+
+	lhs := pointAdd(pointScalarMult(proof.THat, B), pointScalarMult(proof.TauX, Bb))
+	rhs := pointAdd(pointScalarMult(delta, B), pointAdd(pointScalarMult(x, proof.T1), pointScalarMult(scalarMul(x, x), proof.T2)))
+	zj = zz
+	for j := 0; j < count; j++ {
+		rhs = pointAdd(rhs, pointScalarMult(zj, commitments[j]))
+		zj = scalarMul(zj, z)
+	}
+	if !PointsEqual(lhs, rhs) {
+		return false
+	}
+
+	yInv := modInv(y, secpN)
+	Hp := make([]*Point, nm)
+	for i, yi := range scalarPowers(yInv, nm) {
+		Hp[i] = pointScalarMult(yi, Hs[i])
+	}
+	zBlock := rangeZBlock(z, bits, count)
+	negZ := scalarSub(big.NewInt(0), z)
+	gScalars := make([]*big.Int, nm)
+	hScalars := make([]*big.Int, nm)
+	for i := 0; i < nm; i++ {
+		gScalars[i] = negZ
+		hScalars[i] = scalarAdd(scalarMul(z, yN[i]), zBlock[i])
+	}
+	P := pointAdd(proof.A, pointScalarMult(x, proof.S))
+	P = pointAdd(P, multiScalarMult(gScalars, Gs))
+	P = pointAdd(P, multiScalarMult(hScalars, Hp))
+	P = pointAdd(P, pointNeg(pointScalarMult(proof.Mu, Bb)))
+
+	Q := pointScalarMult(w, B)
+	P = pointAdd(P, pointScalarMult(proof.THat, Q))
+	return verifyInnerProduct(t, Gs, Hp, Q, P, proof)
+}
+
+func verifyInnerProduct(t *transcript, G, H []*Point, Q, P *Point, proof *RangeProof) bool {
+	G = append([]*Point(nil), G...)
+	H = append([]*Point(nil), H...)
+	for r := range proof.L {
+		k := len(G) / 2
+		t.appendPoints(proof.L[r], proof.R[r])
+		u := t.challenge()
+		uInv := modInv(u, secpN)
+		u2 := scalarMul(u, u)
+		uInv2 := scalarMul(uInv, uInv)
+		P = pointAdd(P, pointAdd(pointScalarMult(u2, proof.L[r]), pointScalarMult(uInv2, proof.R[r])))
+		for i := 0; i < k; i++ {
+			G[i] = pointAdd(pointScalarMult(uInv, G[i]), pointScalarMult(u, G[k+i]))
+			H[i] = pointAdd(pointScalarMult(u, H[i]), pointScalarMult(uInv, H[k+i]))
+		}
+		G, H = G[:k], H[:k]
+	}
+	expect := pointAdd(pointAdd(pointScalarMult(proof.IPA, G[0]), pointScalarMult(proof.IPB, H[0])),
+		pointScalarMult(scalarMul(proof.IPA, proof.IPB), Q))
+	return PointsEqual(P, expect)
+}
+
+func (p *RangeProof) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, P := range []*Point{p.A, p.S, p.T1, p.T2} {
+		buf.Write(P.BytesCompressed())
+	}
+	for _, k := range []*big.Int{p.TauX, p.Mu, p.THat} {
+		buf.Write(scalarBytes32(k))
+	}
+	for i := range p.L {
+		buf.Write(p.L[i].BytesCompressed())
+		buf.Write(p.R[i].BytesCompressed())
+	}
+	buf.Write(scalarBytes32(p.IPA))
+	buf.Write(scalarBytes32(p.IPB))
+	return buf.Bytes()
+}
+
+// ParseRangeProof rejects identity points; an honest prover never makes one.
+func ParseRangeProof(b []byte) (*RangeProof, error) {
+	fixed := 4*33 + 3*32 + 2*32
+	if len(b) < fixed || (len(b)-fixed)%66 != 0 {
+		return nil, errors.New("invalid range proof length")
+	}
+	rounds := (len(b) - fixed) / 66
+	off := 0
+	var perr error
+	readPoint := func() *Point {
+		P, err := parseFinite(b[off : off+33])
+		off += 33
+		if err != nil && perr == nil {
+			perr = err
+		}
+		return P
+	}
+	readScalar := func() *big.Int {
+		k := scalarFromBytes32(b[off : off+32])
+		off += 32
+		return k
+	}
+
+	p := &RangeProof{}
+	p.A, p.S, p.T1, p.T2 = readPoint(), readPoint(), readPoint(), readPoint()
+	p.TauX, p.Mu, p.THat = readScalar(), readScalar(), readScalar()
+	p.L = make([]*Point, rounds)
+	p.R = make([]*Point, rounds)
+	for i := 0; i < rounds; i++ {
+		p.L[i] = readPoint()
+		p.R[i] = readPoint()
+	}
+	p.IPA, p.IPB = readScalar(), readScalar()
+	if perr != nil {
+		return nil, perr
+	}
+	return p, nil
+}
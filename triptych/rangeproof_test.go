@@ -0,0 +1,132 @@
+package triptych
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestRangeRoundTrip(t *testing.T) {
+	blind := RandomScalar()
+	proof, C, err := ProveRange(200, blind, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !PointsEqual(C, PedersenCommit(NewScalar(big.NewInt(200)), blind)) {
+		t.Fatal("range proof commitment is not PedersenCommit")
+	}
+	got, err := ParseRangeProof(proof.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyRange(C, got, 8) {
+		t.Fatal("valid range proof rejected")
+	}
+	if VerifyRange(C, got, 16) {
+		t.Fatal("range proof verified for another bit length")
+	}
+}
+
+func TestRangeAggregated(t *testing.T) {
+	values := []uint64{0, 1, 65535, 1234}
+	blinds := []*Scalar{RandomScalar(), RandomScalar(), RandomScalar(), RandomScalar()}
+	proof, comms, err := ProveRangeAggregated(values, blinds, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyRangeAggregated(comms, proof, 16) {
+		t.Fatal("valid aggregated proof rejected")
+	}
+	comms[1], comms[2] = comms[2], comms[1]
+	if VerifyRangeAggregated(comms, proof, 16) {
+		t.Fatal("aggregated proof verified with commitments reordered")
+	}
+	if _, _, err := ProveRangeAggregated(values[:3], blinds[:3], 16); !errors.Is(err, ErrRangeCount) {
+		t.Fatalf("three values: got %v, want ErrRangeCount", err)
+	}
+	if _, _, err := ProveRange(1, RandomScalar(), 12); !errors.Is(err, ErrRangeBits) {
+		t.Fatalf("12 bits: got %v, want ErrRangeBits", err)
+	}
+}
+
+func TestRangeOutOfRange(t *testing.T) {
+	if _, _, err := ProveRange(256, RandomScalar(), 8); !errors.Is(err, ErrOutOfRange) {
+		t.Fatalf("got %v, want ErrOutOfRange", err)
+	}
+	// A proof for one commitment says nothing about another.
+	proof, _, err := ProveRange(255, RandomScalar(), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyRange(PedersenCommit(NewScalar(big.NewInt(256)), RandomScalar()), proof, 8) {
+		t.Fatal("proof verified for an out-of-range commitment")
+	}
+}
+
+func TestRangeTamper(t *testing.T) {
+	proof, C, err := ProveRange(42, RandomScalar(), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := proof.Bytes()
+	for _, i := range []int{4*33 + 31, len(raw) - 1} {
+		bad := append([]byte(nil), raw...)
+		bad[i] ^= 1
+		p, err := ParseRangeProof(bad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if VerifyRange(C, p, 8) {
+			t.Fatalf("proof with byte %d flipped verified", i)
+		}
+	}
+}
+
+func TestRangeMalformed(t *testing.T) {
+	proof, C, err := ProveRange(7, RandomScalar(), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := proof.Bytes()
+
+	zeroT1 := append([]byte(nil), raw...)
+	copy(zeroT1[2*33:3*33], make([]byte, 33))
+	if _, err := ParseRangeProof(zeroT1); !errors.Is(err, ErrIdentity) {
+		t.Fatalf("identity T1: got %v, want ErrIdentity", err)
+	}
+	zeroL := append([]byte(nil), raw...)
+	copy(zeroL[4*33+3*32:4*33+3*32+33], make([]byte, 33))
+	if _, err := ParseRangeProof(zeroL); !errors.Is(err, ErrIdentity) {
+		t.Fatalf("identity L: got %v, want ErrIdentity", err)
+	}
+	if _, err := ParseRangeProof(make([]byte, len(raw))); err == nil {
+		t.Fatal("all-zero proof parsed")
+	}
+	if _, err := ParseRangeProof(raw[:len(raw)-1]); err == nil {
+		t.Fatal("short proof parsed")
+	}
+
+	mutations := map[string]func(p *RangeProof){
+		"identity A":  func(p *RangeProof) { p.A = NewInfinity() },
+		"nil S":       func(p *RangeProof) { p.S = nil },
+		"identity T2": func(p *RangeProof) { p.T2 = NewInfinity() },
+		"identity R":  func(p *RangeProof) { p.R[0] = NewInfinity() },
+		"nil L":       func(p *RangeProof) { p.L[1] = nil },
+		"short L":     func(p *RangeProof) { p.L = p.L[:1] },
+		"nil TauX":    func(p *RangeProof) { p.TauX = nil },
+		"nil IPB":     func(p *RangeProof) { p.IPB = nil },
+	}
+	for name, mutate := range mutations {
+		p, err := ParseRangeProof(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mutate(p)
+		if VerifyRange(C, p, 8) {
+			t.Fatalf("%s: proof verified", name)
+		}
+	}
+	if VerifyRange(nil, proof, 8) {
+		t.Fatal("proof verified for a nil commitment")
+	}
+}
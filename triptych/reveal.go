@@ -0,0 +1,71 @@
+package triptych
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Commit–reveal ballots. During voting the ring signature covers only
+// CommitCandidate(id, r); later the voter publishes (id, r) together with a
+// proof that they know the secret key behind the ballot's key image, so
+// nobody else can reveal (or spoil) someone's commitment.
+
+// Reveal opens a committed ballot. KeyImage matches the uNumber of the
+// signature that carried the commitment.
+type Reveal struct {
+	KeyImage    *Point     `json:"keyImage"`
+	CandidateID string     `json:"candidateId"`
+	Opening     *Scalar    `json:"opening"`
+	Proof       *DLEQProof `json:"proof"`
+}
+
+var (
+	ErrBadOpening     = errors.New("reveal does not open the commitment")
+	ErrBadRevealProof = errors.New("reveal is not bound to the key image")
+)
+
+// CandidateScalar maps a candidate ID to the committed value.
+func CandidateScalar(candidateID string) *Scalar {
+	return HashToScalar([]byte("CANDIDATE"), []byte(candidateID))
+}
+
+func CommitCandidate(candidateID string, r *Scalar) *Point {
+	return PedersenCommit(CandidateScalar(candidateID), r)
+}
+
+func revealContext(commitment *Point, candidateID string, r *Scalar) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("REVEAL")
+	buf.Write(commitment.BytesCompressed())
+	buf.Write(r.Bytes())
+	buf.WriteString(candidateID)
+	return buf.Bytes()
+}
+
+// NewReveal builds the reveal for a commitment signed with seckey. The proof
+// is a Schnorr proof of seckey w.r.t. the key image seckey*J.
+func NewReveal(seckey *Scalar, commitment *Point, candidateID string, r *Scalar) (*Reveal, error) {
+	if !CommitCandidate(candidateID, r).Equal(commitment) {
+		return nil, ErrBadOpening
+	}
+	U := pointScalarMult(seckey.int(), JPoint)
+	return &Reveal{
+		KeyImage:    U,
+		CandidateID: candidateID,
+		Opening:     r,
+		Proof:       proveDLEQ(seckey.int(), JPoint, U, JPoint, U, revealContext(commitment, candidateID, r)),
+	}, nil
+}
+
+func VerifyReveal(commitment *Point, rv *Reveal) error {
+	if rv == nil || commitment == nil || rv.KeyImage.IsIdentity() || rv.Opening == nil {
+		return ErrBadOpening
+	}
+	if !CommitCandidate(rv.CandidateID, rv.Opening).Equal(commitment) {
+		return ErrBadOpening
+	}
+	if !verifyDLEQ(rv.Proof, JPoint, rv.KeyImage, JPoint, rv.KeyImage, revealContext(commitment, rv.CandidateID, rv.Opening)) {
+		return ErrBadRevealProof
+	}
+	return nil
+}
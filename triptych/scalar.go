@@ -2,6 +2,7 @@ package triptych
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"math/big"
 )
 
@@ -23,6 +24,20 @@ func scalarFromBytes32(b []byte) *big.Int {
 	return k
 }
 
+func hashToScalar(data []byte) *big.Int {
+	h := sha256.Sum256(data)
+	return new(big.Int).Mod(new(big.Int).SetBytes(h[:]), secpN)
+}
+
+func scalarBytes32(k *big.Int) []byte {
+	b := k.Bytes()
+	if len(b) < 32 {
+		pad := make([]byte, 32-len(b))
+		b = append(pad, b...)
+	}
+	return b
+}
+
 func scalarAdd(a, b *big.Int) *big.Int { return modAdd(a, b, secpN) }
 func scalarSub(a, b *big.Int) *big.Int { return modSub(a, b, secpN) }
 func scalarMul(a, b *big.Int) *big.Int { return modMul(a, b, secpN) }
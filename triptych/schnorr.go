@@ -0,0 +1,124 @@
+package triptych
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+)
+
+// SchnorrSignature is a BIP340 signature (r, s): r is the x coordinate of
+// the nonce point and the public key is used x-only, so P and -P verify
+// the same signatures. Services use it to sign statements such as tree
+// heads, election manifests and ring snapshots.
+type SchnorrSignature struct {
+	R *big.Int
+	S *big.Int
+}
+
+func taggedHash(tag string, data ...[]byte) []byte {
+	t := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(t[:])
+	h.Write(t[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func xBytes(P *Point) []byte { return scalarBytes32(P.X) }
+
+// liftXEven is lift_x from BIP340: the point with the given x and even y.
+func liftXEven(x *big.Int) (*Point, bool) {
+	if x.Cmp(secpP) >= 0 {
+		return nil, false
+	}
+	rhs := modAdd(modMul(x, modMul(x, x, secpP), secpP), secpB, secpP)
+	y, ok := sqrtModP(rhs)
+	if !ok {
+		return nil, false
+	}
+	if y.Bit(0) == 1 {
+		y = new(big.Int).Sub(secpP, y)
+	}
+	return NewPoint(x, y), true
+}
+
+func SchnorrSign(sk *Scalar, msg []byte) *SchnorrSignature {
+	aux := make([]byte, 32)
+	_, _ = rand.Read(aux)
+	return schnorrSign(sk.int(), msg, aux)
+}
+
+func schnorrSign(d *big.Int, msg, aux []byte) *SchnorrSignature {
+	P := baseScalarMult(d)
+	if P.Y.Bit(0) == 1 {
+		d = scalarSub(big.NewInt(0), d)
+	}
+	t := new(big.Int).Xor(d, new(big.Int).SetBytes(taggedHash("BIP0340/aux", aux)))
+	k := new(big.Int).SetBytes(taggedHash("BIP0340/nonce", scalarBytes32(t), xBytes(P), msg))
+	k.Mod(k, secpN)
+	R := baseScalarMult(k)
+	if R.Y.Bit(0) == 1 {
+		k = scalarSub(big.NewInt(0), k)
+	}
+	e := schnorrChallenge(xBytes(R), xBytes(P), msg)
+	return &SchnorrSignature{R: R.X, S: scalarAdd(k, scalarMul(e, d))}
+}
+
+func schnorrChallenge(r, px, msg []byte) *big.Int {
+	e := new(big.Int).SetBytes(taggedHash("BIP0340/challenge", r, px, msg))
+	return e.Mod(e, secpN)
+}
+
+// VerifySchnorr checks sig against the x-only form of pk.
+func VerifySchnorr(pk *Point, msg []byte, sig *SchnorrSignature) bool {
+	if pk == nil || pk.Inf || sig == nil || sig.R == nil || sig.S == nil {
+		return false
+	}
+	if sig.R.Cmp(secpP) >= 0 || sig.S.Cmp(secpN) >= 0 {
+		return false
+	}
+	P, ok := liftXEven(pk.X)
+	if !ok {
+		return false
+	}
+	e := schnorrChallenge(scalarBytes32(sig.R), xBytes(P), msg)
+	R := pointAdd(baseScalarMult(sig.S), pointNeg(pointScalarMult(e, P)))
+	return !R.Inf && R.Y.Bit(0) == 0 && R.X.Cmp(sig.R) == 0
+}
+
+func (sig *SchnorrSignature) Bytes() []byte {
+	out := make([]byte, 0, 64)
+	out = append(out, scalarBytes32(sig.R)...)
+	return append(out, scalarBytes32(sig.S)...)
+}
+
+func ParseSchnorrSignature(b []byte) (*SchnorrSignature, error) {
+	if len(b) != 64 {
+		return nil, errorsNew("schnorr signature must be 64 bytes")
+	}
+	return &SchnorrSignature{R: new(big.Int).SetBytes(b[:32]), S: new(big.Int).SetBytes(b[32:])}, nil
+}
+
+func (sig *SchnorrSignature) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(sig.Bytes())), nil
+}
+
+func (sig *SchnorrSignature) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	q, err := ParseSchnorrSignature(b)
+	if err != nil {
+		return err
+	}
+	*sig = *q
+	return nil
+}
+
+func (sig *SchnorrSignature) Equal(o *SchnorrSignature) bool {
+	return sig != nil && o != nil && sig.R.Cmp(o.R) == 0 && sig.S.Cmp(o.S) == 0
+}
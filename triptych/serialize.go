@@ -40,7 +40,28 @@ func Serialize(sig *Signature) (raw []byte, keyImage []byte) {
 	return buf.Bytes(), sig.U.BytesCompressed()
 }
 
+// Deserialize parses a signature and its key image. Every point must parse
+// and none may be the identity.
 func Deserialize(raw []byte, m, n int, keyImg []byte) (*Signature, error) {
+	if len(keyImg) != 33 {
+		return nil, errors.New("key image must be 33 bytes")
+	}
+	sig, err := deserializeProof(raw, m, n)
+	if err != nil {
+		return nil, err
+	}
+	if sig.U, err = parseFinite(keyImg); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// deserializeProof parses everything but the key image, which a traceable
+// signature does not have.
+func deserializeProof(raw []byte, m, n int) (*Signature, error) {
+	if n < 2 || m < 1 {
+		return nil, errors.New("n must be at least 2 and m at least 1")
+	}
 	need :=
 		4*33 +
 			m*33 +
@@ -50,9 +71,6 @@ func Deserialize(raw []byte, m, n int, keyImg []byte) (*Signature, error) {
 	if len(raw) != need {
 		return nil, errors.New("invalid raw length for given m,n")
 	}
-	if len(keyImg) != 33 {
-		return nil, errors.New("key image must be 33 bytes")
-	}
 
 	off := 0
 	read := func(n int) []byte {
@@ -61,8 +79,12 @@ func Deserialize(raw []byte, m, n int, keyImg []byte) (*Signature, error) {
 		return b
 	}
 
+	var err error
 	p := func(b []byte) *Point {
-		P, _ := ParseCompressed(b)
+		P, perr := parseFinite(b)
+		if perr != nil && err == nil {
+			err = perr
+		}
 		return P
 	}
 
@@ -80,6 +102,9 @@ func Deserialize(raw []byte, m, n int, keyImg []byte) (*Signature, error) {
 	for i := 0; i < m; i++ {
 		sig.Y[i] = p(read(33))
 	}
+	if err != nil {
+		return nil, err
+	}
 	sig.F = make([][]*big.Int, m)
 	for j := 0; j < m; j++ {
 		sig.F[j] = make([]*big.Int, n-1)
@@ -94,12 +119,6 @@ func Deserialize(raw []byte, m, n int, keyImg []byte) (*Signature, error) {
 	sig.ZA = new(big.Int).Mod(zA, secpN)
 	sig.ZC = new(big.Int).Mod(zC, secpN)
 	sig.Z = new(big.Int).Mod(z, secpN)
-
-	U, err := ParseCompressed(keyImg)
-	if err != nil {
-		return nil, err
-	}
-	sig.U = U
 	return sig, nil
 }
 
@@ -0,0 +1,244 @@
+package triptych
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+)
+
+// Traceable ring signatures (Fujisaki–Suzuki) on top of the Triptych proof.
+// Within one scope the signer publishes A1 such that the points
+// sigma_k = A0 + k*A1 (k = 1..N, A0 = H(scope, ring, message)) satisfy
+// sigma_l = sk*H(scope, ring) for the hidden index l. Two signatures by the
+// same key therefore share exactly one sigma on different messages and all
+// of them on the same message.
+
+type TraceableSignature struct {
+	CommA *Point
+	CommB *Point
+	CommC *Point
+	CommD *Point
+	X     []*Point
+	Y     []*Point
+	F     [][]*big.Int
+	ZA    *big.Int
+	ZC    *big.Int
+	Z     *big.Int
+	A1    *Point
+}
+
+type TraceKind int
+
+const (
+	TraceIndependent TraceKind = iota
+	TraceLinked
+	TraceRevealed
+)
+
+func (k TraceKind) String() string {
+	switch k {
+	case TraceLinked:
+		return "linked"
+	case TraceRevealed:
+		return "revealed"
+	default:
+		return "independent"
+	}
+}
+
+type TraceResult struct {
+	Kind   TraceKind
+	PubKey *Point
+	Index  int
+}
+
+var ErrBadTraceable = errors.New("malformed traceable signature")
+
+// maxScope is the longest scope the length-prefixed encoding can carry.
+const maxScope = 0xffff
+
+func canonicalRing(ring []*Point) []*Point {
+	out := make([]*Point, len(ring))
+	copy(out, ring)
+	sort.Slice(out, func(i, j int) bool {
+		return bytes.Compare(out[i].BytesCompressed(), out[j].BytesCompressed()) < 0
+	})
+	return out
+}
+
+func traceTag(scope []byte, ring []*Point) []byte {
+	var buf bytes.Buffer
+	writeString16(&buf, string(scope))
+	for _, p := range ring {
+		buf.Write(p.BytesCompressed())
+	}
+	return buf.Bytes()
+}
+
+func traceSigmas(tag, message []byte, a1 *Point, N int) []*Point {
+	a0 := hashToPoint("TRACE-A0", tag, message)
+	out := make([]*Point, N)
+	for k := 0; k < N; k++ {
+		out[k] = pointAdd(a0, pointScalarMult(big.NewInt(int64(k+1)), a1))
+	}
+	return out
+}
+
+func traceMessage(scope, message []byte, a1 *Point) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("TRACE")
+	writeString16(&buf, string(scope))
+	buf.Write(a1.BytesCompressed())
+	buf.Write(message)
+	return buf.Bytes()
+}
+
+func TraceableSign(seckey []byte, message, scope []byte, ring []*Point, n, m int) (*TraceableSignature, error) {
+	N := 1
+	for i := 0; i < m; i++ {
+		N *= n
+	}
+	if len(ring) != N {
+		return nil, ErrRingSize{Need: N, Got: len(ring)}
+	}
+	if len(scope) > maxScope {
+		return nil, errors.New("scope is longer than 65535 bytes")
+	}
+
+	ring = canonicalRing(ring)
+	realPub := PubKeyFromSecret(seckey)
+	l := -1
+	for i, p := range ring {
+		if bytes.Equal(p.BytesCompressed(), realPub.BytesCompressed()) {
+			l = i
+			break
+		}
+	}
+	if l == -1 {
+		return nil, ErrNoRealKey
+	}
+
+	sk := scalarFromBytes32(seckey)
+	tag := traceTag(scope, ring)
+	hs := hashToPoint("TRACE-H", tag)
+	a0 := hashToPoint("TRACE-A0", tag, message)
+	U := pointScalarMult(sk, hs)
+	lInv := modInv(big.NewInt(int64(l+1)), secpN)
+	a1 := pointScalarMult(lInv, pointAdd(U, pointNeg(a0)))
+	sigmas := traceSigmas(tag, message, a1, N)
+
+	commA, randA, matrixA := triptychGetA(n, m)
+	commB, randB, matrixS := triptychGetB(n, m, l)
+	commC, randC, _ := triptychGetC(matrixA, matrixS)
+	commD, randD, _ := triptychGetD(matrixA)
+
+	polys := triptychPolys(matrixS, matrixA, N, n, m)
+
+	rhos := make([]*big.Int, m)
+	for j := 0; j < m; j++ {
+		rhos[j] = randScalar()
+	}
+	X := triptychGetX(polys, ring, rhos, NewPoint(Gx, Gy))
+	Y := triptychGetX(polys, sigmas, rhos, hs)
+
+	x := transcriptHash(commA, commB, commC, commD, X, Y, ring, traceMessage(scope, message, a1))
+	f := triptychGetF(matrixS, matrixA, x)
+
+	return &TraceableSignature{
+		CommA: commA, CommB: commB, CommC: commC, CommD: commD,
+		X: X, Y: Y, F: f,
+		ZA: scalarAdd(randA, scalarMul(x, randB)),
+		ZC: scalarAdd(scalarMul(randC, x), randD),
+		Z:  triptychGetZ(sk, rhos, x),
+		A1: a1,
+	}, nil
+}
+
+func TraceableVerify(sig *TraceableSignature, message, scope []byte, ring []*Point, n, m int) bool {
+	if sig == nil || !finitePoint(sig.A1) || len(scope) > maxScope {
+		return false
+	}
+	if !wellFormed(&Signature{CommA: sig.CommA, CommB: sig.CommB, CommC: sig.CommC, CommD: sig.CommD, X: sig.X, Y: sig.Y, F: sig.F, ZA: sig.ZA, ZC: sig.ZC, Z: sig.Z}, ring, n, m) {
+		return false
+	}
+	N := len(ring)
+
+	ring = canonicalRing(ring)
+	tag := traceTag(scope, ring)
+	hs := hashToPoint("TRACE-H", tag)
+	sigmas := traceSigmas(tag, message, sig.A1, N)
+
+	x := transcriptHash(sig.CommA, sig.CommB, sig.CommC, sig.CommD, sig.X, sig.Y, ring, traceMessage(scope, message, sig.A1))
+	f := deepCopyMatrix(sig.F)
+	if !triptychCheckMatrices(f, sig.CommA, sig.CommB, sig.CommC, sig.CommD, sig.ZA, sig.ZC, x, n, m) {
+		return false
+	}
+
+	sumRing := NewInfinity()
+	sumSigma := NewInfinity()
+	for k, prodf := range triptychRingProducts(f, N, n, m) {
+		sumRing = pointAdd(sumRing, pointScalarMult(prodf, ring[k]))
+		sumSigma = pointAdd(sumSigma, pointScalarMult(prodf, sigmas[k]))
+	}
+
+	if !PointsEqual(sumRing, pointAdd(powerSum(sig.X, x), pointScalarMult(sig.Z, NewPoint(Gx, Gy)))) {
+		return false
+	}
+	return PointsEqual(sumSigma, pointAdd(powerSum(sig.Y, x), pointScalarMult(sig.Z, hs)))
+}
+
+// Trace compares two valid signatures from the same scope and ring. It does
+// not verify them; callers are expected to run TraceableVerify first.
+func Trace(scope []byte, ring []*Point, msg1 []byte, sig1 *TraceableSignature, msg2 []byte, sig2 *TraceableSignature) (TraceResult, error) {
+	if sig1 == nil || sig2 == nil || !finitePoint(sig1.A1) || !finitePoint(sig2.A1) || len(scope) > maxScope {
+		return TraceResult{}, ErrBadTraceable
+	}
+	ring = canonicalRing(ring)
+	tag := traceTag(scope, ring)
+	s1 := traceSigmas(tag, msg1, sig1.A1, len(ring))
+	s2 := traceSigmas(tag, msg2, sig2.A1, len(ring))
+
+	match := -1
+	matches := 0
+	for k := range s1 {
+		if PointsEqual(s1[k], s2[k]) {
+			matches++
+			match = k
+		}
+	}
+	switch {
+	case matches == len(ring):
+		return TraceResult{Kind: TraceLinked, Index: -1}, nil
+	case matches == 1:
+		return TraceResult{Kind: TraceRevealed, PubKey: ring[match], Index: match}, nil
+	default:
+		return TraceResult{Kind: TraceIndependent, Index: -1}, nil
+	}
+}
+
+func SerializeTraceable(sig *TraceableSignature) []byte {
+	raw, _ := Serialize(&Signature{
+		CommA: sig.CommA, CommB: sig.CommB, CommC: sig.CommC, CommD: sig.CommD,
+		X: sig.X, Y: sig.Y, F: sig.F, ZA: sig.ZA, ZC: sig.ZC, Z: sig.Z, U: NewInfinity(),
+	})
+	return append(sig.A1.BytesCompressed(), raw...)
+}
+
+func DeserializeTraceable(b []byte, m, n int) (*TraceableSignature, error) {
+	if len(b) < 33 {
+		return nil, errors.New("traceable signature too short")
+	}
+	a1, err := parseFinite(b[:33])
+	if err != nil {
+		return nil, err
+	}
+	sig, err := deserializeProof(b[33:], m, n)
+	if err != nil {
+		return nil, err
+	}
+	return &TraceableSignature{
+		CommA: sig.CommA, CommB: sig.CommB, CommC: sig.CommC, CommD: sig.CommD,
+		X: sig.X, Y: sig.Y, F: sig.F, ZA: sig.ZA, ZC: sig.ZC, Z: sig.Z, A1: a1,
+	}, nil
+}
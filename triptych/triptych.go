@@ -115,7 +115,7 @@ func triptychGetF(matrixS, matrixA [][]*big.Int, x *big.Int) [][]*big.Int {
 	return fs
 }
 
-func triptychGetX(polys [][]*big.Int, ring []*Point, rhos []*big.Int) []*Point {
+func triptychGetX(polys [][]*big.Int, ring []*Point, rhos []*big.Int, base *Point) []*Point {
 	m := len(rhos)
 	ptsJ := make([]*Point, m)
 	for j := 0; j < m; j++ {
@@ -126,7 +126,7 @@ func triptychGetX(polys [][]*big.Int, ring []*Point, rhos []*big.Int) []*Point {
 			}
 			sum = append(sum, pointScalarMult(polys[k][j], ring[k]))
 		}
-		sum = append(sum, pointScalarMult(rhos[j], NewPoint(Gx, Gy)))
+		sum = append(sum, pointScalarMult(rhos[j], base))
 		ptsJ[j] = pointsSum(sum)
 	}
 	return ptsJ
@@ -140,6 +140,98 @@ func triptychGetY(rhos []*big.Int) []*Point {
 	return out
 }
 
+func triptychPolys(matrixS, matrixA [][]*big.Int, N, n, m int) [][]*big.Int {
+	polys := make([][]*big.Int, N)
+	for i := 0; i < N; i++ {
+		idigits := naryDecomp(i, n, m)
+		poly := []*big.Int{big.NewInt(1)}
+		for j := 0; j < m; j++ {
+			a := matrixS[j][idigits[j]]
+			b := matrixA[j][idigits[j]]
+			poly = polyMultLin(poly, a, b)
+		}
+		for L, R := 0, len(poly)-1; L < R; L, R = L+1, R-1 {
+			poly[L], poly[R] = poly[R], poly[L]
+		}
+		polys[i] = poly
+	}
+	return polys
+}
+
+func triptychGetZ(sk *big.Int, rhos []*big.Int, x *big.Int) *big.Int {
+	xPow := big.NewInt(1)
+	sumRho := big.NewInt(0)
+	for j := 0; j < len(rhos); j++ {
+		if j == 0 {
+			xPow = big.NewInt(1)
+		} else {
+			xPow = scalarMul(xPow, x)
+		}
+		sumRho = scalarAdd(sumRho, scalarMul(xPow, rhos[j]))
+	}
+	xm := scalarPow(x, len(rhos))
+	return scalarSub(scalarMul(sk, xm), sumRho)
+}
+
+func triptychCheckMatrices(f [][]*big.Int, commA, commB, commC, commD *Point, zA, zC, x *big.Int, n, m int) bool {
+	if len(f) != m {
+		return false
+	}
+	for j := 0; j < m; j++ {
+		if len(f[j]) != n-1 {
+			return false
+		}
+		sumRow := big.NewInt(0)
+		for i := 0; i < len(f[j]); i++ {
+			sumRow = scalarAdd(sumRow, f[j][i])
+		}
+		first := scalarSub(x, sumRow)
+		f[j] = append([]*big.Int{first}, f[j]...)
+	}
+
+	lhs1 := pointAdd(commA, pointScalarMult(x, commB))
+	rhs1 := matrixPedersenCommit(f, zA)
+	if !PointsEqual(lhs1, rhs1) {
+		return false
+	}
+
+	fxf := make([][]*big.Int, len(f))
+	for j := 0; j < len(f); j++ {
+		fxf[j] = make([]*big.Int, len(f[0]))
+		for i := 0; i < len(f[0]); i++ {
+			fxf[j][i] = scalarMul(f[j][i], scalarSub(x, f[j][i]))
+		}
+	}
+	lhs2 := pointAdd(pointScalarMult(x, commC), commD)
+	rhs2 := matrixPedersenCommit(fxf, zC)
+	return PointsEqual(lhs2, rhs2)
+}
+
+func triptychRingProducts(f [][]*big.Int, N, n, m int) []*big.Int {
+	out := make([]*big.Int, N)
+	for k := 0; k < N; k++ {
+		idigits := naryDecomp(k, n, m)
+		prodf := big.NewInt(1)
+		for j := 0; j < m; j++ {
+			prodf = scalarMul(prodf, f[j][idigits[j]])
+		}
+		out[k] = prodf
+	}
+	return out
+}
+
+func powerSum(pts []*Point, x *big.Int) *Point {
+	xPow := big.NewInt(1)
+	acc := NewInfinity()
+	for j := 0; j < len(pts); j++ {
+		if j > 0 {
+			xPow = scalarMul(xPow, x)
+		}
+		acc = pointAdd(acc, pointScalarMult(xPow, pts[j]))
+	}
+	return acc
+}
+
 func RingSignTriptych(seckey []byte, message []byte, ring []*Point, n, m int) (*Signature, []*Point, error) {
 	N := 1
 	for i := 0; i < m; i++ {
@@ -149,25 +241,31 @@ func RingSignTriptych(seckey []byte, message []byte, ring []*Point, n, m int) (*
 		return nil, nil, ErrRingSize{Need: N, Got: len(ring)}
 	}
 
-	realPub := PubKeyFromSecret(seckey)
-	found := -1
-	for i, p := range ring {
-		if bytes.Equal(p.BytesCompressed(), realPub.BytesCompressed()) {
-			found = i
-			break
-		}
-	}
-	if found == -1 {
-		return nil, nil, ErrNoRealKey
-	}
-
 	ringSh := make([]*Point, len(ring))
 	copy(ringSh, ring)
 	for i := len(ringSh) - 1; i > 0; i-- {
 		j := randomInt(i + 1)
 		ringSh[i], ringSh[j] = ringSh[j], ringSh[i]
 	}
+	return ringSign(seckey, message, ringSh, n, m)
+}
 
+// RingSignCanonical signs over CanonicalRing(ring) instead of a shuffled
+// order, so a verifier that knows the ring by its digest can rebuild the
+// order without being sent the keys.
+func RingSignCanonical(seckey []byte, message []byte, ring []*Point, n, m int) (*Signature, []*Point, error) {
+	N := 1
+	for i := 0; i < m; i++ {
+		N *= n
+	}
+	if len(ring) != N {
+		return nil, nil, ErrRingSize{Need: N, Got: len(ring)}
+	}
+	return ringSign(seckey, message, CanonicalRing(ring), n, m)
+}
+
+func ringSign(seckey []byte, message []byte, ringSh []*Point, n, m int) (*Signature, []*Point, error) {
+	realPub := PubKeyFromSecret(seckey)
 	l := -1
 	for i, p := range ringSh {
 		if bytes.Equal(p.BytesCompressed(), realPub.BytesCompressed()) {
@@ -175,32 +273,22 @@ func RingSignTriptych(seckey []byte, message []byte, ring []*Point, n, m int) (*
 			break
 		}
 	}
+	if l == -1 {
+		return nil, nil, ErrNoRealKey
+	}
 
 	commA, randA, matrixA := triptychGetA(n, m)
 	commB, randB, matrixS := triptychGetB(n, m, l)
 	commC, randC, _ := triptychGetC(matrixA, matrixS)
 	commD, randD, _ := triptychGetD(matrixA)
 
-	polys := make([][]*big.Int, len(ringSh))
-	for i := 0; i < len(ringSh); i++ {
-		idigits := naryDecomp(i, n, m)
-		poly := []*big.Int{big.NewInt(1)}
-		for j := 0; j < m; j++ {
-			a := matrixS[j][idigits[j]]
-			b := matrixA[j][idigits[j]]
-			poly = polyMultLin(poly, a, b)
-		}
-		for L, R := 0, len(poly)-1; L < R; L, R = L+1, R-1 {
-			poly[L], poly[R] = poly[R], poly[L]
-		}
-		polys[i] = poly
-	}
+	polys := triptychPolys(matrixS, matrixA, len(ringSh), n, m)
 
 	rhos := make([]*big.Int, m)
 	for j := 0; j < m; j++ {
 		rhos[j] = randScalar()
 	}
-	X := triptychGetX(polys, ringSh, rhos)
+	X := triptychGetX(polys, ringSh, rhos, NewPoint(Gx, Gy))
 	Y := triptychGetY(rhos)
 
 	x := transcriptHash(commA, commB, commC, commD, X, Y, ringSh, message)
@@ -209,19 +297,8 @@ func RingSignTriptych(seckey []byte, message []byte, ring []*Point, n, m int) (*
 	zA := scalarAdd(randA, scalarMul(x, randB))
 	zC := scalarAdd(scalarMul(randC, x), randD)
 
-	xPow := big.NewInt(1)
-	sumRho := big.NewInt(0)
-	for j := 0; j < m; j++ {
-		if j == 0 {
-			xPow = big.NewInt(1)
-		} else {
-			xPow = scalarMul(xPow, x)
-		}
-		sumRho = scalarAdd(sumRho, scalarMul(xPow, rhos[j]))
-	}
-	xm := scalarPow(x, m)
 	sk := scalarFromBytes32(seckey)
-	z := scalarSub(scalarMul(sk, xm), sumRho)
+	z := triptychGetZ(sk, rhos, x)
 	U := pointScalarMult(sk, JPoint)
 
 	sig := &Signature{
@@ -231,7 +308,14 @@ func RingSignTriptych(seckey []byte, message []byte, ring []*Point, n, m int) (*
 	return sig, ringSh, nil
 }
 
+// VerifyTriptych checks sig over ring and returns the key image. The shape
+// is checked before any arithmetic: X and Y must have exactly m entries,
+// or the degree check the proof relies on is skipped, and no point,
+// the key image U included, may be missing or the identity.
 func VerifyTriptych(sig *Signature, message []byte, ring []*Point, n, m int) (bool, []byte) {
+	if !wellFormed(sig, ring, n, m) || !finitePoint(sig.U) {
+		return false, nil
+	}
 	commA, commB, commC, commD := sig.CommA, sig.CommB, sig.CommC, sig.CommD
 	X, Y := sig.X, sig.Y
 	f := deepCopyMatrix(sig.F)
@@ -239,42 +323,13 @@ func VerifyTriptych(sig *Signature, message []byte, ring []*Point, n, m int) (bo
 
 	x := transcriptHash(commA, commB, commC, commD, X, Y, ring, message)
 
-	for j := 0; j < m; j++ {
-		sumRow := big.NewInt(0)
-		for i := 0; i < len(f[j]); i++ {
-			sumRow = scalarAdd(sumRow, f[j][i])
-		}
-		first := scalarSub(x, sumRow)
-		f[j] = append([]*big.Int{first}, f[j]...)
-	}
-
-	lhs1 := pointAdd(commA, pointScalarMult(x, commB))
-	rhs1 := matrixPedersenCommit(f, zA)
-	if !PointsEqual(lhs1, rhs1) {
-		return false, nil
-	}
-
-	fxf := make([][]*big.Int, len(f))
-	for j := 0; j < len(f); j++ {
-		fxf[j] = make([]*big.Int, len(f[0]))
-		for i := 0; i < len(f[0]); i++ {
-			fxf[j][i] = scalarMul(f[j][i], scalarSub(x, f[j][i]))
-		}
-	}
-	lhs2 := pointAdd(pointScalarMult(x, commC), commD)
-	rhs2 := matrixPedersenCommit(fxf, zC)
-	if !PointsEqual(lhs2, rhs2) {
+	if !triptychCheckMatrices(f, commA, commB, commC, commD, zA, zC, x, n, m) {
 		return false, nil
 	}
 
 	sum_m_f_terms := NewInfinity()
 	sum_u_f_terms := NewInfinity()
-	for k := 0; k < len(ring); k++ {
-		idigits := naryDecomp(k, n, m)
-		prodf := big.NewInt(1)
-		for j := 0; j < m; j++ {
-			prodf = scalarMul(prodf, f[j][idigits[j]])
-		}
+	for k, prodf := range triptychRingProducts(f, len(ring), n, m) {
 		sum_m_f_terms = pointAdd(sum_m_f_terms, pointScalarMult(prodf, ring[k]))
 		sum_u_f_terms = pointAdd(sum_u_f_terms, pointScalarMult(prodf, U))
 	}
@@ -282,18 +337,8 @@ func VerifyTriptych(sig *Signature, message []byte, ring []*Point, n, m int) (bo
 	zG := pointScalarMult(z, NewPoint(Gx, Gy))
 	zJ := pointScalarMult(z, JPoint)
 
-	xPow := big.NewInt(1)
-	xX := NewInfinity()
-	xY := NewInfinity()
-	for j := 0; j < m; j++ {
-		if j == 0 {
-			xPow = big.NewInt(1)
-		} else {
-			xPow = scalarMul(xPow, x)
-		}
-		xX = pointAdd(xX, pointScalarMult(xPow, X[j]))
-		xY = pointAdd(xY, pointScalarMult(xPow, Y[j]))
-	}
+	xX := powerSum(X, x)
+	xY := powerSum(Y, x)
 
 	if !PointsEqual(sum_m_f_terms, pointAdd(xX, zG)) {
 		return false, nil
@@ -305,6 +350,46 @@ func VerifyTriptych(sig *Signature, message []byte, ring []*Point, n, m int) (bo
 	return true, U.BytesCompressed()
 }
 
+// wellFormed checks the parts a Triptych proof and a traceable signature
+// share.
+func wellFormed(sig *Signature, ring []*Point, n, m int) bool {
+	if sig == nil || n < 2 || m < 1 || len(sig.X) != m || len(sig.Y) != m {
+		return false
+	}
+	N := 1
+	for i := 0; i < m; i++ {
+		if N > len(ring)/n {
+			return false
+		}
+		N *= n
+	}
+	if len(ring) != N {
+		return false
+	}
+	if !allFinite([]*Point{sig.CommA, sig.CommB, sig.CommC, sig.CommD}, sig.X, sig.Y, ring) {
+		return false
+	}
+	return fullMatrix(sig.F, m, n-1) && sig.ZA != nil && sig.ZC != nil && sig.Z != nil
+}
+
+// fullMatrix reports whether f is rows x cols with no nil entry.
+func fullMatrix(f [][]*big.Int, rows, cols int) bool {
+	if len(f) != rows {
+		return false
+	}
+	for _, row := range f {
+		if len(row) != cols {
+			return false
+		}
+		for _, v := range row {
+			if v == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 type ErrRingSize struct{ Need, Got int }
 
 func (e ErrRingSize) Error() string { return "ring length must be n^m" }
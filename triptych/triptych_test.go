@@ -0,0 +1,143 @@
+package triptych
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+const testN, testM = 2, 2
+
+func testRing(t *testing.T) ([]byte, []*Point) {
+	t.Helper()
+	sk, _ := GenerateKey()
+	ring, err := MakeRingWithReal(testN*testN, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, ring
+}
+
+func TestTriptychRoundTrip(t *testing.T) {
+	sk, ring := testRing(t)
+	msg := []byte("ballot")
+	sig, ringSh, err := RingSignTriptych(sk, msg, ring, testN, testM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ki := Serialize(sig)
+	got, err := Deserialize(raw, testM, testN, ki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, img := VerifyTriptych(got, msg, ringSh, testN, testM)
+	if !ok || !bytes.Equal(img, ki) {
+		t.Fatal("valid signature rejected")
+	}
+}
+
+func TestTriptychTamper(t *testing.T) {
+	sk, ring := testRing(t)
+	msg := []byte("ballot")
+	sig, ringSh, err := RingSignTriptych(sk, msg, ring, testN, testM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := VerifyTriptych(sig, []byte("ballot!"), ringSh, testN, testM); ok {
+		t.Fatal("signature verified for another message")
+	}
+	raw, ki := Serialize(sig)
+	raw[len(raw)-1] ^= 1
+	bad, err := Deserialize(raw, testM, testN, ki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := VerifyTriptych(bad, msg, ringSh, testN, testM); ok {
+		t.Fatal("signature with a flipped byte verified")
+	}
+}
+
+func TestTriptychMalformed(t *testing.T) {
+	sk, ring := testRing(t)
+	msg := []byte("ballot")
+	sig, ringSh, err := RingSignTriptych(sk, msg, ring, testN, testM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ki := Serialize(sig)
+
+	if _, err := Deserialize(raw, testM, testN, make([]byte, 33)); !errors.Is(err, ErrIdentity) {
+		t.Fatalf("identity key image: got %v", err)
+	}
+	zeroA := append([]byte(nil), raw...)
+	copy(zeroA, make([]byte, 33))
+	if _, err := Deserialize(zeroA, testM, testN, ki); !errors.Is(err, ErrIdentity) {
+		t.Fatalf("identity commitment: got %v", err)
+	}
+	offCurve := append([]byte(nil), raw...)
+	offCurve[0] = 0x05
+	if _, err := Deserialize(offCurve, testM, testN, ki); err == nil {
+		t.Fatal("bad point prefix accepted")
+	}
+	if _, err := Deserialize(raw, testM, 0, ki); err == nil {
+		t.Fatal("n = 0 accepted")
+	}
+
+	for name, mutate := range map[string]func(s *Signature){
+		"identity U": func(s *Signature) { s.U = NewInfinity() },
+		"nil U":      func(s *Signature) { s.U = nil },
+		"extra X":    func(s *Signature) { s.X = append(s.X, s.X[0]) },
+		"short Y":    func(s *Signature) { s.Y = s.Y[:1] },
+		"nil CommC":  func(s *Signature) { s.CommC = nil },
+		"identity X": func(s *Signature) { s.X[0] = NewInfinity() },
+	} {
+		s := *sig
+		s.X = append([]*Point(nil), sig.X...)
+		s.Y = append([]*Point(nil), sig.Y...)
+		mutate(&s)
+		if ok, _ := VerifyTriptych(&s, msg, ringSh, testN, testM); ok {
+			t.Errorf("%s: verified", name)
+		}
+	}
+}
+
+func TestTraceable(t *testing.T) {
+	sk, ring := testRing(t)
+	msg, scope := []byte("ballot"), []byte("election-1")
+	sig, err := TraceableSign(sk, msg, scope, ring, testN, testM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DeserializeTraceable(SerializeTraceable(sig), testM, testN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !TraceableVerify(got, msg, scope, ring, testN, testM) {
+		t.Fatal("valid traceable signature rejected")
+	}
+	if TraceableVerify(got, msg, []byte("election-2"), ring, testN, testM) {
+		t.Fatal("traceable signature verified in another scope")
+	}
+
+	raw := SerializeTraceable(sig)
+	raw[len(raw)-1] ^= 1
+	if bad, err := DeserializeTraceable(raw, testM, testN); err != nil || TraceableVerify(bad, msg, scope, ring, testN, testM) {
+		t.Fatal("traceable signature with a flipped byte verified")
+	}
+	raw = SerializeTraceable(sig)
+	copy(raw, make([]byte, 33))
+	if _, err := DeserializeTraceable(raw, testM, testN); !errors.Is(err, ErrIdentity) {
+		t.Fatalf("identity A1: got %v", err)
+	}
+}
+
+// Without a length prefix, a scope that swallowed the first ring key would
+// give the same tag as the original scope and ring.
+func TestTraceTagScopeBoundary(t *testing.T) {
+	_, ring := testRing(t)
+	scope := []byte("election-1")
+	longer := append(append([]byte(nil), scope...), ring[0].BytesCompressed()...)
+	if bytes.Equal(traceTag(scope, ring), traceTag(longer, ring[1:])) {
+		t.Fatal("scope boundary is ambiguous in the trace tag")
+	}
+}